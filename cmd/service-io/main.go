@@ -8,11 +8,16 @@ import (
 	gormadapter "service-io/internal/adapters/gorm"
 	ncore "service-io/internal/adapters/nats"
 	"service-io/internal/adapters/traefik"
+	"sync"
 	"syscall"
+	"time"
 
 	"service-io/internal/config"
 	"service-io/internal/core/devices"
 	dockercli "service-io/internal/core/docker"
+	"service-io/internal/core/kube"
+	"service-io/internal/core/process"
+	"service-io/internal/core/runtime"
 	api "service-io/internal/delivery/http"
 
 	_ "service-io/docs" // Import the generated docs
@@ -44,6 +49,10 @@ func main() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("gorm connect")
 	}
+	elector, err := gormadapter.NewElector(db, cfg.LeaderElection, log)
+	if err != nil {
+		log.Fatal().Err(err).Msg("leader elector")
+	}
 
 	nc, err := ncore.New(cfg.NATSURL, log)
 	if err != nil {
@@ -51,31 +60,167 @@ func main() {
 	}
 	defer nc.Close()
 
-	dcli, err := dockercli.New(log)
-	if err != nil {
-		log.Fatal().Err(err).Msg("docker connect")
+	var (
+		rt          runtime.Runtime
+		hostRuntime func(*devices.Host) (runtime.Runtime, error)
+	)
+	switch cfg.Runtime {
+	case "docker":
+		rt, err = dockercli.New(log)
+		if err != nil {
+			log.Fatal().Err(err).Msg("docker connect")
+		}
+		// Registered hosts are further Docker engines devices can be placed on.
+		hostRuntime = func(h *devices.Host) (runtime.Runtime, error) {
+			return dockercli.NewForHost(dockercli.Host{
+				Name:      h.Name,
+				Endpoint:  h.Endpoint,
+				TLSCACert: h.TLSCACert,
+				TLSCert:   h.TLSCert,
+				TLSKey:    h.TLSKey,
+			}, log)
+		}
+	case "kubernetes":
+		rt, err = kube.NewFromKubeconfig(cfg.Kubeconfig, kube.Options{
+			Namespace:       cfg.KubeNamespace,
+			ImagePullSecret: cfg.KubeImagePullSecret,
+		}, log)
+		if err != nil {
+			log.Fatal().Err(err).Msg("kubernetes connect")
+		}
+	case "process":
+		rt, err = process.New(process.Options{
+			StateDir: cfg.ProcessStateDir,
+			LogLines: cfg.ProcessLogLines,
+			Limits: process.Limits{
+				MemoryBytes:  cfg.ProcessMemoryMB << 20,
+				CPUs:         cfg.ProcessCPUs,
+				OpenFiles:    cfg.ProcessOpenFiles,
+				CgroupParent: cfg.ProcessCgroupParent,
+			},
+		}, log)
+		if err != nil {
+			log.Fatal().Err(err).Msg("process runtime init")
+		}
+	default:
+		log.Fatal().Str("runtime", cfg.Runtime).Msg("unknown RUNTIME, want docker, kubernetes or process")
+	}
+
+	var bootPriority []devices.Selector
+	for _, raw := range cfg.BootPrioritySelectors {
+		sel, err := devices.ParseSelector(raw)
+		if err != nil {
+			log.Fatal().Err(err).Str("selector", raw).Msg("boot priority")
+		}
+		bootPriority = append(bootPriority, sel)
 	}
 
-	mgr, err := devices.New(db, nc, cfg.NATSURL, cfg.Adapters, dcli, traefikClient, log)
+	mgr, err := devices.New(db, nc, cfg.NATSURL, rt, traefikClient, log, devices.Options{
+		RequireImageContract:  cfg.RequireImageContract,
+		HostRuntime:           hostRuntime,
+		CrashLoopThreshold:    cfg.CrashLoopThreshold,
+		CrashLoopWindow:       cfg.CrashLoopWindow,
+		MaxRestartBackoff:     cfg.MaxRestartBackoff,
+		IsLeader:              elector.IsLeader,
+		BootParallelism:       cfg.BootParallelism,
+		BootDeviceTimeout:     cfg.BootDeviceTimeout,
+		BootPrioritySelectors: bootPriority,
+		BootPriorityTypes:     cfg.BootPriorityTypes,
+		EventPublishTimeout:   cfg.PublishTimeout,
+		WebhookClient:         &http.Client{Timeout: cfg.WebhookTimeout},
+		WebhookMaxAttempts:    cfg.WebhookMaxAttempts,
+		WebhookBackoff:        cfg.WebhookBackoff,
+		WebhookMaxBackoff:     cfg.WebhookMaxBackoff,
+	})
 	if err != nil {
 		log.Fatal().Err(err).Msg("manager init")
 	}
 
-	// --- ADD THIS BLOCK ---
-	// Restart any devices that were running before shutdown.
-	if err := mgr.RestartRunningDevices(context.Background()); err != nil {
-		log.Error().Err(err).Msg("error during device restart")
+	// ADAPTER_MAP_JSON only seeds the catalog; the database is authoritative.
+	seed := make([]devices.AdapterType, 0, len(cfg.Adapters))
+	for name, a := range cfg.Adapters {
+		seed = append(seed, devices.AdapterType{
+			Name:          name,
+			Image:         a.Image,
+			DefaultPort:   a.Port,
+			Protocol:      a.Protocol,
+			Description:   a.Description,
+			ConfigSchema:  devices.RawJSON(a.Schema),
+			RestartPolicy: devices.RestartPolicy(a.RestartPolicy),
+		})
+	}
+	if err := mgr.SeedAdapterTypes(context.Background(), seed); err != nil {
+		log.Fatal().Err(err).Msg("seed adapter types")
+	}
+
+	// Every replica records the lifecycle events it causes in the outbox,
+	// from which the leader forwards them to the events stream and queues
+	// their webhook deliveries.
+	var stream devices.EventStream
+	if cfg.EventsStream != "" {
+		if err := nc.EnsureEventStream(cfg.EventsStream, []string{devices.EventSubjects}, cfg.EventsMaxAge); err != nil {
+			log.Fatal().Err(err).Str("stream", cfg.EventsStream).Msg("events stream")
+		}
+		stream = nc
 	}
-	// ----------------------
 
 	handler := api.New(mgr, log)
 	srv := &http.Server{Addr: cfg.ListenAddr, Handler: handler}
+	// Shutdown waits for requests to finish, which event streams never do
+	// on their own.
+	srv.RegisterOnShutdown(mgr.CloseSubscriptions)
 
 	// graceful-shutdown
 	ctx, stop := signal.NotifyContext(
 		context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// Only the leader manages the adapter fleet. It keeps leading until its
+	// work has stopped, so the next leader never overlaps with it.
+	resignCtx, resign := context.WithCancel(context.Background())
+	resigned := make(chan struct{})
+	go func() {
+		defer close(resigned)
+		elector.Run(resignCtx, func(ctx context.Context) {
+			var wg sync.WaitGroup
+			wg.Add(4)
+			go func() {
+				defer wg.Done()
+				mgr.WatchEvents(ctx)
+			}()
+			go func() {
+				defer wg.Done()
+				mgr.RunOperations(ctx)
+			}()
+			go func() {
+				defer wg.Done()
+				mgr.RunWebhookDeliveries(ctx)
+			}()
+			go func() {
+				defer wg.Done()
+				mgr.RunEventOutbox(ctx, stream)
+			}()
+
+			// Restart any devices that were running before shutdown.
+			if err := mgr.RestartRunningDevices(ctx); err != nil {
+				log.Error().Err(err).Msg("error during device restart")
+			}
+			if cfg.ReconcileInterval > 0 {
+				mgr.RunReconciler(ctx, cfg.ReconcileInterval)
+			}
+			wg.Wait()
+
+			// Stop the adapters only when shutting down, not when leadership
+			// was lost to another replica. Detached adapters keep running
+			// and are adopted at the next start.
+			if resignCtx.Err() != nil && cfg.ShutdownPolicy == config.ShutdownStop {
+				if err := mgr.CleanupAdapters(context.Background()); err != nil {
+					log.Error().Err(err).Msg("error during adapter cleanup")
+				}
+			}
+		})
+	}()
+
 	go func() {
 		log.Info().Str("listen", cfg.ListenAddr).Msg("HTTP up")
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -87,12 +232,15 @@ func main() {
 
 	// --- Shutdown Logic ---
 	log.Info().Msg("shutting down server...")
-	_ = srv.Shutdown(context.Background())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("http shutdown")
+	}
+	cancel()
 
 	// --- Cleanup Logic ---
-	if err := mgr.CleanupAdapters(context.Background()); err != nil {
-		log.Error().Err(err).Msg("error during adapter cleanup")
-	}
+	resign()
+	<-resigned
 
 	log.Info().Msg("bye")
 }
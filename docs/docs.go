@@ -15,23 +15,31 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/devices": {
+        "/adapter-types": {
             "get": {
-                "description": "Retrieves a list of all device adapters from the database.",
+                "description": "Lists the supported device types. Deprecated types are hidden unless include_deprecated is set.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "devices"
+                    "adapter-types"
+                ],
+                "summary": "List adapter types",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Include deprecated types",
+                        "name": "include_deprecated",
+                        "in": "query"
+                    }
                 ],
-                "summary": "List all devices",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/devices.Device"
+                                "$ref": "#/definitions/devices.AdapterType"
                             }
                         }
                     },
@@ -44,7 +52,7 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Creates a new device adapter instance, runs its container, and returns the device details.",
+                "description": "Adds a device type to the adapter catalog.",
                 "consumes": [
                     "application/json"
                 ],
@@ -52,25 +60,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "devices"
+                    "adapter-types"
                 ],
-                "summary": "Add a new device",
+                "summary": "Add an adapter type",
                 "parameters": [
                     {
-                        "description": "Device Type",
-                        "name": "device",
+                        "description": "Adapter type",
+                        "name": "type",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/api.addDeviceRequest"
+                            "$ref": "#/definitions/api.adapterTypeRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/devices.Device"
+                            "$ref": "#/definitions/devices.AdapterType"
                         }
                     },
                     "400": {
@@ -79,6 +87,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -88,28 +102,123 @@ const docTemplate = `{
                 }
             }
         },
-        "/devices/{deviceID}": {
+        "/adapter-types/{type}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "adapter-types"
+                ],
+                "summary": "Get an adapter type",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device type",
+                        "name": "type",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.AdapterType"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
             "delete": {
-                "description": "Stops the device's container and removes its record from the database.",
+                "description": "Stops new devices from being created with this type. Existing devices keep running.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "devices"
+                    "adapter-types"
                 ],
-                "summary": "Remove a device",
+                "summary": "Deprecate an adapter type",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Device ID",
-                        "name": "deviceID",
+                        "description": "Device type",
+                        "name": "type",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content",
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.AdapterType"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Changes an adapter type. Existing devices keep the image they were created with.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "adapter-types"
+                ],
+                "summary": "Update an adapter type",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device type",
+                        "name": "type",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Fields to change",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.updateAdapterTypeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.AdapterType"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "type": "string"
                         }
@@ -128,65 +237,2827 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "api.addDeviceRequest": {
-            "type": "object",
-            "properties": {
-                "type": {
-                    "type": "string",
-                    "example": "random"
+        },
+        "/adapter-types/{type}/schema": {
+            "get": {
+                "description": "Returns the JSON Schema that per-device adapter config of this type must satisfy, so UIs can render forms: the schema set in the catalog, or else the one declared by the type's image labels. Devices moved to another image are validated against that image's schema instead.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "adapter-types"
+                ],
+                "summary": "Get adapter config schema",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device type",
+                        "name": "type",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
                 }
             }
         },
-        "devices.Device": {
-            "type": "object",
-            "properties": {
-                "container_id": {
-                    "type": "string",
-                    "example": "3518d34547496f2a8c4af44be3c71d7f..."
-                },
-                "container_name": {
-                    "type": "string",
-                    "example": "adapter-EDIVRWCLGGPGCW7M"
-                },
-                "container_url": {
-                    "type": "string",
-                    "example": "EDIVRWCLGGPGCW7M.localhost"
-                },
-                "created_at": {
-                    "type": "string"
-                },
-                "id": {
-                    "type": "string",
-                    "example": "EDIVRWCLGGPGCW7M"
-                },
-                "image": {
-                    "type": "string",
-                    "example": "registry.digitalocean.com/scadable-container-registry/adapter-mqtt:latest"
-                },
-                "mqtt_password": {
-                    "description": "The JSON tag is changed from \"-\" to \"mqtt_password,omitempty\" to expose it.",
-                    "type": "string",
-                    "example": "aBc12DeF34gH56iJ"
-                },
-                "mqtt_user": {
-                    "description": "MQTT credentials, only populated for 'mqtt' type devices.",
-                    "type": "string",
-                    "example": "EDIVRWCLGGPGCW7M"
-                },
-                "nats_subject": {
-                    "type": "string",
-                    "example": "devices.EDIVRWCLGGPGCW7M.telemetry"
-                },
-                "status": {
-                    "type": "string",
-                    "example": "running"
-                },
-                "type": {
-                    "type": "string",
-                    "example": "mqtt"
+        "/devices": {
+            "get": {
+                "description": "Retrieves a page of device adapters from the database. When more results exist, a Link header with rel=\"next\" points at the next page.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "List devices",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Opaque cursor from the previous page's Link header",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by device type",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by adapter image",
+                        "name": "image",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Label selector, e.g. env=prod,site in (a,b),!legacy",
+                        "name": "selector",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Case-insensitive search on the device name",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sort key (created_at, name, type, status); prefix with - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/devices.Device"
+                            }
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "Link to the next page"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a new device adapter instance, runs its container, and returns the device details.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "Add a new device",
+                "parameters": [
+                    {
+                        "description": "Device type and optional metadata",
+                        "name": "device",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.addDeviceRequest"
+                        }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Return 202 with an operation instead of waiting for the adapter",
+                        "name": "async",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Device"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Operation"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Config does not match the type's schema",
+                        "schema": {
+                            "$ref": "#/definitions/api.validationErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "No host can take the device",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/devices/events": {
+            "get": {
+                "description": "Streams the lifecycle events of devices (created, updated, started, stopped, died, deleted, ...) as Server-Sent Events as they happen. Each message has the event's sequence number as its id, the event type as its event name and the event, with a device snapshot, as JSON data. The events of every replica are sent, so a client can reconnect to any replica: reconnecting with Last-Event-ID (or last_event_id), it first gets the events it missed; if they are no longer known, a \"reset\" event tells it to reload its device list. A client that falls behind is disconnected and can resume the same way.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "Stream device events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only events of devices matching this label selector",
+                        "name": "selector",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Resume after this event sequence number, like the Last-Event-ID header",
+                        "name": "last_event_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Resume after this event sequence number",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Event"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/devices/{deviceID}": {
+            "get": {
+                "description": "Returns the stored device record merged with the live state of its container.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "Get a device",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.DeviceDetails"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Stops the device's container and marks the device as deleted. With purge=true the container, NATS stream, credentials, route and database record are removed permanently and a tombstone audit entry is recorded.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "Remove a device",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Permanently remove the device and its data",
+                        "name": "purge",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Return 202 with an operation instead of waiting",
+                        "name": "async",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Operation"
+                        }
+                    },
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Changes the name, description, labels, adapter image or adapter config of a device. Changing the image or config of a running device recreates its container, restoring the previous one if the new container fails to start; label changes reach the container's Docker labels the next time it is (re)created.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "Update a device",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Fields to change",
+                        "name": "device",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.updateDeviceRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Device"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Device has an operation in progress or changed meanwhile",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Config does not match the type's schema",
+                        "schema": {
+                            "$ref": "#/definitions/api.validationErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/devices/{deviceID}/config/revisions": {
+            "get": {
+                "description": "Returns every stored version of the device's adapter configuration, newest first.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "List config revisions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/devices.ConfigRevision"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/devices/{deviceID}/logs": {
+            "get": {
+                "description": "Returns the combined stdout and stderr of the device's adapter container as plain text. With follow=true the response stays open and streams new lines.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "Get device logs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of trailing lines (default: all)",
+                        "name": "tail",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only lines after this RFC 3339 timestamp",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Keep streaming new lines",
+                        "name": "follow",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Log output",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Device has no container",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/devices/{deviceID}/operations": {
+            "get": {
+                "description": "Returns the latest operations (create, start, stop, restart, delete, purge) of a device, newest first, with the progress of each step. Operations outlive purged devices.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "List device operations",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/devices.Operation"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/devices/{deviceID}/restart": {
+            "post": {
+                "description": "Recreates the adapter container of a running device.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "Restart a device",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Return 202 with an operation instead of waiting",
+                        "name": "async",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Device"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Operation"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/devices/{deviceID}/start": {
+            "post": {
+                "description": "Starts the adapter container of a stopped device, reusing its stored credentials and NATS stream.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "Start a device",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Return 202 with an operation instead of waiting",
+                        "name": "async",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Device"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Operation"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/devices/{deviceID}/stats": {
+            "get": {
+                "description": "Samples CPU, memory, network and process usage of the device's adapter container.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "Get device stats",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/runtime.Stats"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Device has no container",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "501": {
+                        "description": "Not supported by the runtime",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/devices/{deviceID}/stop": {
+            "post": {
+                "description": "Stops and removes the adapter container of a running device. The device can be started again later.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "Stop a device",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Return 202 with an operation instead of waiting",
+                        "name": "async",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Device"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Operation"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/hosts": {
+            "get": {
+                "description": "Lists the registered Docker hosts with the number of devices placed on each.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "hosts"
+                ],
+                "summary": "List hosts",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/devices.Host"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Adds a Docker engine to the pool new devices are scheduled on.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "hosts"
+                ],
+                "summary": "Register a host",
+                "parameters": [
+                    {
+                        "description": "Host",
+                        "name": "host",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.hostRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Host"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/hosts/{name}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "hosts"
+                ],
+                "summary": "Get a host",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Host name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Host"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Removes a host. Hosts that still have devices cannot be removed; cordon them and move the devices first.",
+                "tags": [
+                    "hosts"
+                ],
+                "summary": "Remove a host",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Host name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Changes a host's connection, capacity or labels, or cordons it. Devices already on the host stay there.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "hosts"
+                ],
+                "summary": "Update a host",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Host name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Fields to change",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.updateHostRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Host"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/operations/{operationID}": {
+            "get": {
+                "description": "Returns an operation with its current step, image pull progress and, once it succeeded, its result. With wait, blocks up to that many seconds (at most 60) until the operation is done.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "operations"
+                ],
+                "summary": "Get an operation",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Operation ID",
+                        "name": "operationID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Seconds to wait for the operation to finish",
+                        "name": "wait",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Operation"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/operations/{operationID}/cancel": {
+            "post": {
+                "description": "Requests cancellation of a running operation. It stops at its current step and undoes the completed ones, then ends as cancelled. Poll the operation to see when it has.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "operations"
+                ],
+                "summary": "Cancel an operation",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Operation ID",
+                        "name": "operationID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Operation"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Returns 204 once the API is up and its database is reachable, whether or not the adapter fleet has been restored yet.",
+                "tags": [
+                    "health"
+                ],
+                "summary": "API readiness",
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "503": {
+                        "description": "Database unreachable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz/fleet": {
+            "get": {
+                "description": "Returns the progress of restoring the adapters of running devices after service-io started or became leader: 200 once done, 503 while in progress. Only the leader replica restores the fleet; other replicas return 503 with an error.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Fleet readiness",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.BootReport"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/devices.BootReport"
+                        }
+                    }
+                }
+            }
+        },
+        "/reconcile": {
+            "get": {
+                "description": "Returns what the latest background reconcile pass on this replica found: repaired drift between the database, the adapter containers and the JetStream streams, plus orphaned containers and streams. Only the leader replica reconciles.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reconcile"
+                ],
+                "summary": "Get the last reconcile report",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.ReconcileReport"
+                        }
+                    },
+                    "404": {
+                        "description": "No reconcile has run yet",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Runs a reconcile pass immediately, waiting for any pass in progress, and returns its report. Only the leader replica reconciles.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reconcile"
+                ],
+                "summary": "Reconcile now",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.ReconcileReport"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Not the leader replica",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/upgrades": {
+            "post": {
+                "description": "Recreates the selected running devices on a new image digest, max_unavailable at a time. Each new container must stay up for health_wait_seconds; otherwise the device is rolled back to its previous digest and the rest of the rollout is skipped. Devices with an operation in progress are skipped.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "Upgrade devices",
+                "parameters": [
+                    {
+                        "description": "Devices to upgrade and target image",
+                        "name": "upgrade",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.upgradeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.UpgradeReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List webhooks",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/devices.Webhook"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Subscribes a URL to device lifecycle events, optionally limited to some event types and to devices matching a label selector. Each event is POSTed as the versioned event envelope, signed in the X-Webhook-Signature header as \"sha256=\" plus the hex HMAC-SHA256 of \"\u003cX-Webhook-Timestamp\u003e.\u003cbody\u003e\" keyed with the secret. The secret is only returned here.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Add a webhook",
+                "parameters": [
+                    {
+                        "description": "Webhook",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.webhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{webhookID}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Get a webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "webhookID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Webhook"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Removes a webhook together with its pending and dead deliveries.",
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Delete a webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "webhookID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Changes a webhook. Pending deliveries go to the new URL and are signed with the new secret.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Update a webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "webhookID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Fields to change",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.updateWebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/devices.Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{webhookID}/deliveries": {
+            "get": {
+                "description": "Returns the latest deliveries of a webhook, newest first. Use status=dead for the dead-letter list: deliveries that failed every attempt.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "webhookID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "pending, delivered or dead",
+                        "name": "status",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/devices.WebhookDelivery"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver": {
+            "post": {
+                "description": "Queues a delivery, typically a dead one, to be attempted again right away with a fresh retry budget.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Redeliver a webhook delivery",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "webhookID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Delivery ID",
+                        "name": "deliveryID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/devices.WebhookDelivery"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "api.adapterTypeRequest": {
+            "type": "object",
+            "properties": {
+                "config_schema": {
+                    "type": "object"
+                },
+                "default_port": {
+                    "type": "integer",
+                    "example": 1883
+                },
+                "description": {
+                    "type": "string",
+                    "example": "Modbus TCP poller"
+                },
+                "image": {
+                    "type": "string",
+                    "example": "registry.digitalocean.com/scadable-container-registry/adapter-modbus:latest"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "modbus"
+                },
+                "protocol": {
+                    "type": "string",
+                    "example": "mqtt"
+                },
+                "restart_policy": {
+                    "description": "RestartPolicy is always (default), on-failure or never.",
+                    "type": "string",
+                    "example": "on-failure"
+                }
+            }
+        },
+        "api.addDeviceRequest": {
+            "type": "object",
+            "properties": {
+                "config": {
+                    "type": "object",
+                    "additionalProperties": {}
+                },
+                "description": {
+                    "type": "string",
+                    "example": "Modbus PLC in the boiler room"
+                },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string",
+                    "example": "boiler-room-plc-3"
+                },
+                "placement": {
+                    "description": "Placement is a label selector over host labels, e.g. \"site=plant-a\".",
+                    "type": "string",
+                    "example": "site=plant-a"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "random"
+                }
+            }
+        },
+        "api.hostRequest": {
+            "type": "object",
+            "properties": {
+                "capacity": {
+                    "type": "integer",
+                    "example": 50
+                },
+                "endpoint": {
+                    "type": "string",
+                    "example": "tcp://10.0.0.5:2376"
+                },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string",
+                    "example": "edge-1"
+                },
+                "tls_ca_cert": {
+                    "type": "string",
+                    "example": "/etc/service-io/hosts/edge-1/ca.pem"
+                },
+                "tls_cert": {
+                    "type": "string",
+                    "example": "/etc/service-io/hosts/edge-1/cert.pem"
+                },
+                "tls_key": {
+                    "type": "string",
+                    "example": "/etc/service-io/hosts/edge-1/key.pem"
+                }
+            }
+        },
+        "api.updateAdapterTypeRequest": {
+            "type": "object",
+            "properties": {
+                "config_schema": {
+                    "type": "object"
+                },
+                "default_port": {
+                    "type": "integer",
+                    "example": 1883
+                },
+                "deprecated": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "description": {
+                    "type": "string",
+                    "example": "Modbus TCP poller"
+                },
+                "image": {
+                    "type": "string",
+                    "example": "registry.digitalocean.com/scadable-container-registry/adapter-modbus:v2"
+                },
+                "protocol": {
+                    "type": "string",
+                    "example": "mqtt"
+                },
+                "restart_policy": {
+                    "type": "string",
+                    "example": "on-failure"
+                }
+            }
+        },
+        "api.updateDeviceRequest": {
+            "type": "object",
+            "properties": {
+                "config": {
+                    "description": "Config replaces the whole adapter configuration.",
+                    "type": "object",
+                    "additionalProperties": {}
+                },
+                "description": {
+                    "type": "string",
+                    "example": "Modbus PLC in the boiler room"
+                },
+                "image": {
+                    "type": "string",
+                    "example": "registry.digitalocean.com/scadable-container-registry/adapter-mqtt:latest"
+                },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string",
+                    "example": "boiler-room-plc-3"
+                }
+            }
+        },
+        "api.updateHostRequest": {
+            "type": "object",
+            "properties": {
+                "capacity": {
+                    "type": "integer",
+                    "example": 50
+                },
+                "cordoned": {
+                    "description": "Cordoned stops new devices from being scheduled on the host.",
+                    "type": "boolean",
+                    "example": false
+                },
+                "endpoint": {
+                    "type": "string",
+                    "example": "tcp://10.0.0.5:2376"
+                },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "tls_ca_cert": {
+                    "type": "string"
+                },
+                "tls_cert": {
+                    "type": "string"
+                },
+                "tls_key": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.updateWebhookRequest": {
+            "type": "object",
+            "properties": {
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "died",
+                        "deleted"
+                    ]
+                },
+                "secret": {
+                    "type": "string",
+                    "example": "n3w-s3cr3t"
+                },
+                "selector": {
+                    "type": "string",
+                    "example": "site=plant-1"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/devices"
+                }
+            }
+        },
+        "api.upgradeRequest": {
+            "type": "object",
+            "properties": {
+                "device_id": {
+                    "type": "string",
+                    "example": "EDIVRWCLGGPGCW7M"
+                },
+                "health_wait_seconds": {
+                    "type": "integer",
+                    "example": 10
+                },
+                "image": {
+                    "type": "string",
+                    "example": "registry.digitalocean.com/scadable-container-registry/adapter-mqtt:v2"
+                },
+                "max_unavailable": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "selector": {
+                    "type": "string",
+                    "example": "site in (plant-a)"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "mqtt"
+                }
+            }
+        },
+        "api.validationErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "fields": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/devices.FieldError"
+                    }
+                }
+            }
+        },
+        "api.webhookRequest": {
+            "type": "object",
+            "properties": {
+                "events": {
+                    "description": "Events are the event types to deliver; empty means all of them.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "died",
+                        "deleted"
+                    ]
+                },
+                "secret": {
+                    "description": "Secret keys the signatures; one is generated if omitted.",
+                    "type": "string",
+                    "example": "s3cr3t"
+                },
+                "selector": {
+                    "type": "string",
+                    "example": "site=plant-1"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/devices"
+                }
+            }
+        },
+        "devices.AdapterType": {
+            "type": "object",
+            "properties": {
+                "config_schema": {
+                    "description": "ConfigSchema is an optional JSON Schema for per-device adapter config.",
+                    "type": "object"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "default_port": {
+                    "type": "integer",
+                    "example": 1883
+                },
+                "deprecated": {
+                    "type": "boolean"
+                },
+                "deprecated_at": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string",
+                    "example": "Generic MQTT bridge"
+                },
+                "image": {
+                    "type": "string",
+                    "example": "registry.digitalocean.com/scadable-container-registry/adapter-mqtt:latest"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "mqtt"
+                },
+                "protocol": {
+                    "type": "string",
+                    "example": "mqtt"
+                },
+                "restart_policy": {
+                    "description": "RestartPolicy applies to all devices of the type.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/devices.RestartPolicy"
+                        }
+                    ],
+                    "example": "always"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "devices.BootFailure": {
+            "type": "object",
+            "properties": {
+                "device_id": {
+                    "type": "string",
+                    "example": "EDIVRWCLGGPGCW7M"
+                },
+                "error": {
+                    "type": "string",
+                    "example": "context deadline exceeded"
+                }
+            }
+        },
+        "devices.BootReport": {
+            "type": "object",
+            "properties": {
+                "adopted": {
+                    "description": "Adopted devices kept the adapter instance they already had.",
+                    "type": "integer",
+                    "example": 80
+                },
+                "done": {
+                    "type": "integer",
+                    "example": 87
+                },
+                "failed": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "failures": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/devices.BootFailure"
+                    }
+                },
+                "finished_at": {
+                    "description": "FinishedAt is set once every device has been restored or given up on.",
+                    "type": "string"
+                },
+                "restarted": {
+                    "type": "integer",
+                    "example": 5
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 120
+                }
+            }
+        },
+        "devices.ConfigRevision": {
+            "type": "object",
+            "properties": {
+                "config": {
+                    "type": "object"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "device_id": {
+                    "type": "string",
+                    "example": "EDIVRWCLGGPGCW7M"
+                },
+                "version": {
+                    "type": "integer",
+                    "example": 2
+                }
+            }
+        },
+        "devices.Device": {
+            "type": "object",
+            "properties": {
+                "config": {
+                    "description": "Adapter configuration delivered to the container; the version is\nbumped on every change.",
+                    "type": "object"
+                },
+                "config_version": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "container_id": {
+                    "type": "string",
+                    "example": "3518d34547496f2a8c4af44be3c71d7f..."
+                },
+                "container_name": {
+                    "type": "string",
+                    "example": "adapter-EDIVRWCLGGPGCW7M"
+                },
+                "container_url": {
+                    "type": "string",
+                    "example": "EDIVRWCLGGPGCW7M.localhost"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string",
+                    "example": "Modbus PLC in the boiler room"
+                },
+                "exit_code": {
+                    "description": "Last observed state of the adapter container, kept up to date from\nruntime events.",
+                    "type": "integer",
+                    "example": 0
+                },
+                "health": {
+                    "type": "string",
+                    "example": "healthy"
+                },
+                "host": {
+                    "description": "Host is the engine the adapter was scheduled on; empty for the default\nruntime. Placement is the host selector it was scheduled with.",
+                    "type": "string",
+                    "example": "edge-1"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "EDIVRWCLGGPGCW7M"
+                },
+                "image": {
+                    "type": "string",
+                    "example": "registry.digitalocean.com/scadable-container-registry/adapter-mqtt:latest"
+                },
+                "image_digest": {
+                    "type": "string",
+                    "example": "registry.digitalocean.com/scadable-container-registry/adapter-mqtt@sha256:9b2c..."
+                },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    },
+                    "example": {
+                        "site": "plant-a"
+                    }
+                },
+                "last_error": {
+                    "type": "string",
+                    "example": "exited with code 1"
+                },
+                "log_tail": {
+                    "description": "LogTail holds the last lines the container logged before it exited.",
+                    "type": "string",
+                    "example": "panic: dial tcp 10.0.0.7:502: connection refused"
+                },
+                "mqtt_password": {
+                    "description": "The JSON tag is changed from \"-\" to \"mqtt_password,omitempty\" to expose it.",
+                    "type": "string",
+                    "example": "aBc12DeF34gH56iJ"
+                },
+                "mqtt_user": {
+                    "description": "MQTT credentials, only populated for 'mqtt' type devices.",
+                    "type": "string",
+                    "example": "EDIVRWCLGGPGCW7M"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "boiler-room-plc-3"
+                },
+                "nats_subject": {
+                    "type": "string",
+                    "example": "devices.EDIVRWCLGGPGCW7M.telemetry"
+                },
+                "placement": {
+                    "type": "string",
+                    "example": "site=plant-a"
+                },
+                "restart_count": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "status": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/devices.Status"
+                        }
+                    ],
+                    "example": "running"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "mqtt"
+                }
+            }
+        },
+        "devices.DeviceDetails": {
+            "type": "object",
+            "properties": {
+                "config": {
+                    "description": "Adapter configuration delivered to the container; the version is\nbumped on every change.",
+                    "type": "object"
+                },
+                "config_version": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "container": {
+                    "description": "Container is nil when no container exists for the device.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/runtime.State"
+                        }
+                    ]
+                },
+                "container_id": {
+                    "type": "string",
+                    "example": "3518d34547496f2a8c4af44be3c71d7f..."
+                },
+                "container_name": {
+                    "type": "string",
+                    "example": "adapter-EDIVRWCLGGPGCW7M"
+                },
+                "container_url": {
+                    "type": "string",
+                    "example": "EDIVRWCLGGPGCW7M.localhost"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string",
+                    "example": "Modbus PLC in the boiler room"
+                },
+                "exit_code": {
+                    "description": "Last observed state of the adapter container, kept up to date from\nruntime events.",
+                    "type": "integer",
+                    "example": 0
+                },
+                "health": {
+                    "type": "string",
+                    "example": "healthy"
+                },
+                "host": {
+                    "description": "Host is the engine the adapter was scheduled on; empty for the default\nruntime. Placement is the host selector it was scheduled with.",
+                    "type": "string",
+                    "example": "edge-1"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "EDIVRWCLGGPGCW7M"
+                },
+                "image": {
+                    "type": "string",
+                    "example": "registry.digitalocean.com/scadable-container-registry/adapter-mqtt:latest"
+                },
+                "image_digest": {
+                    "type": "string",
+                    "example": "registry.digitalocean.com/scadable-container-registry/adapter-mqtt@sha256:9b2c..."
+                },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    },
+                    "example": {
+                        "site": "plant-a"
+                    }
+                },
+                "last_error": {
+                    "type": "string",
+                    "example": "exited with code 1"
+                },
+                "log_tail": {
+                    "description": "LogTail holds the last lines the container logged before it exited.",
+                    "type": "string",
+                    "example": "panic: dial tcp 10.0.0.7:502: connection refused"
+                },
+                "mqtt_password": {
+                    "description": "The JSON tag is changed from \"-\" to \"mqtt_password,omitempty\" to expose it.",
+                    "type": "string",
+                    "example": "aBc12DeF34gH56iJ"
+                },
+                "mqtt_user": {
+                    "description": "MQTT credentials, only populated for 'mqtt' type devices.",
+                    "type": "string",
+                    "example": "EDIVRWCLGGPGCW7M"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "boiler-room-plc-3"
+                },
+                "nats_subject": {
+                    "type": "string",
+                    "example": "devices.EDIVRWCLGGPGCW7M.telemetry"
+                },
+                "placement": {
+                    "type": "string",
+                    "example": "site=plant-a"
+                },
+                "restart_count": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "status": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/devices.Status"
+                        }
+                    ],
+                    "example": "running"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "mqtt"
+                }
+            }
+        },
+        "devices.Event": {
+            "type": "object",
+            "properties": {
+                "actor": {
+                    "description": "Actor is who caused the event: an API client, or ActorSystem.",
+                    "type": "string",
+                    "example": "service-io"
+                },
+                "device": {
+                    "description": "Device is the device as the event left it, without its MQTT password.\nIt is missing if the device could not be read.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/devices.Device"
+                        }
+                    ]
+                },
+                "device_id": {
+                    "type": "string",
+                    "example": "EDIVRWCLGGPGCW7M"
+                },
+                "error": {
+                    "type": "string",
+                    "example": "out of memory"
+                },
+                "exit_code": {
+                    "type": "integer",
+                    "example": 137
+                },
+                "health": {
+                    "type": "string",
+                    "example": "unhealthy"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "VQ3M7XKD2HNB5RJT"
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "restart policy always"
+                },
+                "seq": {
+                    "description": "Seq orders the events of all replicas. It is only set on events sent\nto subscribers.",
+                    "type": "integer",
+                    "example": 4242
+                },
+                "status": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/devices.Status"
+                        }
+                    ],
+                    "example": "exited"
+                },
+                "time": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "died"
+                }
+            }
+        },
+        "devices.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "description": "Field is a JSON pointer into the config, e.g. \"/pollInterval\".",
+                    "type": "string",
+                    "example": "/pollInterval"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "must be \u003e= 1 but found 0"
+                }
+            }
+        },
+        "devices.Host": {
+            "type": "object",
+            "properties": {
+                "capacity": {
+                    "description": "Capacity is the maximum number of adapters on the host; 0 is unlimited.",
+                    "type": "integer",
+                    "example": 50
+                },
+                "cordoned": {
+                    "description": "Cordoned hosts keep their adapters but receive no new devices.",
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "devices": {
+                    "description": "Devices is the number of devices on the host that are being created or\nare meant to run, including exited and crashlooping ones.",
+                    "type": "integer",
+                    "example": 12
+                },
+                "endpoint": {
+                    "description": "Endpoint is a Docker daemon address: tcp://host:2376 or ssh://user@host.",
+                    "type": "string",
+                    "example": "tcp://10.0.0.5:2376"
+                },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    },
+                    "example": {
+                        "site": "plant-a"
+                    }
+                },
+                "name": {
+                    "type": "string",
+                    "example": "edge-1"
+                },
+                "tls_ca_cert": {
+                    "description": "Paths of the client TLS material for tcp:// endpoints.",
+                    "type": "string",
+                    "example": "/etc/service-io/hosts/edge-1/ca.pem"
+                },
+                "tls_cert": {
+                    "type": "string",
+                    "example": "/etc/service-io/hosts/edge-1/cert.pem"
+                },
+                "tls_key": {
+                    "type": "string",
+                    "example": "/etc/service-io/hosts/edge-1/key.pem"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "devices.ImagePullProgress": {
+            "type": "object",
+            "properties": {
+                "current_bytes": {
+                    "description": "Current and Total are bytes downloaded so far and the size of the\nlayers whose size is known yet.",
+                    "type": "integer",
+                    "example": 31457280
+                },
+                "image": {
+                    "type": "string",
+                    "example": "registry.digitalocean.com/scadable-container-registry/adapter-mqtt:latest"
+                },
+                "layers": {
+                    "type": "integer",
+                    "example": 6
+                },
+                "layers_done": {
+                    "type": "integer",
+                    "example": 4
+                },
+                "status": {
+                    "description": "Status is the latest status line of the pull, e.g. \"Downloading\".",
+                    "type": "string",
+                    "example": "Downloading"
+                },
+                "total_bytes": {
+                    "type": "integer",
+                    "example": 52428800
+                }
+            }
+        },
+        "devices.Operation": {
+            "type": "object",
+            "properties": {
+                "actor": {
+                    "description": "Actor is who requested the operation; its events are published on\ntheir behalf.",
+                    "type": "string",
+                    "example": "api"
+                },
+                "cancel_requested": {
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "current_step": {
+                    "description": "CurrentStep names the step being run or compensated.",
+                    "type": "string",
+                    "example": "pull_image"
+                },
+                "device_id": {
+                    "description": "A device has at most one unfinished operation.",
+                    "type": "string",
+                    "example": "EDIVRWCLGGPGCW7M"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "K7Q2M9XW4TBN8CPL"
+                },
+                "kind": {
+                    "type": "string",
+                    "example": "create"
+                },
+                "progress": {
+                    "description": "Progress is the latest image pull progress, if the operation pulled.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/devices.ImagePullProgress"
+                        }
+                    ]
+                },
+                "result": {
+                    "description": "Result is the device as the operation left it, once it succeeded.",
+                    "type": "object"
+                },
+                "status": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/devices.OperationStatus"
+                        }
+                    ],
+                    "example": "running"
+                },
+                "steps": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/devices.OperationStep"
+                    }
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "devices.OperationStatus": {
+            "type": "string",
+            "enum": [
+                "running",
+                "compensating",
+                "succeeded",
+                "failed",
+                "cancelled"
+            ],
+            "x-enum-varnames": [
+                "OperationRunning",
+                "OperationCompensating",
+                "OperationSucceeded",
+                "OperationFailed",
+                "OperationCancelled"
+            ]
+        },
+        "devices.OperationStep": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "start_adapter"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "done"
+                }
+            }
+        },
+        "devices.OrphanContainer": {
+            "type": "object",
+            "properties": {
+                "device_id": {
+                    "type": "string",
+                    "example": "EDIVRWCLGGPGCW7M"
+                },
+                "host": {
+                    "type": "string",
+                    "example": "edge-1"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "3518d34547496f2a8c4af44be3c71d7f..."
+                },
+                "name": {
+                    "type": "string",
+                    "example": "adapter-EDIVRWCLGGPGCW7M"
+                }
+            }
+        },
+        "devices.ReconcileReport": {
+            "type": "object",
+            "properties": {
+                "checked": {
+                    "description": "Checked is the number of devices compared against their containers\nand streams.",
+                    "type": "integer",
+                    "example": 42
+                },
+                "errors": {
+                    "description": "Errors lists checks that could not be done, e.g. for an unreachable host.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "orphan_containers": {
+                    "description": "Orphans are adapter containers and DEV_* streams that belong to no\ndevice. They are reported, never removed.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/devices.OrphanContainer"
+                    }
+                },
+                "orphan_streams": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "DEV_EDIVRWCLGGPGCW7M"
+                    ]
+                },
+                "repairs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/devices.Repair"
+                    }
+                },
+                "started_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "devices.Repair": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string",
+                    "example": "recreated"
+                },
+                "device_id": {
+                    "type": "string",
+                    "example": "EDIVRWCLGGPGCW7M"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "container missing"
+                }
+            }
+        },
+        "devices.RestartPolicy": {
+            "type": "string",
+            "enum": [
+                "always",
+                "on-failure",
+                "never"
+            ],
+            "x-enum-comments": {
+                "RestartOnFailure": "only after a non-zero exit code"
+            },
+            "x-enum-descriptions": [
+                "",
+                "only after a non-zero exit code",
+                ""
+            ],
+            "x-enum-varnames": [
+                "RestartAlways",
+                "RestartOnFailure",
+                "RestartNever"
+            ]
+        },
+        "devices.Status": {
+            "type": "string",
+            "enum": [
+                "pending",
+                "running",
+                "exited",
+                "crashlooping",
+                "stopped",
+                "failed",
+                "deleted"
+            ],
+            "x-enum-varnames": [
+                "StatusPending",
+                "StatusRunning",
+                "StatusExited",
+                "StatusCrashLooping",
+                "StatusStopped",
+                "StatusFailed",
+                "StatusDeleted"
+            ]
+        },
+        "devices.UpgradeReport": {
+            "type": "object",
+            "properties": {
+                "aborted": {
+                    "description": "Aborted is set when a failure stopped the rollout before all\nselected devices were processed.",
+                    "type": "boolean"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/devices.UpgradeResult"
+                    }
+                }
+            }
+        },
+        "devices.UpgradeResult": {
+            "type": "object",
+            "properties": {
+                "device_id": {
+                    "type": "string",
+                    "example": "EDIVRWCLGGPGCW7M"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "from_digest": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "upgraded"
+                },
+                "to_digest": {
+                    "type": "string"
+                }
+            }
+        },
+        "devices.Webhook": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "events": {
+                    "description": "Events are the event types delivered; empty means all of them.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "died",
+                        "deleted"
+                    ]
+                },
+                "id": {
+                    "type": "string",
+                    "example": "W3BHK7Q2M9XW4TBN"
+                },
+                "secret": {
+                    "description": "Secret keys the delivery signatures. It is only returned when the\nwebhook is created.",
+                    "type": "string",
+                    "example": "s3cr3t"
+                },
+                "selector": {
+                    "description": "Selector limits deliveries to devices whose labels match it.",
+                    "type": "string",
+                    "example": "site=plant-1"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/devices"
+                }
+            }
+        },
+        "devices.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "delivered_at": {
+                    "type": "string"
+                },
+                "device_id": {
+                    "type": "string",
+                    "example": "EDIVRWCLGGPGCW7M"
+                },
+                "event_id": {
+                    "type": "string",
+                    "example": "VQ3M7XKD2HNB5RJT"
+                },
+                "event_type": {
+                    "type": "string",
+                    "example": "died"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "D8CPLK7Q2M9XW4TB"
+                },
+                "last_error": {
+                    "type": "string",
+                    "example": "status 503: upstream unavailable"
+                },
+                "last_status": {
+                    "type": "integer",
+                    "example": 503
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "payload": {
+                    "description": "Payload is the EventEnvelope posted to the webhook.",
+                    "type": "object"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "pending"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "webhook_id": {
+                    "type": "string",
+                    "example": "W3BHK7Q2M9XW4TBN"
+                }
+            }
+        },
+        "runtime.State": {
+            "type": "object",
+            "properties": {
+                "exit_code": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "restart_count": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "running": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "running"
+                }
+            }
+        },
+        "runtime.Stats": {
+            "type": "object",
+            "properties": {
+                "cpu_percent": {
+                    "type": "number",
+                    "example": 1.5
+                },
+                "memory_bytes": {
+                    "type": "integer",
+                    "example": 10485760
+                },
+                "memory_limit_bytes": {
+                    "type": "integer",
+                    "example": 536870912
+                },
+                "net_rx_bytes": {
+                    "type": "integer",
+                    "example": 2048
+                },
+                "net_tx_bytes": {
+                    "type": "integer",
+                    "example": 4096
+                },
+                "pids": {
+                    "type": "integer",
+                    "example": 4
+                },
+                "time": {
+                    "type": "string"
                 }
             }
         }
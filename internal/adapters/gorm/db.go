@@ -29,8 +29,19 @@ func New(dsn string, lg zerolog.Logger) (*gorm.DB, error) {
 		return nil, fmt.Errorf("gorm open: %w", err)
 	}
 
-	// AutoMigrate will create the 'devices' table based on the struct definition.
-	if err := db.AutoMigrate(&devices.Device{}); err != nil {
+	// AutoMigrate will create the tables based on the struct definitions.
+	if err := db.AutoMigrate(
+		&devices.Device{},
+		&devices.AuditEntry{},
+		&devices.ConfigRevision{},
+		&devices.AdapterType{},
+		&devices.Host{},
+		&devices.Operation{},
+		&devices.Webhook{},
+		&devices.WebhookDelivery{},
+		&devices.ExpectedExit{},
+		&devices.OutboxEvent{},
+	); err != nil {
 		return nil, fmt.Errorf("gorm migrate: %w", err)
 	}
 	lg.Info().Msg("database migration successful")
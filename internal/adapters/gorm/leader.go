@@ -0,0 +1,137 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+const (
+	// campaignEvery is how often a follower tries to become leader.
+	campaignEvery = 5 * time.Second
+	// checkLeaseEvery is how often the leader checks that its lock
+	// connection is still alive.
+	checkLeaseEvery = 5 * time.Second
+)
+
+// Elector elects one leader among the replicas sharing a database. The
+// leader holds a session-level Postgres advisory lock on a dedicated
+// connection, so the lock is released as soon as Postgres notices a crashed
+// leader's connection is gone.
+type Elector struct {
+	db     *sql.DB
+	key    int64
+	lg     zerolog.Logger
+	leader atomic.Bool
+}
+
+// NewElector returns an elector for the named role. Replicas campaigning
+// for the same name compete for the same lock.
+func NewElector(db *gorm.DB, name string, lg zerolog.Logger) (*Elector, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("elector: %w", err)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return &Elector{
+		db:  sqlDB,
+		key: int64(h.Sum64()),
+		lg:  lg.With().Str("component", "elector").Str("role", name).Logger(),
+	}, nil
+}
+
+// IsLeader reports whether this replica currently leads.
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run campaigns until ctx is done. Whenever this replica becomes leader,
+// lead is called with a context that is cancelled when leadership is lost
+// or ctx is done. The lock is held until lead returns, so lead can finish
+// its work before another replica takes over.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	for {
+		if conn := e.acquire(ctx); conn != nil {
+			e.hold(ctx, conn, lead)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(campaignEvery):
+		}
+	}
+}
+
+// acquire tries to take the lock and returns the connection holding it, or
+// nil if another replica leads.
+func (e *Elector) acquire(ctx context.Context) *sql.Conn {
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			e.lg.Warn().Err(err).Msg("failed to get a connection to campaign with")
+		}
+		return nil
+	}
+	var got bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", e.key).Scan(&got)
+	if err != nil || !got {
+		if err != nil && ctx.Err() == nil {
+			e.lg.Warn().Err(err).Msg("failed to campaign for leadership")
+		}
+		_ = conn.Close()
+		return nil
+	}
+	return conn
+}
+
+// hold runs lead while the lock connection stays alive, then releases the
+// lock.
+func (e *Elector) hold(ctx context.Context, conn *sql.Conn, lead func(ctx context.Context)) {
+	e.leader.Store(true)
+	e.lg.Info().Msg("became leader")
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+
+	t := time.NewTicker(checkLeaseEvery)
+	defer t.Stop()
+watch:
+	for {
+		select {
+		case <-leadCtx.Done():
+			break watch
+		case <-done:
+			break watch
+		case <-t.C:
+			if _, err := conn.ExecContext(ctx, "SELECT 1"); err != nil {
+				e.lg.Error().Err(err).Msg("lost the leader lock connection, stepping down")
+				break watch
+			}
+		}
+	}
+	cancel()
+	<-done
+
+	e.leader.Store(false)
+	// The session, and with it the lock, must not go back to the pool.
+	unlockCtx, cancelUnlock := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelUnlock()
+	if _, err := conn.ExecContext(unlockCtx, "SELECT pg_advisory_unlock($1)", e.key); err != nil {
+		e.lg.Warn().Err(err).Msg("failed to release the leader lock")
+	}
+	_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	_ = conn.Close()
+	e.lg.Info().Msg("stepped down as leader")
+}
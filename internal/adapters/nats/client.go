@@ -1,7 +1,9 @@
 package nats
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	natsgo "github.com/nats-io/nats.go"
 	"github.com/rs/zerolog"
@@ -58,6 +60,48 @@ func (c *Client) DeleteStream(name string) error {
 	return nil
 }
 
+// StreamNames lists the names of all streams in the account.
+func (c *Client) StreamNames() ([]string, error) {
+	// The listing channel swallows errors, so check JetStream is reachable first.
+	if _, err := c.js.AccountInfo(); err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range c.js.StreamNames() {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// -------- Lifecycle events --------
+
+// EnsureEventStream idempotently creates the stream lifecycle events are
+// kept in, and updates its subjects and retention if it exists. A zero
+// maxAge keeps events forever.
+func (c *Client) EnsureEventStream(name string, subjects []string, maxAge time.Duration) error {
+	cfg := &natsgo.StreamConfig{
+		Name:       name,
+		Subjects:   subjects,
+		Storage:    natsgo.FileStorage,
+		Replicas:   1,
+		MaxAge:     maxAge,
+		Duplicates: 2 * time.Minute,
+	}
+	_, err := c.js.AddStream(cfg)
+	if err == natsgo.ErrStreamNameAlreadyInUse {
+		_, err = c.js.UpdateStream(cfg)
+	}
+	return err
+}
+
+// Publish publishes data on subject and waits for JetStream to store it.
+// Messages with the same msgID are stored once within the stream's
+// duplicate window.
+func (c *Client) Publish(ctx context.Context, subject, msgID string, data []byte) error {
+	_, err := c.js.Publish(subject, data, natsgo.MsgId(msgID), natsgo.Context(ctx))
+	return err
+}
+
 // -------- Key-value bucket (device registry) --------
 
 func (c *Client) EnsureBucket(name string) (KeyValue, error) {
@@ -3,6 +3,10 @@ package traefik
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+
+	"service-io/internal/core/runtime"
 
 	"github.com/rs/zerolog"
 )
@@ -32,63 +36,87 @@ func New(cfg Config) *Client {
 	}
 }
 
-// GenerateConfigForContainer creates Docker labels for routing to an adapter.
-// It dynamically switches between secure (TLS) and insecure (TCP) configs.
-func (c *Client) GenerateConfigForContainer(containerName, deviceID, containerPort string) (labels map[string]string, url string) {
+// RouteForDevice describes how clients reach a device's adapter through
+// Traefik and returns the public URL. It dynamically switches between secure
+// (TLS) and insecure (TCP) routes. With tlsPassthrough set, Traefik routes on
+// SNI but leaves TLS to the adapter.
+func (c *Client) RouteForDevice(deviceID string, containerPort int, tlsPassthrough bool) (route *runtime.Route, url string) {
 	if c.baseDomain != "localhost" {
 		host := fmt.Sprintf("%s.%s", deviceID, c.baseDomain)
 		// ✅ FIX: The public URL must point to Traefik's public MQTTS port (8883).
 		url = fmt.Sprintf("mqtts://%s:8883", host)
 
-		labels = map[string]string{
-			"traefik.enable": "true",
-
-			// TCP Router with TLS enabled
-			fmt.Sprintf("traefik.tcp.routers.%s.rule", containerName): fmt.Sprintf("HostSNI(`%s`)", host),
+		route = &runtime.Route{
+			Host: host,
 			// ✅ FIX: The secure router MUST only listen on the secure 'mqtts' entrypoint.
-			fmt.Sprintf("traefik.tcp.routers.%s.entrypoints", containerName):      "mqtts",
-			fmt.Sprintf("traefik.tcp.routers.%s.tls", containerName):              "true",
-			fmt.Sprintf("traefik.tcp.routers.%s.tls.certresolver", containerName): c.certResolver,
+			EntryPoint: "mqtts",
+			Port:       containerPort,
+			TLS:        true,
+		}
+		if tlsPassthrough {
+			// The adapter presents its own certificate, so Traefik must not
+			// terminate TLS or request one for this router.
+			route.Passthrough = true
+		} else {
+			route.CertResolver = c.certResolver
 			// This assumes you have a TLS option named 'mqtt' defined in your traefik_mqtt.yaml.
-			fmt.Sprintf("traefik.tcp.routers.%s.tls.options", containerName): "mqtt-only@file",
-			fmt.Sprintf("traefik.tcp.routers.%s.service", containerName):     containerName,
-
-			// TCP Service
-			fmt.Sprintf("traefik.tcp.services.%s.loadbalancer.server.port", containerName): containerPort,
-
-			// Network
-			"traefik.docker.network": c.network,
-
+			route.TLSOptions = "mqtt-only@file"
 			// Wildcard certificate configuration (this part is good)
-			fmt.Sprintf("traefik.tcp.routers.%s.tls.domains[0].main", containerName): fmt.Sprintf("*.%s", c.baseDomain),
-			fmt.Sprintf("traefik.tcp.routers.%s.tls.domains[0].sans", containerName): c.baseDomain,
+			route.Domains = []string{"*." + c.baseDomain, c.baseDomain}
 		}
 
-		c.lg.Info().
+		c.lg.Debug().
 			Str("mode", "production").
 			Str("host", host).
-			Msg("generated secure TLS routing labels")
-		return labels, url
+			Bool("tls_passthrough", tlsPassthrough).
+			Msg("generated secure TLS route")
+		return route, url
 	}
 
 	// --- Local Development Config (using localhost) ---
 	// ✅ FIX: The client connects to Traefik's 'mqtt' port, not the container's port.
 	url = fmt.Sprintf("mqtt://localhost:1883")
 
-	labels = map[string]string{
+	// ✅ FIX: Plain TCP has no SNI. An empty host matches all traffic on the entrypoint.
+	route = &runtime.Route{EntryPoint: "mqtt", Port: containerPort}
+	c.lg.Debug().Str("mode", "local").Msg("generated insecure TCP route")
+	return route, url
+}
+
+// DockerLabels renders a route as labels for Traefik's Docker provider, with
+// a router and service named after the container.
+func (c *Client) DockerLabels(containerName string, route *runtime.Route) map[string]string {
+	router := func(k string) string { return fmt.Sprintf("traefik.tcp.routers.%s.%s", containerName, k) }
+
+	labels := map[string]string{
 		"traefik.enable": "true",
-		// TCP Router with no TLS
-		// ✅ FIX: Plain TCP has no SNI. Use HostSNI(`*`) to catch all traffic on the entrypoint.
-		fmt.Sprintf("traefik.tcp.routers.%s.rule", containerName):        "HostSNI(`*`)",
-		fmt.Sprintf("traefik.tcp.routers.%s.entrypoints", containerName): "mqtt",
-		fmt.Sprintf("traefik.tcp.routers.%s.service", containerName):     containerName,
+
+		// TCP Router
+		router("rule"):        route.Rule(),
+		router("entrypoints"): route.EntryPoint,
+		router("service"):     containerName,
 
 		// TCP Service
-		fmt.Sprintf("traefik.tcp.services.%s.loadbalancer.server.port", containerName): containerPort,
+		fmt.Sprintf("traefik.tcp.services.%s.loadbalancer.server.port", containerName): strconv.Itoa(route.Port),
 
 		// Network
 		"traefik.docker.network": c.network,
 	}
-	c.lg.Info().Str("mode", "local").Msg("generated insecure TCP routing labels")
-	return labels, url
+	if route.TLS {
+		labels[router("tls")] = "true"
+	}
+	if route.Passthrough {
+		labels[router("tls.passthrough")] = "true"
+	}
+	if route.CertResolver != "" {
+		labels[router("tls.certresolver")] = route.CertResolver
+	}
+	if route.TLSOptions != "" {
+		labels[router("tls.options")] = route.TLSOptions
+	}
+	if len(route.Domains) > 0 {
+		labels[router("tls.domains[0].main")] = route.Domains[0]
+		labels[router("tls.domains[0].sans")] = strings.Join(route.Domains[1:], ",")
+	}
+	return labels
 }
@@ -2,12 +2,46 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
-type AdapterMap map[string]string
+// Adapter describes one supported device type. ADAPTER_MAP_JSON entries only
+// seed the adapter catalog; types already in the database are not changed.
+type Adapter struct {
+	Image       string `json:"image"`
+	Port        int    `json:"port,omitempty"`
+	Protocol    string `json:"protocol,omitempty"`
+	Description string `json:"description,omitempty"`
+	// RestartPolicy is always, on-failure or never; empty means always.
+	RestartPolicy string `json:"restart_policy,omitempty"`
+	// Schema is an optional JSON Schema for the per-device adapter config.
+	Schema json.RawMessage `json:"schema,omitempty"`
+}
+
+// UnmarshalJSON accepts either a bare image string or an object, so
+// ADAPTER_MAP_JSON values can be written as "image" or {"image": ..., "schema": ...}.
+func (a *Adapter) UnmarshalJSON(b []byte) error {
+	var img string
+	if err := json.Unmarshal(b, &img); err == nil {
+		*a = Adapter{Image: img}
+		return nil
+	}
+	type plain Adapter
+	return json.Unmarshal(b, (*plain)(a))
+}
+
+type AdapterMap map[string]Adapter
+
+// Shutdown policies: ShutdownStop stops every adapter when service-io exits,
+// ShutdownDetach leaves them running to be adopted at the next start.
+const (
+	ShutdownStop   = "stop"
+	ShutdownDetach = "detach"
+)
 
 type Config struct {
 	NATSURL             string
@@ -21,6 +55,65 @@ type Config struct {
 	TraefikEntryPoint   string
 	TraefikCertResolver string
 	BaseDomain          string
+
+	// RequireImageContract rejects adapter images without io.scadable.adapter.* labels.
+	// It cannot be used with the kubernetes runtime.
+	RequireImageContract bool
+
+	// ReconcileInterval is how often device state is reconciled; 0 disables it.
+	ReconcileInterval time.Duration
+
+	// An adapter exiting CrashLoopThreshold times within CrashLoopWindow is
+	// crashlooping. Restart delays double up to MaxRestartBackoff.
+	CrashLoopThreshold int
+	CrashLoopWindow    time.Duration
+	MaxRestartBackoff  time.Duration
+
+	// LeaderElection names the Postgres advisory lock replicas sharing a
+	// database compete for. Only the leader restarts, watches and reconciles
+	// adapters; every replica serves the API.
+	LeaderElection string
+
+	// Devices are restored at boot BootParallelism at a time, each within
+	// BootDeviceTimeout. BootPrioritySelectors (label selectors separated by
+	// ";") and BootPriorityTypes (device types) list what is restored first.
+	BootParallelism       int
+	BootDeviceTimeout     time.Duration
+	BootPrioritySelectors []string
+	BootPriorityTypes     []string
+
+	// ShutdownPolicy is ShutdownStop or ShutdownDetach. Adapters of the
+	// process runtime never outlive service-io, whatever the policy.
+	ShutdownPolicy string
+
+	// Lifecycle events are published to the JetStream stream EventsStream
+	// and kept for EventsMaxAge (0 keeps them forever). An empty
+	// EventsStream disables publishing.
+	EventsStream string
+	EventsMaxAge time.Duration
+
+	// Webhook deliveries time out after WebhookTimeout and are attempted up
+	// to WebhookMaxAttempts times, backing off from WebhookBackoff up to
+	// WebhookMaxBackoff.
+	WebhookTimeout     time.Duration
+	WebhookMaxAttempts int
+	WebhookBackoff     time.Duration
+	WebhookMaxBackoff  time.Duration
+
+	// Runtime selects where adapters run: "docker", "kubernetes" or "process".
+	Runtime string
+	// Kubernetes runtime settings. An empty Kubeconfig means in-cluster.
+	KubeNamespace       string
+	Kubeconfig          string
+	KubeImagePullSecret string
+
+	// Process runtime settings. Zero limits mean unlimited.
+	ProcessStateDir     string
+	ProcessLogLines     int
+	ProcessMemoryMB     uint64
+	ProcessCPUs         float64
+	ProcessOpenFiles    uint64
+	ProcessCgroupParent string
 }
 
 // MustLoad loads the required settings for the system to operate
@@ -31,12 +124,39 @@ func MustLoad() Config {
 	bucket := getenv("DEV_BUCKET", "devices")
 
 	sec, _ := strconv.Atoi(getenv("PUBLISH_TIMEOUT_SEC", "5"))
+	requireContract, _ := strconv.ParseBool(getenv("REQUIRE_IMAGE_CONTRACT", "false"))
+	reconcileSec, _ := strconv.Atoi(getenv("RECONCILE_INTERVAL_SEC", "60"))
+	crashLoopThreshold, _ := strconv.Atoi(getenv("CRASHLOOP_THRESHOLD", "5"))
+	crashLoopSec, _ := strconv.Atoi(getenv("CRASHLOOP_WINDOW_SEC", "600"))
+	maxBackoffSec, _ := strconv.Atoi(getenv("RESTART_BACKOFF_MAX_SEC", "300"))
+	logLines, _ := strconv.Atoi(getenv("PROCESS_LOG_LINES", "1000"))
+	memMB, _ := strconv.ParseUint(getenv("PROCESS_MEMORY_LIMIT_MB", "0"), 10, 64)
+	cpus, _ := strconv.ParseFloat(getenv("PROCESS_CPU_LIMIT", "0"), 64)
+	openFiles, _ := strconv.ParseUint(getenv("PROCESS_OPEN_FILES_LIMIT", "0"), 10, 64)
+	bootParallelism, _ := strconv.Atoi(getenv("BOOT_PARALLELISM", "8"))
+	bootTimeoutSec, _ := strconv.Atoi(getenv("BOOT_DEVICE_TIMEOUT_SEC", "300"))
+	eventsMaxAgeHours, _ := strconv.Atoi(getenv("EVENTS_MAX_AGE_HOURS", "168"))
+	webhookTimeoutSec, _ := strconv.Atoi(getenv("WEBHOOK_TIMEOUT_SEC", "10"))
+	webhookMaxAttempts, _ := strconv.Atoi(getenv("WEBHOOK_MAX_ATTEMPTS", "8"))
+	webhookBackoffSec, _ := strconv.Atoi(getenv("WEBHOOK_BACKOFF_SEC", "10"))
+	webhookMaxBackoffSec, _ := strconv.Atoi(getenv("WEBHOOK_BACKOFF_MAX_SEC", "3600"))
+	runtimeName := getenv("RUNTIME", "docker")
+	if requireContract && runtimeName == "kubernetes" {
+		// Images are pulled by the kubelet, so their labels cannot be read.
+		panic("config: REQUIRE_IMAGE_CONTRACT is not supported with RUNTIME=kubernetes")
+	}
+	shutdownPolicy := getenv("SHUTDOWN_POLICY", ShutdownStop)
+	if shutdownPolicy != ShutdownStop && shutdownPolicy != ShutdownDetach {
+		panic(fmt.Sprintf("config: invalid SHUTDOWN_POLICY %q: want %s or %s", shutdownPolicy, ShutdownStop, ShutdownDetach))
+	}
 	adapters := make(AdapterMap)
 	// Add "mqtt" to the default adapter map.
-	_ = json.Unmarshal([]byte(getenv("ADAPTER_MAP_JSON", `{
+	if err := json.Unmarshal([]byte(getenv("ADAPTER_MAP_JSON", `{
 					"random":"registry.digitalocean.com/scadable-container-registry/adapter-rand:latest", 
 					"mqtt":"registry.digitalocean.com/scadable-container-registry/adapter-mqtt:latest"
-					}`)), &adapters)
+					}`)), &adapters); err != nil {
+		panic(fmt.Sprintf("config: invalid ADAPTER_MAP_JSON: %v", err))
+	}
 
 	return Config{
 		NATSURL:             url,
@@ -50,6 +170,41 @@ func MustLoad() Config {
 		TraefikEntryPoint:   getenv("TRAEFIK_ENTRYPOINT", "mqtt"),
 		TraefikCertResolver: getenv("TRAEFIK_CERT_RESOLVER", "myresolver"),
 		BaseDomain:          getenv("BASE_DOMAIN", "io.scadable.com"),
+
+		RequireImageContract: requireContract,
+		ReconcileInterval:    time.Duration(reconcileSec) * time.Second,
+
+		CrashLoopThreshold: crashLoopThreshold,
+		CrashLoopWindow:    time.Duration(crashLoopSec) * time.Second,
+		MaxRestartBackoff:  time.Duration(maxBackoffSec) * time.Second,
+
+		LeaderElection: getenv("LEADER_ELECTION_NAME", "service-io"),
+		ShutdownPolicy: shutdownPolicy,
+
+		EventsStream: getenv("EVENTS_STREAM", "IO_EVENTS"),
+		EventsMaxAge: time.Duration(eventsMaxAgeHours) * time.Hour,
+
+		WebhookTimeout:     time.Duration(webhookTimeoutSec) * time.Second,
+		WebhookMaxAttempts: webhookMaxAttempts,
+		WebhookBackoff:     time.Duration(webhookBackoffSec) * time.Second,
+		WebhookMaxBackoff:  time.Duration(webhookMaxBackoffSec) * time.Second,
+
+		BootParallelism:       bootParallelism,
+		BootDeviceTimeout:     time.Duration(bootTimeoutSec) * time.Second,
+		BootPrioritySelectors: splitList(getenv("BOOT_PRIORITY_SELECTORS", ""), ";"),
+		BootPriorityTypes:     splitList(getenv("BOOT_PRIORITY_TYPES", ""), ","),
+
+		Runtime:             runtimeName,
+		KubeNamespace:       getenv("KUBE_NAMESPACE", "scadable-core"),
+		Kubeconfig:          getenv("KUBECONFIG", ""),
+		KubeImagePullSecret: getenv("KUBE_IMAGE_PULL_SECRET", ""),
+
+		ProcessStateDir:     getenv("PROCESS_STATE_DIR", "/var/lib/service-io/adapters"),
+		ProcessLogLines:     logLines,
+		ProcessMemoryMB:     memMB,
+		ProcessCPUs:         cpus,
+		ProcessOpenFiles:    openFiles,
+		ProcessCgroupParent: getenv("PROCESS_CGROUP_PARENT", ""),
 	}
 }
 
@@ -60,3 +215,14 @@ func getenv(k, d string) string {
 	}
 	return d
 }
+
+// splitList splits a sep-separated value, dropping empty entries.
+func splitList(v, sep string) []string {
+	var out []string
+	for _, s := range strings.Split(v, sep) {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,406 @@
+package devices
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"service-io/internal/core/runtime"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrUnknownAdapterType is returned for device types that are not in the catalog.
+	ErrUnknownAdapterType = errors.New("unsupported device type")
+	// ErrAdapterTypeExists is returned when creating a type whose name is taken.
+	ErrAdapterTypeExists = errors.New("adapter type already exists")
+	// ErrAdapterTypeDeprecated is returned when creating a device of a deprecated type.
+	ErrAdapterTypeDeprecated = errors.New("adapter type is deprecated")
+	// ErrInvalidAdapterType is returned when an adapter type definition is unusable.
+	ErrInvalidAdapterType = errors.New("invalid adapter type")
+	// ErrInvalidConfig is wrapped by ConfigValidationError.
+	ErrInvalidConfig = errors.New("invalid adapter config")
+)
+
+// defaultAdapterPort is the container port routed to when a type does not
+// declare one.
+const defaultAdapterPort = 1883
+
+// RestartPolicy says whether service-io restarts an adapter whose container
+// exits on its own.
+type RestartPolicy string
+
+const (
+	RestartAlways    RestartPolicy = "always"
+	RestartOnFailure RestartPolicy = "on-failure" // only after a non-zero exit code
+	RestartNever     RestartPolicy = "never"
+)
+
+// restarts reports whether a container that exited with exitCode is restarted.
+func (p RestartPolicy) restarts(exitCode int) bool {
+	switch p {
+	case RestartNever:
+		return false
+	case RestartOnFailure:
+		return exitCode != 0
+	default:
+		return true
+	}
+}
+
+// RawJSON is a JSON document stored verbatim in a JSONB column.
+type RawJSON json.RawMessage
+
+// MarshalJSON returns the document itself, or null when empty.
+func (r RawJSON) MarshalJSON() ([]byte, error) {
+	if len(r) == 0 {
+		return []byte("null"), nil
+	}
+	return r, nil
+}
+
+// UnmarshalJSON stores a copy of the document.
+func (r *RawJSON) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*r = nil
+		return nil
+	}
+	*r = append((*r)[:0], b...)
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (r RawJSON) Value() (driver.Value, error) {
+	if len(r) == 0 {
+		return nil, nil
+	}
+	return string(r), nil
+}
+
+// Scan implements sql.Scanner.
+func (r *RawJSON) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*r = nil
+	case []byte:
+		*r = append((*r)[:0], v...)
+	case string:
+		*r = RawJSON(v)
+	default:
+		return fmt.Errorf("raw json: unsupported scan type %T", src)
+	}
+	return nil
+}
+
+// AdapterType is an entry in the adapter catalog: a supported device type
+// and the image that implements it. With the process runtime, Image is the
+// path of a local executable instead.
+type AdapterType struct {
+	Name        string `gorm:"primaryKey" json:"name" example:"mqtt"`
+	Image       string `json:"image" example:"registry.digitalocean.com/scadable-container-registry/adapter-mqtt:latest"`
+	DefaultPort int    `json:"default_port" example:"1883"`
+	Protocol    string `json:"protocol,omitempty" example:"mqtt"`
+	Description string `json:"description,omitempty" example:"Generic MQTT bridge"`
+	// ConfigSchema is an optional JSON Schema for per-device adapter config.
+	ConfigSchema RawJSON    `gorm:"type:jsonb" json:"config_schema,omitempty" swaggertype:"object"`
+	Deprecated   bool       `json:"deprecated"`
+	DeprecatedAt *time.Time `json:"deprecated_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	// RestartPolicy applies to all devices of the type.
+	RestartPolicy RestartPolicy `json:"restart_policy" example:"always"`
+}
+
+// AdapterTypeUpdate lists the mutable fields of an adapter type. Nil fields
+// are left unchanged.
+type AdapterTypeUpdate struct {
+	Image        *string
+	DefaultPort  *int
+	Protocol     *string
+	Description  *string
+	ConfigSchema RawJSON
+	Deprecated   *bool
+
+	RestartPolicy *RestartPolicy
+}
+
+// port returns the container port to route to.
+func (t *AdapterType) port() int {
+	if t.DefaultPort == 0 {
+		return defaultAdapterPort
+	}
+	return t.DefaultPort
+}
+
+// validate checks that the type is usable and its schema compiles.
+func (t *AdapterType) validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("%w: name must not be empty", ErrInvalidAdapterType)
+	}
+	if t.Image == "" {
+		return fmt.Errorf("%w: image must not be empty", ErrInvalidAdapterType)
+	}
+	if t.DefaultPort < 0 || t.DefaultPort > 65535 {
+		return fmt.Errorf("%w: default_port out of range", ErrInvalidAdapterType)
+	}
+	switch t.RestartPolicy {
+	case RestartAlways, RestartOnFailure, RestartNever:
+	default:
+		return fmt.Errorf("%w: restart_policy must be always, on-failure or never", ErrInvalidAdapterType)
+	}
+	if _, err := compileSchema("adapter-types/"+t.Name, t.ConfigSchema); err != nil {
+		return fmt.Errorf("%w: config_schema: %v", ErrInvalidAdapterType, err)
+	}
+	return nil
+}
+
+// SeedAdapterTypes inserts the given types into the catalog, leaving types
+// that already exist untouched.
+func (m *Manager) SeedAdapterTypes(ctx context.Context, types []AdapterType) error {
+	for i := range types {
+		t := types[i]
+		if t.DefaultPort == 0 {
+			t.DefaultPort = defaultAdapterPort
+		}
+		if t.RestartPolicy == "" {
+			t.RestartPolicy = RestartAlways
+		}
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("seed adapter type %q: %w", t.Name, err)
+		}
+		res := m.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&t)
+		if res.Error != nil {
+			return fmt.Errorf("seed adapter type %q: %w", t.Name, res.Error)
+		}
+		if res.RowsAffected > 0 {
+			m.lg.Info().Str("type", t.Name).Str("image", t.Image).Msg("seeded adapter type")
+		}
+	}
+	return nil
+}
+
+// CreateAdapterType adds a new type to the catalog.
+func (m *Manager) CreateAdapterType(ctx context.Context, t AdapterType) (*AdapterType, error) {
+	if t.DefaultPort == 0 {
+		t.DefaultPort = defaultAdapterPort
+	}
+	if t.RestartPolicy == "" {
+		t.RestartPolicy = RestartAlways
+	}
+	t.Deprecated, t.DeprecatedAt = false, nil
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	res := m.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&t)
+	if res.Error != nil {
+		return nil, fmt.Errorf("create adapter type in db: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrAdapterTypeExists, t.Name)
+	}
+	return &t, nil
+}
+
+// ListAdapterTypes returns the catalog ordered by name. Deprecated types are
+// only included when includeDeprecated is set.
+func (m *Manager) ListAdapterTypes(ctx context.Context, includeDeprecated bool) ([]AdapterType, error) {
+	tx := m.db.WithContext(ctx).Order("name")
+	if !includeDeprecated {
+		tx = tx.Where("deprecated = ?", false)
+	}
+	var types []AdapterType
+	if err := tx.Find(&types).Error; err != nil {
+		return nil, err
+	}
+	return types, nil
+}
+
+// GetAdapterType returns a single catalog entry, deprecated or not.
+func (m *Manager) GetAdapterType(ctx context.Context, name string) (*AdapterType, error) {
+	var t AdapterType
+	if err := m.db.WithContext(ctx).First(&t, "name = ?", name).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w %q", ErrUnknownAdapterType, name)
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// UpdateAdapterType changes a catalog entry. Existing devices keep the image
+// they were created with.
+func (m *Manager) UpdateAdapterType(ctx context.Context, name string, upd AdapterTypeUpdate) (*AdapterType, error) {
+	t, err := m.GetAdapterType(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if upd.Image != nil {
+		t.Image = *upd.Image
+	}
+	if upd.DefaultPort != nil {
+		t.DefaultPort = *upd.DefaultPort
+	}
+	if upd.Protocol != nil {
+		t.Protocol = *upd.Protocol
+	}
+	if upd.Description != nil {
+		t.Description = *upd.Description
+	}
+	if upd.ConfigSchema != nil {
+		t.ConfigSchema = upd.ConfigSchema
+	}
+	if upd.Deprecated != nil && *upd.Deprecated != t.Deprecated {
+		t.setDeprecated(*upd.Deprecated)
+	}
+	if upd.RestartPolicy != nil {
+		t.RestartPolicy = *upd.RestartPolicy
+	}
+	if t.RestartPolicy == "" {
+		// Types created before restart policies existed.
+		t.RestartPolicy = RestartAlways
+	}
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	if err := m.db.WithContext(ctx).Save(t).Error; err != nil {
+		return nil, fmt.Errorf("update adapter type in db: %w", err)
+	}
+	return t, nil
+}
+
+// DeprecateAdapterType stops new devices from using a type. Existing devices
+// of the type keep running.
+func (m *Manager) DeprecateAdapterType(ctx context.Context, name string) (*AdapterType, error) {
+	deprecated := true
+	return m.UpdateAdapterType(ctx, name, AdapterTypeUpdate{Deprecated: &deprecated})
+}
+
+func (t *AdapterType) setDeprecated(deprecated bool) {
+	t.Deprecated = deprecated
+	t.DeprecatedAt = nil
+	if deprecated {
+		now := time.Now().UTC()
+		t.DeprecatedAt = &now
+	}
+}
+
+// FieldError is a single schema violation in an adapter config.
+type FieldError struct {
+	// Field is a JSON pointer into the config, e.g. "/pollInterval".
+	Field   string `json:"field" example:"/pollInterval"`
+	Message string `json:"message" example:"must be >= 1 but found 0"`
+}
+
+// ConfigValidationError lists the field-level problems with an adapter config.
+type ConfigValidationError struct {
+	Type   string
+	Fields []FieldError
+}
+
+func (e *ConfigValidationError) Error() string {
+	return fmt.Sprintf("%s: %d field error(s) for type %q", ErrInvalidConfig, len(e.Fields), e.Type)
+}
+
+func (e *ConfigValidationError) Unwrap() error { return ErrInvalidConfig }
+
+// compileSchema compiles a config schema. An empty schema yields nil, which
+// accepts any config.
+func compileSchema(name string, raw []byte) (*jsonschema.Schema, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	url := name + "/schema.json"
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(url, bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	return c.Compile(url)
+}
+
+// AdapterSchema returns the config JSON Schema that devices of a type are
+// validated against, picked as resolveAdapter does: the catalog's schema,
+// or else the one declared by the type's image. Devices moved to another
+// image may be held to that image's schema instead. Types without a schema
+// return an empty schema, which accepts any config.
+func (m *Manager) AdapterSchema(ctx context.Context, typeName string) (json.RawMessage, error) {
+	t, err := m.GetAdapterType(ctx, typeName)
+	if err != nil {
+		return nil, err
+	}
+	raw := []byte(t.ConfigSchema)
+	if len(raw) == 0 {
+		rt, err := m.runtimeFor(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		info, err := rt.Resolve(ctx, t.Image, false)
+		if err != nil {
+			if errors.Is(err, runtime.ErrInvalidContract) {
+				return nil, fmt.Errorf("%w: %s: %v", ErrIncompatibleImage, t.Image, err)
+			}
+			return nil, fmt.Errorf("inspect adapter image: %w", err)
+		}
+		raw = info.Contract.ConfigSchema
+	}
+	if len(raw) == 0 {
+		return json.RawMessage(`{}`), nil
+	}
+	return json.RawMessage(raw), nil
+}
+
+// validateCatalogConfig checks an adapter config against the catalog schema
+// of its type, if the type has one, so that a bad config is rejected before
+// anything is recorded or pulled. The schema an image declares is checked
+// once the image is resolved.
+func validateCatalogConfig(t *AdapterType, cfg AdapterConfig) error {
+	schema, err := compileSchema("adapter-types/"+t.Name, t.ConfigSchema)
+	if err != nil {
+		return fmt.Errorf("%w: config schema of type %q: %v", ErrInvalidAdapterType, t.Name, err)
+	}
+	return validateConfig(t.Name, schema, cfg)
+}
+
+// validateConfig checks an adapter config against the type's schema.
+func validateConfig(typeName string, schema *jsonschema.Schema, cfg AdapterConfig) error {
+	if schema == nil {
+		return nil
+	}
+	var doc any = map[string]any(cfg)
+	if cfg == nil {
+		doc = map[string]any{}
+	}
+	err := schema.Validate(doc)
+	if err == nil {
+		return nil
+	}
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+	verr := &ConfigValidationError{Type: typeName}
+	collectFieldErrors(ve, &verr.Fields)
+	return verr
+}
+
+// collectFieldErrors flattens the leaves of a validation error tree.
+func collectFieldErrors(ve *jsonschema.ValidationError, out *[]FieldError) {
+	if len(ve.Causes) == 0 {
+		field := ve.InstanceLocation
+		if field == "" {
+			field = "/"
+		}
+		*out = append(*out, FieldError{Field: field, Message: ve.Message})
+		return
+	}
+	for _, c := range ve.Causes {
+		collectFieldErrors(c, out)
+	}
+}
@@ -0,0 +1,63 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"service-io/internal/core/runtime"
+)
+
+func TestAdapterSchema(t *testing.T) {
+	env := newTestManager(t, Options{})
+	ctx := context.Background()
+
+	// Without a catalog schema, the one declared by the image applies.
+	const labelled = `{"type":"object","required":["broker"]}`
+	env.rt.SetImage(testImage, runtime.ImageInfo{Contract: runtime.Contract{Declared: true, ConfigSchema: []byte(labelled)}})
+	got, err := env.m.AdapterSchema(ctx, "mqtt")
+	if err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	if string(got) != labelled {
+		t.Errorf("schema = %s, want the image's %s", got, labelled)
+	}
+
+	// A catalog schema wins.
+	const catalog = `{"type":"object"}`
+	if _, err := env.m.UpdateAdapterType(ctx, "mqtt", AdapterTypeUpdate{ConfigSchema: RawJSON(catalog)}); err != nil {
+		t.Fatalf("update adapter type: %v", err)
+	}
+	if got, err = env.m.AdapterSchema(ctx, "mqtt"); err != nil || string(got) != catalog {
+		t.Errorf("schema = %s, %v, want the catalog's %s", got, err, catalog)
+	}
+}
+
+func TestCatalogSchemaCheckedUpFront(t *testing.T) {
+	env := newTestManager(t, Options{})
+	ctx := context.Background()
+	dev := env.addDevice(t, "plc-1")
+	schema := RawJSON(`{"type":"object","required":["broker"]}`)
+	if _, err := env.m.UpdateAdapterType(ctx, "mqtt", AdapterTypeUpdate{ConfigSchema: schema}); err != nil {
+		t.Fatalf("update adapter type: %v", err)
+	}
+	// The image could not even be resolved, so only the catalog can reject
+	// the config.
+	env.rt.FailResolve(testImage, errors.New("registry unreachable"))
+
+	var verr *ConfigValidationError
+	_, err := env.m.SubmitAddDevice(ctx, NewDevice{Type: "mqtt", Name: "plc-2", Config: AdapterConfig{"port": 1883}})
+	if !errors.As(err, &verr) {
+		t.Errorf("submit: err = %v, want a config validation error", err)
+	}
+	var n int64
+	env.m.db.Model(&Device{}).Count(&n)
+	if n != 1 {
+		t.Errorf("%d devices recorded, want the invalid one rejected", n)
+	}
+
+	_, err = env.m.UpdateDevice(ctx, dev.ID, DeviceUpdate{Config: AdapterConfig{"port": 1883}})
+	if !errors.As(err, &verr) {
+		t.Errorf("update: err = %v, want a config validation error", err)
+	}
+}
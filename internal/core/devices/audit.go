@@ -0,0 +1,112 @@
+package devices
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuditActionPurged marks the tombstone left behind by PurgeDevice.
+const AuditActionPurged = "purged"
+
+// AuditEntry records an irreversible action on a device. Entries outlive the
+// device record they refer to.
+type AuditEntry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	DeviceID  string    `gorm:"index" json:"device_id" example:"EDIVRWCLGGPGCW7M"`
+	Action    string    `json:"action" example:"purged"`
+	Snapshot  string    `gorm:"type:jsonb" json:"snapshot"` // device record at the time of the action, without secrets
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PurgeDevice permanently removes a device: its container, JetStream stream,
+// MQTT credentials, Traefik route and database record. A tombstone audit
+// entry is kept. Purging an already purged device is a no-op. The removal
+// runs as a purge operation.
+func (m *Manager) PurgeDevice(ctx context.Context, deviceID string) error {
+	op, err := m.preparePurge(ctx, deviceID)
+	if err != nil || op == nil {
+		return err
+	}
+	if err := m.runOperation(ctx, op); err != nil {
+		return err
+	}
+	m.lg.Info().Str("device_id", deviceID).Msg("device purged")
+	return nil
+}
+
+// SubmitPurgeDevice is PurgeDevice in the background. It returns a nil
+// operation if the device is already purged.
+func (m *Manager) SubmitPurgeDevice(ctx context.Context, deviceID string) (*Operation, error) {
+	op, err := m.preparePurge(ctx, deviceID)
+	if err != nil || op == nil {
+		return nil, err
+	}
+	return m.goOperation(op), nil
+}
+
+func (m *Manager) preparePurge(ctx context.Context, deviceID string) (*Operation, error) {
+	dev, err := m.findDevice(deviceID)
+	if errors.Is(err, ErrNotFound) {
+		purged, checkErr := m.purged(ctx, deviceID)
+		if checkErr != nil || purged {
+			return nil, checkErr
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	op, err := m.recordOperation(ctx, OperationPurge, dev.ID)
+	if err != nil {
+		return nil, err
+	}
+	// A pending restart must not bring the adapter back.
+	m.forgetCrashes(dev.ID)
+	return op, nil
+}
+
+// purged reports whether a device was purged, i.e. has a tombstone.
+func (m *Manager) purged(ctx context.Context, deviceID string) (bool, error) {
+	var count int64
+	if err := m.db.WithContext(ctx).Model(&AuditEntry{}).
+		Where("device_id = ? AND action = ?", deviceID, AuditActionPurged).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("check tombstone: %w", err)
+	}
+	return count > 0, nil
+}
+
+// deleteRecord deletes a device record and its config revisions, leaving a
+// tombstone audit entry.
+func (m *Manager) deleteRecord(ctx context.Context, dev *Device) error {
+	// The credentials are not part of the tombstone.
+	dev.MQTTPassword = ""
+	snapshot, err := json.Marshal(dev)
+	if err != nil {
+		return fmt.Errorf("marshal device snapshot: %w", err)
+	}
+
+	err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&ConfigRevision{}, "device_id = ?", dev.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&Device{}, "id = ?", dev.ID).Error; err != nil {
+			return err
+		}
+		return tx.Create(&AuditEntry{
+			DeviceID:  dev.ID,
+			Action:    AuditActionPurged,
+			Snapshot:  string(snapshot),
+			CreatedAt: time.Now().UTC(),
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("delete device record in db: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package devices
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestPurgeDevice(t *testing.T) {
+	env := newTestManager(t, Options{})
+	dev := env.addDevice(t, "plc-1")
+	other := env.addDevice(t, "plc-2")
+	ctx := context.Background()
+	events, unsubscribe := env.m.Subscribe()
+	defer unsubscribe()
+
+	if err := env.m.PurgeDevice(ctx, dev.ID); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if _, err := env.m.findDevice(dev.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("find purged device: err = %v, want %v", err, ErrNotFound)
+	}
+	if env.streams.has(dev.streamName()) {
+		t.Errorf("stream %s not removed", dev.streamName())
+	}
+	if _, ok := env.rt.Instance(dev.ContainerID); ok {
+		t.Errorf("container %s not removed", dev.ContainerID)
+	}
+	var revisions int64
+	env.m.db.Model(&ConfigRevision{}).Where("device_id = ?", dev.ID).Count(&revisions)
+	if revisions != 0 {
+		t.Errorf("%d config revisions left", revisions)
+	}
+	if ev := nextEvent(t, events); ev.Type != EventPurged || ev.DeviceID != dev.ID {
+		t.Errorf("event = %s of %s, want %s", ev.Type, ev.DeviceID, EventPurged)
+	}
+
+	// The tombstone keeps the record without its credentials.
+	var tombstones []AuditEntry
+	if err := env.m.db.Where("device_id = ?", dev.ID).Find(&tombstones).Error; err != nil {
+		t.Fatalf("load audit entries: %v", err)
+	}
+	if len(tombstones) != 1 || tombstones[0].Action != AuditActionPurged {
+		t.Fatalf("audit entries = %+v, want a tombstone", tombstones)
+	}
+	var snapshot Device
+	if err := json.Unmarshal([]byte(tombstones[0].Snapshot), &snapshot); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	if snapshot.ID != dev.ID || snapshot.Name != dev.Name || snapshot.MQTTPassword != "" {
+		t.Errorf("snapshot = %+v, want %s without its MQTT password", snapshot, dev.ID)
+	}
+
+	// Purging again is a no-op; the other device is untouched.
+	if err := env.m.PurgeDevice(ctx, dev.ID); err != nil {
+		t.Errorf("purge again: %v", err)
+	}
+	if got := env.device(t, other.ID); got.Status != StatusRunning || !env.streams.has(other.streamName()) {
+		t.Errorf("other device is %s, want it running with its stream", got.Status)
+	}
+	if err := env.m.PurgeDevice(ctx, "UNKNOWN"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("purge unknown device: err = %v, want %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,210 @@
+package devices
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"service-io/internal/core/runtime"
+)
+
+// BootReport is the progress of restoring the fleet after service-io
+// started or became leader.
+type BootReport struct {
+	StartedAt time.Time `json:"started_at"`
+	// FinishedAt is set once every device has been restored or given up on.
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Total      int        `json:"total" example:"120"`
+	Done       int        `json:"done" example:"87"`
+	// Adopted devices kept the adapter instance they already had.
+	Adopted   int           `json:"adopted" example:"80"`
+	Restarted int           `json:"restarted" example:"5"`
+	Failed    int           `json:"failed" example:"2"`
+	Failures  []BootFailure `json:"failures"`
+}
+
+// BootFailure is a device that could not be restored.
+type BootFailure struct {
+	DeviceID string `json:"device_id" example:"EDIVRWCLGGPGCW7M"`
+	Error    string `json:"error" example:"context deadline exceeded"`
+}
+
+// Restored reports whether restoring the fleet has finished.
+func (r *BootReport) Restored() bool {
+	return r.FinishedAt != nil
+}
+
+// BootProgress returns the progress of the latest fleet restore, or nil if
+// none has started on this replica.
+func (m *Manager) BootProgress() *BootReport {
+	m.bootMu.Lock()
+	defer m.bootMu.Unlock()
+	if m.boot == nil {
+		return nil
+	}
+	rep := *m.boot
+	rep.Failures = slices.Clone(m.boot.Failures)
+	return &rep
+}
+
+// RestartRunningDevices brings back the adapters of all devices that were
+// running when service-io stopped, in priority order and several at a time.
+// Running adapter instances it left behind, e.g. on a detached shutdown, are
+// adopted as they are; the others are recreated. Progress is available from
+// BootProgress.
+func (m *Manager) RestartRunningDevices(ctx context.Context) error {
+	m.lg.Info().Msg("restarting any previously running devices...")
+	var runningDevices []Device
+	if err := m.db.Where("status IN ?", activeStatuses).Order("created_at").Find(&runningDevices).Error; err != nil {
+		return fmt.Errorf("could not query running devices: %w", err)
+	}
+	m.sortForBoot(runningDevices)
+
+	rep := &BootReport{StartedAt: time.Now().UTC(), Total: len(runningDevices), Failures: []BootFailure{}}
+	m.bootMu.Lock()
+	m.boot = rep
+	m.bootMu.Unlock()
+
+	instances := make(map[string]map[string]runtime.Instance)
+	for _, dev := range runningDevices {
+		if _, listed := instances[dev.Host]; listed {
+			continue
+		}
+		onHost, err := m.listInstances(ctx, dev.Host)
+		if err != nil {
+			m.lg.Warn().Err(err).Str("host", dev.Host).Msg("failed to list adapter instances to adopt")
+		}
+		instances[dev.Host] = onHost
+	}
+
+	jobs := make(chan *Device)
+	var wg sync.WaitGroup
+	for range min(m.opts.BootParallelism, len(runningDevices)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dev := range jobs {
+				adopted, err := m.restoreDevice(ctx, dev, instances[dev.Host])
+				m.bootMu.Lock()
+				rep.Done++
+				switch {
+				case err != nil:
+					rep.Failed++
+					rep.Failures = append(rep.Failures, BootFailure{DeviceID: dev.ID, Error: err.Error()})
+				case adopted:
+					rep.Adopted++
+				default:
+					rep.Restarted++
+				}
+				m.bootMu.Unlock()
+			}
+		}()
+	}
+feed:
+	for i := range runningDevices {
+		select {
+		case jobs <- &runningDevices[i]:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("device restart interrupted: %w", err)
+	}
+
+	m.bootMu.Lock()
+	finished := time.Now().UTC()
+	rep.FinishedAt = &finished
+	m.bootMu.Unlock()
+	m.lg.Info().Int("count", rep.Total).Int("adopted", rep.Adopted).Int("restarted", rep.Restarted).
+		Int("failed", rep.Failed).Dur("took", finished.Sub(rep.StartedAt)).Msg("device restart process complete")
+	return nil
+}
+
+// restoreDevice adopts or recreates the adapter of one device. A device
+// that cannot be restored is marked stopped.
+func (m *Manager) restoreDevice(ctx context.Context, dev *Device, onHost map[string]runtime.Instance) (bool, error) {
+	if inst, ok := onHost[dev.ID]; ok && m.adopt(dev, inst) {
+		return true, nil
+	}
+	m.lg.Info().Str("device_id", dev.ID).Msg("restarting device")
+
+	ctx, cancel := context.WithTimeout(ctx, m.opts.BootDeviceTimeout)
+	defer cancel()
+	dev.Status = StatusRunning
+	runErr := m.runContainer(ctx, dev)
+	if runErr != nil {
+		m.lg.Error().Err(runErr).Str("device_id", dev.ID).Msg("failed to restart device container")
+		dev.Status = StatusStopped
+	}
+
+	ev := Event{DeviceID: dev.ID, Type: EventRestarted, Status: dev.Status, Reason: "restored at boot"}
+	if runErr != nil {
+		ev.Type, ev.Error = EventStopped, runErr.Error()
+	}
+	err := m.withEvents(context.WithoutCancel(ctx), func(tx *gorm.DB) error {
+		if err := tx.Save(dev).Error; err != nil {
+			return err
+		}
+		return m.publish(tx, ev)
+	})
+	if err != nil {
+		m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to update device record after restart attempt")
+		if runErr == nil {
+			runErr = err
+		}
+	}
+	return false, runErr
+}
+
+// adopt takes over a running instance that service-io created for dev,
+// instead of replacing it. It reports false if the instance cannot be
+// adopted.
+func (m *Manager) adopt(dev *Device, inst runtime.Instance) bool {
+	if !inst.Running || inst.Labels[runtime.LabelManagedBy] != runtime.ManagedByValue ||
+		inst.Labels[runtime.LabelDeviceID] != dev.ID {
+		return false
+	}
+	dev.Status = StatusRunning
+	dev.ContainerID = inst.ID
+	if err := m.db.Save(dev).Error; err != nil {
+		m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to save adopted device")
+		return false
+	}
+	m.lg.Info().Str("device_id", dev.ID).Str("container_id", inst.ID).Msg("adopted running adapter")
+	return true
+}
+
+// sortForBoot orders devices by boot priority, keeping the given order
+// among devices of equal priority.
+func (m *Manager) sortForBoot(devs []Device) {
+	rank := func(dev *Device) (int, int) {
+		sel := len(m.opts.BootPrioritySelectors)
+		for i, s := range m.opts.BootPrioritySelectors {
+			if s.Matches(dev.Labels) {
+				sel = i
+				break
+			}
+		}
+		typ := slices.Index(m.opts.BootPriorityTypes, dev.DeviceType)
+		if typ < 0 {
+			typ = len(m.opts.BootPriorityTypes)
+		}
+		return sel, typ
+	}
+	sort.SliceStable(devs, func(i, j int) bool {
+		si, ti := rank(&devs[i])
+		sj, tj := rank(&devs[j])
+		if si != sj {
+			return si < sj
+		}
+		return ti < tj
+	})
+}
@@ -0,0 +1,89 @@
+package devices
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AdapterConfig is the per-device configuration handed to the adapter
+// container, e.g. poll intervals, target hosts or register maps. It is
+// persisted as a JSONB column.
+type AdapterConfig map[string]any
+
+// Value implements driver.Valuer so GORM can store the map as JSON. A nil
+// config is stored as NULL, so it reads back as nil and the adapter gets no
+// config file, as when it was created.
+func (c AdapterConfig) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+// Scan implements sql.Scanner for reading the JSONB column back.
+func (c *AdapterConfig) Scan(src any) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("adapter config: unsupported scan type %T", src)
+	}
+	return json.Unmarshal(raw, c)
+}
+
+// equal reports whether two configs serialise to the same JSON.
+func (c AdapterConfig) equal(other AdapterConfig) bool {
+	a, errA := json.Marshal(c)
+	b, errB := json.Marshal(other)
+	return errA == nil && errB == nil && bytes.Equal(a, b)
+}
+
+// ConfigRevision is one stored version of a device's adapter configuration.
+type ConfigRevision struct {
+	ID        uint          `gorm:"primaryKey" json:"-"`
+	DeviceID  string        `gorm:"uniqueIndex:idx_config_revision" json:"device_id" example:"EDIVRWCLGGPGCW7M"`
+	Version   int           `gorm:"uniqueIndex:idx_config_revision" json:"version" example:"2"`
+	Config    AdapterConfig `gorm:"type:jsonb" json:"config" swaggertype:"object"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// ListConfigRevisions returns the configuration history of a device, newest first.
+func (m *Manager) ListConfigRevisions(ctx context.Context, deviceID string) ([]ConfigRevision, error) {
+	if _, err := m.findDevice(deviceID); err != nil {
+		return nil, err
+	}
+	var revs []ConfigRevision
+	if err := m.db.WithContext(ctx).
+		Where("device_id = ?", deviceID).
+		Order("version DESC").
+		Find(&revs).Error; err != nil {
+		return nil, err
+	}
+	return revs, nil
+}
+
+// recordRevision stores the device's current config as a new revision.
+func recordRevision(tx *gorm.DB, dev *Device) error {
+	return tx.Create(&ConfigRevision{
+		DeviceID:  dev.ID,
+		Version:   dev.ConfigVersion,
+		Config:    dev.Config,
+		CreatedAt: time.Now().UTC(),
+	}).Error
+}
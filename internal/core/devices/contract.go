@@ -0,0 +1,88 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"service-io/internal/core/runtime"
+	"service-io/internal/version"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// ErrIncompatibleImage is returned when an adapter image does not declare a
+// contract that this service-io can satisfy.
+var ErrIncompatibleImage = errors.New("incompatible adapter image")
+
+// adapterProfile is the effective contract of an adapter: the labels declared
+// by its image layered over the catalog defaults of its type.
+type adapterProfile struct {
+	digest   string
+	port     int
+	protocol string
+	tls      bool
+	schema   *jsonschema.Schema
+}
+
+// resolveAdapter pulls image on rt if needed (always, with forcePull), reads its
+// contract labels and checks them against the adapter type and this
+// service-io version.
+func (m *Manager) resolveAdapter(ctx context.Context, rt runtime.Runtime, t *AdapterType, image string, forcePull bool) (*adapterProfile, error) {
+	info, err := rt.Resolve(ctx, image, forcePull)
+	if err != nil {
+		if errors.Is(err, runtime.ErrInvalidContract) || errors.Is(err, runtime.ErrNoDigest) {
+			return nil, fmt.Errorf("%w: %s: %v", ErrIncompatibleImage, image, err)
+		}
+		return nil, fmt.Errorf("inspect adapter image: %w", err)
+	}
+	ct := info.Contract
+
+	if !ct.Declared && m.opts.RequireImageContract {
+		return nil, fmt.Errorf("%w: %s declares no io.scadable.adapter.* labels", ErrIncompatibleImage, image)
+	}
+	if ct.MinServiceVersion != "" {
+		ok, err := version.AtLeast(ct.MinServiceVersion)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrIncompatibleImage, image, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: %s requires service-io >= %s, running %s",
+				ErrIncompatibleImage, image, ct.MinServiceVersion, version.Version)
+		}
+	}
+	if t.Protocol != "" && ct.Protocol != "" && t.Protocol != ct.Protocol {
+		return nil, fmt.Errorf("%w: %s speaks %q but type %q expects %q",
+			ErrIncompatibleImage, image, ct.Protocol, t.Name, t.Protocol)
+	}
+
+	p := &adapterProfile{digest: info.Digest, port: t.port(), protocol: t.Protocol, tls: ct.TLS}
+	if ct.Port != 0 {
+		p.port = ct.Port
+	}
+	if ct.Protocol != "" {
+		p.protocol = ct.Protocol
+	}
+
+	// A schema set in the catalog wins over the one shipped in the image.
+	schemaName, rawSchema := "adapter-types/"+t.Name, []byte(t.ConfigSchema)
+	if len(rawSchema) == 0 {
+		schemaName, rawSchema = "images/"+image, ct.ConfigSchema
+	}
+	if p.schema, err = compileSchema(schemaName, rawSchema); err != nil {
+		return nil, fmt.Errorf("%w: config schema of %s: %v", ErrIncompatibleImage, schemaName, err)
+	}
+	return p, nil
+}
+
+// deviceAdapterType returns the catalog entry for a device's type. Types are
+// only ever deprecated, but if the entry is missing a bare type with default
+// settings is returned so existing devices keep working.
+func (m *Manager) deviceAdapterType(ctx context.Context, dev *Device) *AdapterType {
+	t, err := m.GetAdapterType(ctx, dev.DeviceType)
+	if err != nil {
+		m.lg.Warn().Err(err).Str("type", dev.DeviceType).Msg("adapter type lookup failed, using defaults")
+		return &AdapterType{Name: dev.DeviceType}
+	}
+	return t
+}
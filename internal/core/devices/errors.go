@@ -0,0 +1,21 @@
+package devices
+
+import "errors"
+
+// ErrNotFound is returned when a device ID does not match any record.
+var ErrNotFound = errors.New("device not found")
+
+// ErrInvalidUpdate is returned when an update request carries unusable values.
+var ErrInvalidUpdate = errors.New("invalid device update")
+
+// ErrConflict is returned when a device changed while a request was
+// modifying it; the request may be retried.
+var ErrConflict = errors.New("device changed concurrently")
+
+// ErrNoContainer is returned when an operation needs the device's container
+// but none exists, e.g. because the device is stopped.
+var ErrNoContainer = errors.New("device has no container")
+
+// ErrNotLeader is returned for fleet-wide work requested from a replica that
+// is not the leader.
+var ErrNotLeader = errors.New("not the leader replica")
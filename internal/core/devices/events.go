@@ -0,0 +1,410 @@
+package devices
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"service-io/pkg/rand"
+
+	"gorm.io/gorm"
+)
+
+// Lifecycle event types.
+const (
+	EventStarted   = "started"
+	EventDied      = "died"
+	EventOOMKilled = "oom_killed"
+	EventRestarted = "restarted"
+	EventHealth    = "health_changed"
+	// EventCrashLooping is published when a failed restart makes a device
+	// crashlooping; exits that do carry the status on their died event.
+	EventCrashLooping = "crashlooping"
+	EventRecovered    = "recovered"
+
+	// Transitions made through the API, by the reconciler, at boot and by
+	// upgrades.
+	EventCreated  = "created"
+	EventStopped  = "stopped"
+	EventDeleted  = "deleted"
+	EventPurged   = "purged"
+	EventFailed   = "failed"
+	EventUpgraded = "upgraded"
+	// EventUpdated is published when a device's name, description, labels,
+	// image or config is changed.
+	EventUpdated = "updated"
+)
+
+// eventTypes lists every lifecycle event type.
+var eventTypes = []string{
+	EventStarted, EventDied, EventOOMKilled, EventRestarted, EventHealth, EventCrashLooping,
+	EventRecovered, EventCreated, EventStopped, EventDeleted, EventPurged, EventFailed, EventUpgraded,
+	EventUpdated,
+}
+
+// operationEvents is the event published when an operation of a kind
+// succeeds.
+var operationEvents = map[string]string{
+	OperationCreate:  EventCreated,
+	OperationStart:   EventStarted,
+	OperationStop:    EventStopped,
+	OperationRestart: EventRestarted,
+	OperationDelete:  EventDeleted,
+	OperationPurge:   EventPurged,
+}
+
+// ActorSystem is the actor of events service-io causes on its own, e.g. when
+// it restarts a crashed adapter.
+const ActorSystem = "service-io"
+
+type actorKey struct{}
+
+// WithActor returns a context on behalf of actor, e.g. the API client making
+// a request. Events and operations caused with it are attributed to actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor of ctx, or ActorSystem if there is none.
+func ActorFrom(ctx context.Context) string {
+	if actor, _ := ctx.Value(actorKey{}).(string); actor != "" {
+		return actor
+	}
+	return ActorSystem
+}
+
+// Event is a lifecycle event of a device.
+type Event struct {
+	ID string `json:"id" example:"VQ3M7XKD2HNB5RJT"`
+	// Seq orders the events of all replicas. It is only set on events sent
+	// to subscribers.
+	Seq      uint64    `json:"seq,omitempty" example:"4242"`
+	DeviceID string    `json:"device_id" example:"EDIVRWCLGGPGCW7M"`
+	Type     string    `json:"type" example:"died"`
+	Status   Status    `json:"status" example:"exited"`
+	ExitCode int       `json:"exit_code,omitempty" example:"137"`
+	Health   string    `json:"health,omitempty" example:"unhealthy"`
+	Error    string    `json:"error,omitempty" example:"out of memory"`
+	Time     time.Time `json:"time"`
+
+	// Actor is who caused the event: an API client, or ActorSystem.
+	Actor  string `json:"actor" example:"service-io"`
+	Reason string `json:"reason,omitempty" example:"restart policy always"`
+	// Device is the device as the event left it, without its MQTT password.
+	// It is missing if the device could not be read.
+	Device *Device `json:"device,omitempty"`
+}
+
+// EventEnvelopeVersion is raised on incompatible changes to EventEnvelope.
+const EventEnvelopeVersion = 1
+
+// EventEnvelope is a lifecycle event as published on NATS.
+type EventEnvelope struct {
+	Version int `json:"version" example:"1"`
+	Event
+}
+
+// EventSubject is the NATS subject a device's events of a type are published
+// on: io.events.device.<device id>.<event type>.
+func EventSubject(deviceID, eventType string) string {
+	return fmt.Sprintf("io.events.device.%s.%s", deviceID, eventType)
+}
+
+// EventSubjects matches every subject of EventSubject.
+const EventSubjects = "io.events.device.>"
+
+const (
+	// subscriberBuffer is the capacity of each subscription. Subscriptions
+	// that fall this far behind are closed; the subscriber can Resume.
+	subscriberBuffer = 256
+	// eventHistory is how many missed events are sent to a subscriber
+	// resuming with Resume. One that missed more has to start over.
+	eventHistory = 1024
+	// tailEventsEvery is how often the outbox is read for subscribers,
+	// besides right after this replica recorded an event.
+	tailEventsEvery = 500 * time.Millisecond
+	// tailHoleWait is how long subscribers are kept waiting for a skipped
+	// sequence number, whose event may not be committed yet.
+	tailHoleWait = 2 * time.Second
+)
+
+// eventBus fans the events recorded in the outbox by every replica out to
+// in-process subscribers. The outbox is only read while there are
+// subscribers. The zero value is ready to use.
+type eventBus struct {
+	mu      sync.Mutex
+	subs    map[chan Event]struct{}
+	closed  bool
+	tailing bool
+	// last is the sequence number of the latest event sent to subscribers.
+	last uint64
+}
+
+// Subscribe returns a channel receiving every lifecycle event recorded from
+// now on, by any replica, and a function that ends the subscription and
+// closes the channel. The channel is also closed if the subscriber falls
+// behind.
+func (m *Manager) Subscribe() (<-chan Event, func()) {
+	b := &m.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m.startTailLocked()
+	return m.subscribeLocked()
+}
+
+// Resume is Subscribe for a subscriber that already saw the events up to
+// sequence number lastSeq. It also returns the events recorded since, in
+// order. ok is false if they are no longer all known, in which case missed
+// is empty and the subscriber may have missed any number of events.
+func (m *Manager) Resume(ctx context.Context, lastSeq uint64) (missed []Event, events <-chan Event, cancel func(), ok bool) {
+	b := &m.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m.startTailLocked()
+	missed, ok = m.missedEvents(ctx, lastSeq, b.last)
+	events, cancel = m.subscribeLocked()
+	return missed, events, cancel, ok
+}
+
+// missedEvents returns the events recorded after seq up to last, and
+// whether they are all still in the outbox and at most eventHistory.
+func (m *Manager) missedEvents(ctx context.Context, seq, last uint64) ([]Event, bool) {
+	if seq > last {
+		return nil, false
+	}
+	var oldest uint64
+	err := m.db.WithContext(ctx).Model(&OutboxEvent{}).Select("COALESCE(MIN(seq), 0)").Scan(&oldest).Error
+	if err != nil || oldest == 0 || oldest > seq {
+		return nil, false
+	}
+	var rows []OutboxEvent
+	err = m.db.WithContext(ctx).Where("seq > ? AND seq <= ?", seq, last).Order("seq").
+		Limit(eventHistory + 1).Find(&rows).Error
+	if err != nil || len(rows) > eventHistory {
+		return nil, false
+	}
+	missed := make([]Event, 0, len(rows))
+	for i := range rows {
+		if ev, err := rows[i].event(); err == nil {
+			missed = append(missed, ev)
+		}
+	}
+	return missed, true
+}
+
+// CloseSubscriptions closes every subscription, and those made later right
+// away, so subscribers such as event streams end when shutting down.
+func (m *Manager) CloseSubscriptions() {
+	b := &m.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// subscribeLocked adds a subscriber. The bus must be locked.
+func (m *Manager) subscribeLocked() (<-chan Event, func()) {
+	b := &m.events
+	ch := make(chan Event, subscriberBuffer)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if b.subs == nil {
+		b.subs = make(map[chan Event]struct{})
+	}
+	b.subs[ch] = struct{}{}
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// startTailLocked starts reading the outbox for subscribers, from the
+// latest event on, unless it is read already. The bus must be locked.
+func (m *Manager) startTailLocked() {
+	b := &m.events
+	if b.tailing {
+		return
+	}
+	var last uint64
+	if err := m.db.Model(&OutboxEvent{}).Select("COALESCE(MAX(seq), 0)").Scan(&last).Error; err != nil {
+		m.lg.Warn().Err(err).Msg("failed to find the latest event")
+	}
+	b.tailing, b.last = true, max(b.last, last)
+	go m.tailEvents()
+}
+
+// tailEvents sends the events recorded in the outbox to the subscribers, in
+// order, until there are none left.
+func (m *Manager) tailEvents() {
+	b := &m.events
+	t := time.NewTicker(tailEventsEvery)
+	defer t.Stop()
+	var holeSince time.Time
+	for {
+		select {
+		case <-t.C:
+		case <-m.tailWake:
+		}
+		b.mu.Lock()
+		if len(b.subs) == 0 {
+			b.tailing = false
+			b.mu.Unlock()
+			return
+		}
+		after := b.last
+		b.mu.Unlock()
+
+		var rows []OutboxEvent
+		if err := m.db.Where("seq > ?", after).Order("seq").Limit(outboxBatch).Find(&rows).Error; err != nil {
+			m.lg.Warn().Err(err).Msg("failed to read events for subscribers")
+			continue
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		// Sequence numbers are taken before inserts commit, so a skipped
+		// one is waited for a little; it may also belong to a failed insert.
+		next := after + 1
+		if rows[0].Seq != next {
+			if holeSince.IsZero() {
+				holeSince = time.Now()
+			}
+			if time.Since(holeSince) < tailHoleWait {
+				continue
+			}
+			next = rows[0].Seq
+		}
+		holeSince = time.Time{}
+		n := 0
+		for n < len(rows) && rows[n].Seq == next {
+			n, next = n+1, next+1
+		}
+		m.sendEvents(rows[:n])
+		if n == outboxBatch {
+			select {
+			case m.tailWake <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// sendEvents sends events read from the outbox to all subscribers without
+// blocking. Subscriptions that fell behind are closed.
+func (m *Manager) sendEvents(rows []OutboxEvent) {
+	b := &m.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := range rows {
+		if rows[i].Seq <= b.last {
+			continue
+		}
+		b.last = rows[i].Seq
+		ev, err := rows[i].event()
+		if err != nil {
+			m.lg.Error().Err(err).Uint64("seq", rows[i].Seq).Msg("failed to decode recorded event")
+			continue
+		}
+		for ch := range b.subs {
+			select {
+			case ch <- ev:
+			default:
+				m.lg.Warn().Str("device_id", ev.DeviceID).Str("event", ev.Type).
+					Msg("subscriber too slow, closing its subscription")
+				delete(b.subs, ch)
+				close(ch)
+			}
+		}
+	}
+}
+
+// publish completes ev with its ID, actor and device snapshot and records it
+// in the outbox within tx, from which it reaches subscribers on every
+// replica. tx is the transaction that saves the change behind ev, run
+// through withEvents.
+func (m *Manager) publish(tx *gorm.DB, ev Event) error {
+	ev.ID = rand.ID16()
+	if ev.Actor == "" {
+		ev.Actor = ActorSystem
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	if ev.Device == nil {
+		var dev Device
+		if err := tx.First(&dev, "id = ?", ev.DeviceID).Error; err == nil {
+			ev.Device = &dev
+		}
+	}
+	if ev.Device != nil {
+		snapshot := *ev.Device
+		snapshot.MQTTPassword = ""
+		ev.Device = &snapshot
+	}
+	return recordEvent(tx, ev)
+}
+
+// publishOperation publishes within tx the event of an operation that
+// succeeded.
+func (m *Manager) publishOperation(tx *gorm.DB, op *Operation) error {
+	typ, ok := operationEvents[op.Kind]
+	if !ok {
+		return nil
+	}
+	ev := Event{
+		DeviceID: op.DeviceID,
+		Type:     typ,
+		Actor:    op.Actor,
+		Reason:   fmt.Sprintf("%s operation %s", op.Kind, op.ID),
+	}
+	if op.Kind == OperationPurge {
+		ev.Device = m.tombstone(tx, op.DeviceID)
+	}
+	if ev.Device == nil {
+		var dev Device
+		if err := tx.First(&dev, "id = ?", op.DeviceID).Error; err == nil {
+			ev.Device = &dev
+		}
+	}
+	if ev.Device != nil {
+		ev.Status = ev.Device.Status
+	}
+	return m.publish(tx, ev)
+}
+
+// tombstone returns the device as it was when it was purged, or nil.
+func (m *Manager) tombstone(tx *gorm.DB, deviceID string) *Device {
+	var entry AuditEntry
+	err := tx.Where("device_id = ? AND action = ?", deviceID, AuditActionPurged).
+		Order("created_at DESC").First(&entry).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			m.lg.Warn().Err(err).Str("device_id", deviceID).Msg("failed to read device tombstone")
+		}
+		return nil
+	}
+	var dev Device
+	if err := json.Unmarshal([]byte(entry.Snapshot), &dev); err != nil {
+		return nil
+	}
+	return &dev
+}
+
+// EventStream stores lifecycle events for consumers outside service-io.
+type EventStream interface {
+	// Publish stores data on subject. msgID identifies the message, so a
+	// retried publish is not stored twice.
+	Publish(ctx context.Context, subject, msgID string, data []byte) error
+}
@@ -0,0 +1,303 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"service-io/internal/core/runtime"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrHostNotFound is returned when a host name is not registered.
+	ErrHostNotFound = errors.New("host not found")
+	// ErrHostExists is returned when registering a host name twice.
+	ErrHostExists = errors.New("host already exists")
+	// ErrInvalidHost is returned when a host registration is unusable.
+	ErrInvalidHost = errors.New("invalid host")
+	// ErrHostInUse is returned when removing a host that still has devices.
+	ErrHostInUse = errors.New("host has devices")
+	// ErrNoHostAvailable is returned when no host can take a new device.
+	ErrNoHostAvailable = errors.New("no host available")
+)
+
+// Host is a container engine adapters can be scheduled on.
+type Host struct {
+	Name string `gorm:"primaryKey" json:"name" example:"edge-1"`
+	// Endpoint is a Docker daemon address: tcp://host:2376 or ssh://user@host.
+	Endpoint string `json:"endpoint" example:"tcp://10.0.0.5:2376"`
+	// Paths of the client TLS material for tcp:// endpoints.
+	TLSCACert string `json:"tls_ca_cert,omitempty" example:"/etc/service-io/hosts/edge-1/ca.pem"`
+	TLSCert   string `json:"tls_cert,omitempty" example:"/etc/service-io/hosts/edge-1/cert.pem"`
+	TLSKey    string `json:"tls_key,omitempty" example:"/etc/service-io/hosts/edge-1/key.pem"`
+	// Capacity is the maximum number of adapters on the host; 0 is unlimited.
+	Capacity int    `json:"capacity" example:"50"`
+	Labels   Labels `gorm:"type:jsonb" json:"labels,omitempty" swaggertype:"object,string" example:"site:plant-a"`
+	// Cordoned hosts keep their adapters but receive no new devices.
+	Cordoned  bool      `json:"cordoned"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Devices is the number of devices on the host that are being created or
+	// are meant to run, including exited and crashlooping ones.
+	Devices int `gorm:"-" json:"devices" example:"12"`
+}
+
+// HostUpdate lists the mutable fields of a host. Nil fields are left unchanged.
+type HostUpdate struct {
+	Endpoint  *string
+	TLSCACert *string
+	TLSCert   *string
+	TLSKey    *string
+	Capacity  *int
+	Labels    Labels
+	Cordoned  *bool
+}
+
+// validate checks that the host is usable.
+func (h *Host) validate() error {
+	if h.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidHost)
+	}
+	u, err := url.Parse(h.Endpoint)
+	if err != nil || u.Host == "" && u.Scheme != "unix" {
+		return fmt.Errorf("%w: endpoint %q is not a URL", ErrInvalidHost, h.Endpoint)
+	}
+	switch u.Scheme {
+	case "tcp", "ssh", "unix":
+	default:
+		return fmt.Errorf("%w: endpoint scheme must be tcp, ssh or unix", ErrInvalidHost)
+	}
+	if (h.TLSCert == "") != (h.TLSKey == "") {
+		return fmt.Errorf("%w: tls_cert and tls_key go together", ErrInvalidHost)
+	}
+	if h.Capacity < 0 {
+		return fmt.Errorf("%w: capacity must not be negative", ErrInvalidHost)
+	}
+	if err := h.Labels.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidHost, err)
+	}
+	return nil
+}
+
+// CreateHost registers a host.
+func (m *Manager) CreateHost(ctx context.Context, h Host) (*Host, error) {
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+	res := m.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&h)
+	if res.Error != nil {
+		return nil, fmt.Errorf("create host in db: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrHostExists, h.Name)
+	}
+	m.lg.Info().Str("host", h.Name).Str("endpoint", h.Endpoint).Msg("host registered")
+	return &h, nil
+}
+
+// ListHosts returns all hosts with their current load, by name.
+func (m *Manager) ListHosts(ctx context.Context) ([]Host, error) {
+	var hosts []Host
+	if err := m.db.WithContext(ctx).Order("name").Find(&hosts).Error; err != nil {
+		return nil, err
+	}
+	load, err := hostLoad(m.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	for i := range hosts {
+		hosts[i].Devices = load[hosts[i].Name]
+	}
+	return hosts, nil
+}
+
+// GetHost returns a single host with its current load.
+func (m *Manager) GetHost(ctx context.Context, name string) (*Host, error) {
+	h, err := m.findHost(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	load, err := hostLoad(m.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	h.Devices = load[h.Name]
+	return h, nil
+}
+
+// UpdateHost changes a host. Connection changes apply to the next operation
+// on the host; running adapters are not moved.
+func (m *Manager) UpdateHost(ctx context.Context, name string, upd HostUpdate) (*Host, error) {
+	h, err := m.findHost(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if upd.Endpoint != nil {
+		h.Endpoint = *upd.Endpoint
+	}
+	if upd.TLSCACert != nil {
+		h.TLSCACert = *upd.TLSCACert
+	}
+	if upd.TLSCert != nil {
+		h.TLSCert = *upd.TLSCert
+	}
+	if upd.TLSKey != nil {
+		h.TLSKey = *upd.TLSKey
+	}
+	if upd.Capacity != nil {
+		h.Capacity = *upd.Capacity
+	}
+	if upd.Labels != nil {
+		h.Labels = upd.Labels
+	}
+	if upd.Cordoned != nil {
+		h.Cordoned = *upd.Cordoned
+	}
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+	if err := m.db.WithContext(ctx).Save(h).Error; err != nil {
+		return nil, fmt.Errorf("update host in db: %w", err)
+	}
+	m.forgetHostRuntime(name)
+	return m.GetHost(ctx, name)
+}
+
+// DeleteHost unregisters a host. Hosts with devices that are not deleted
+// cannot be removed.
+func (m *Manager) DeleteHost(ctx context.Context, name string) error {
+	if _, err := m.findHost(ctx, name); err != nil {
+		return err
+	}
+	var n int64
+	err := m.db.WithContext(ctx).Model(&Device{}).
+		Where("host = ? AND status <> ?", name, StatusDeleted).Count(&n).Error
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("%w: %s has %d", ErrHostInUse, name, n)
+	}
+	if err := m.db.WithContext(ctx).Delete(&Host{}, "name = ?", name).Error; err != nil {
+		return fmt.Errorf("delete host from db: %w", err)
+	}
+	m.forgetHostRuntime(name)
+	m.lg.Info().Str("host", name).Msg("host removed")
+	return nil
+}
+
+func (m *Manager) findHost(ctx context.Context, name string) (*Host, error) {
+	var h Host
+	if err := m.db.WithContext(ctx).First(&h, "name = ?", name).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrHostNotFound, name)
+		}
+		return nil, err
+	}
+	return &h, nil
+}
+
+// hostLoad counts the devices occupying a slot on each host.
+func hostLoad(tx *gorm.DB) (map[string]int, error) {
+	var rows []struct {
+		Host  string
+		Count int
+	}
+	err := tx.Model(&Device{}).
+		Select("host, count(*) AS count").
+		Where("host <> '' AND status IN ?", append([]Status{StatusPending}, activeStatuses...)).
+		Group("host").Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("count devices per host: %w", err)
+	}
+	load := make(map[string]int, len(rows))
+	for _, r := range rows {
+		load[r.Host] = r.Count
+	}
+	return load, nil
+}
+
+// schedule picks the host for a new device: among the uncordoned hosts that
+// match placement and have free capacity, the one with the fewest devices.
+// Without any registered host, devices run on the default runtime and nil
+// is returned. The hosts stay locked until tx ends, so the device must be
+// inserted within tx for concurrent placements, on any replica, to count
+// it.
+func schedule(tx *gorm.DB, placement Selector) (*Host, error) {
+	var hosts []Host
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("name").Find(&hosts).Error; err != nil {
+		return nil, fmt.Errorf("lock hosts: %w", err)
+	}
+	load, err := hostLoad(tx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hosts {
+		hosts[i].Devices = load[hosts[i].Name]
+	}
+	if len(hosts) == 0 {
+		if len(placement) > 0 {
+			return nil, fmt.Errorf("%w: placement needs registered hosts", ErrNoHostAvailable)
+		}
+		return nil, nil
+	}
+
+	var fit []Host
+	for _, h := range hosts {
+		if h.Cordoned || !placement.Matches(h.Labels) {
+			continue
+		}
+		if h.Capacity > 0 && h.Devices >= h.Capacity {
+			continue
+		}
+		fit = append(fit, h)
+	}
+	if len(fit) == 0 {
+		return nil, fmt.Errorf("%w: no uncordoned host with free capacity matches the placement", ErrNoHostAvailable)
+	}
+	sort.SliceStable(fit, func(i, j int) bool { return fit[i].Devices < fit[j].Devices })
+	return &fit[0], nil
+}
+
+// runtimeFor returns the runtime of a host, connecting on first use. The
+// empty host is the default runtime.
+func (m *Manager) runtimeFor(ctx context.Context, host string) (runtime.Runtime, error) {
+	if host == "" {
+		return m.rt, nil
+	}
+	m.hostsMu.Lock()
+	rt, ok := m.hostRuntimes[host]
+	m.hostsMu.Unlock()
+	if ok {
+		return rt, nil
+	}
+	if m.opts.HostRuntime == nil {
+		return nil, fmt.Errorf("device is on host %s but no host runtime is configured", host)
+	}
+
+	h, err := m.findHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	rt, err = m.opts.HostRuntime(h)
+	if err != nil {
+		return nil, fmt.Errorf("connect to host %s: %w", host, err)
+	}
+	m.hostsMu.Lock()
+	m.hostRuntimes[host] = rt
+	m.hostsMu.Unlock()
+	return rt, nil
+}
+
+func (m *Manager) forgetHostRuntime(host string) {
+	m.hostsMu.Lock()
+	delete(m.hostRuntimes, host)
+	m.hostsMu.Unlock()
+}
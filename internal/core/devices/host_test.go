@@ -0,0 +1,86 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"service-io/internal/adapters/traefik"
+	"service-io/internal/core/runtime"
+
+	"github.com/rs/zerolog"
+)
+
+func TestScheduleCountsCrashLoopingDevices(t *testing.T) {
+	var env *testEnv
+	env = newTestManager(t, Options{
+		HostRuntime: func(*Host) (runtime.Runtime, error) { return env.rt, nil },
+	})
+	ctx := context.Background()
+	if _, err := env.m.CreateHost(ctx, Host{Name: "edge-1", Endpoint: "tcp://10.0.0.5:2376", Capacity: 1}); err != nil {
+		t.Fatalf("create host: %v", err)
+	}
+	dev := env.addDevice(t, "plc-1")
+	if dev.Host != "edge-1" {
+		t.Fatalf("device scheduled on %q, want edge-1", dev.Host)
+	}
+
+	// A crashlooping device is still restarted, so it keeps its slot.
+	if err := env.m.db.Model(&Device{}).Where("id = ?", dev.ID).Update("status", StatusCrashLooping).Error; err != nil {
+		t.Fatalf("mark crashlooping: %v", err)
+	}
+	h, err := env.m.GetHost(ctx, "edge-1")
+	if err != nil {
+		t.Fatalf("get host: %v", err)
+	}
+	if h.Devices != 1 {
+		t.Errorf("host has %d devices, want 1", h.Devices)
+	}
+	_, err = env.m.AddDevice(ctx, NewDevice{Type: "mqtt", Name: "plc-2"})
+	if !errors.Is(err, ErrNoHostAvailable) {
+		t.Errorf("err = %v, want %v", err, ErrNoHostAvailable)
+	}
+}
+
+func TestScheduleAcrossReplicas(t *testing.T) {
+	env := newTestManager(t, Options{})
+	tc := traefik.New(traefik.Config{BaseDomain: "localhost", Network: "test", Logger: zerolog.Nop()})
+	other, err := New(env.m.db, env.streams, "nats://nats:4222", env.rt, tc, zerolog.Nop(), Options{})
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := env.m.CreateHost(ctx, Host{Name: "edge-1", Endpoint: "tcp://10.0.0.5:2376", Capacity: 2}); err != nil {
+		t.Fatalf("create host: %v", err)
+	}
+
+	// Devices added at once through both replicas do not overfill the host.
+	var wg sync.WaitGroup
+	errs := make([]error, 6)
+	for i := range errs {
+		m := env.m
+		if i%2 == 1 {
+			m = other
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = m.prepareAdd(ctx, NewDevice{Type: "mqtt", Name: fmt.Sprintf("plc-%d", i)})
+		}()
+	}
+	wg.Wait()
+	placed := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			placed++
+		case !errors.Is(err, ErrNoHostAvailable):
+			t.Errorf("add device: %v", err)
+		}
+	}
+	if placed != 2 {
+		t.Errorf("placed %d devices on a host for 2", placed)
+	}
+}
@@ -0,0 +1,100 @@
+package devices
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"service-io/internal/core/runtime"
+)
+
+// ErrInvalidLabels is returned when a device label key or value is malformed.
+var ErrInvalidLabels = errors.New("invalid labels")
+
+// labelNameRe matches the name part of a label key and label values, as in
+// Kubernetes: up to 63 alphanumerics, '-', '_' or '.', starting and ending
+// with an alphanumeric.
+var labelNameRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_.-]{0,61}[A-Za-z0-9])?$`)
+
+// labelPrefixRe matches the optional DNS subdomain prefix of a label key.
+var labelPrefixRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]{0,251}[a-z0-9])?$`)
+
+// Labels is a set of user-defined key/value pairs attached to a device.
+// It is persisted as a JSONB column.
+type Labels map[string]string
+
+// Validate checks that every key and value is well-formed.
+func (l Labels) Validate() error {
+	for k, v := range l {
+		if err := validateLabelKey(k); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidLabels, err)
+		}
+		if v != "" && !labelNameRe.MatchString(v) {
+			return fmt.Errorf("%w: bad value %q for key %q", ErrInvalidLabels, v, k)
+		}
+	}
+	return nil
+}
+
+// validateLabelKey checks a key of the form [prefix/]name.
+func validateLabelKey(key string) error {
+	name := key
+	if prefix, rest, ok := strings.Cut(key, "/"); ok {
+		if !labelPrefixRe.MatchString(prefix) {
+			return fmt.Errorf("bad key prefix %q", prefix)
+		}
+		name = rest
+	}
+	if !labelNameRe.MatchString(name) {
+		return fmt.Errorf("bad key %q", key)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer so GORM can store the map as JSON.
+func (l Labels) Value() (driver.Value, error) {
+	if l == nil {
+		return "{}", nil
+	}
+	raw, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+// Scan implements sql.Scanner for reading the JSONB column back.
+func (l *Labels) Scan(src any) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("labels: unsupported scan type %T", src)
+	}
+	return json.Unmarshal(raw, l)
+}
+
+// containerLabels returns the Docker labels for a device's container: the
+// routing labels, service-io's own bookkeeping labels and the user labels.
+func (d *Device) containerLabels(routing map[string]string) map[string]string {
+	labels := make(map[string]string, len(routing)+len(d.Labels)+3)
+	for k, v := range routing {
+		labels[k] = v
+	}
+	for k, v := range d.Labels {
+		labels[runtime.LabelUserPrefix+k] = v
+	}
+	labels[runtime.LabelManagedBy] = runtime.ManagedByValue
+	labels[runtime.LabelDeviceID] = d.ID
+	labels[runtime.LabelDeviceType] = d.DeviceType
+	return labels
+}
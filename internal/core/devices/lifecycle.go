@@ -0,0 +1,115 @@
+package devices
+
+import (
+	"context"
+	"fmt"
+)
+
+// StartDevice starts the adapter container of a stopped (or pending) device,
+// reusing its stored credentials and stream.
+func (m *Manager) StartDevice(ctx context.Context, deviceID string) (*Device, error) {
+	op, err := m.prepareStart(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	dev, err := m.runDeviceOperation(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+	m.lg.Info().Str("device_id", dev.ID).Msg("device started")
+	return dev, nil
+}
+
+// SubmitStartDevice is StartDevice in the background.
+func (m *Manager) SubmitStartDevice(ctx context.Context, deviceID string) (*Operation, error) {
+	op, err := m.prepareStart(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return m.goOperation(op), nil
+}
+
+func (m *Manager) prepareStart(ctx context.Context, deviceID string) (*Operation, error) {
+	dev, err := m.findDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if dev.Status == StatusRunning {
+		return nil, fmt.Errorf("%w: device is already running", ErrInvalidTransition)
+	}
+	if !dev.Status.CanTransitionTo(StatusRunning) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, dev.Status, StatusRunning)
+	}
+	m.forgetCrashes(dev.ID)
+	return m.recordOperation(ctx, OperationStart, dev.ID)
+}
+
+// StopDevice stops and removes the adapter container of a running device.
+func (m *Manager) StopDevice(ctx context.Context, deviceID string) (*Device, error) {
+	op, err := m.prepareStop(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	dev, err := m.runDeviceOperation(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+	m.lg.Info().Str("device_id", dev.ID).Msg("device stopped")
+	return dev, nil
+}
+
+// SubmitStopDevice is StopDevice in the background.
+func (m *Manager) SubmitStopDevice(ctx context.Context, deviceID string) (*Operation, error) {
+	op, err := m.prepareStop(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return m.goOperation(op), nil
+}
+
+func (m *Manager) prepareStop(ctx context.Context, deviceID string) (*Operation, error) {
+	dev, err := m.findDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := dev.transition(StatusStopped); err != nil {
+		return nil, err
+	}
+	m.forgetCrashes(dev.ID)
+	return m.recordOperation(ctx, OperationStop, dev.ID)
+}
+
+// RestartDevice recreates the adapter container of a running or exited device.
+func (m *Manager) RestartDevice(ctx context.Context, deviceID string) (*Device, error) {
+	op, err := m.prepareRestart(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	dev, err := m.runDeviceOperation(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+	m.lg.Info().Str("device_id", dev.ID).Msg("device restarted")
+	return dev, nil
+}
+
+// SubmitRestartDevice is RestartDevice in the background.
+func (m *Manager) SubmitRestartDevice(ctx context.Context, deviceID string) (*Operation, error) {
+	op, err := m.prepareRestart(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return m.goOperation(op), nil
+}
+
+func (m *Manager) prepareRestart(ctx context.Context, deviceID string) (*Operation, error) {
+	dev, err := m.findDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if !dev.Status.active() {
+		return nil, fmt.Errorf("%w: only running or exited devices can be restarted", ErrInvalidTransition)
+	}
+	m.forgetCrashes(dev.ID)
+	return m.recordOperation(ctx, OperationRestart, dev.ID)
+}
@@ -0,0 +1,119 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStartStopRestart(t *testing.T) {
+	env := newTestManager(t, Options{})
+	dev := env.addDevice(t, "plc-1")
+	ctx := context.Background()
+	events, unsubscribe := env.m.Subscribe()
+	defer unsubscribe()
+
+	stopped, err := env.m.StopDevice(ctx, dev.ID)
+	if err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if stopped.Status != StatusStopped || stopped.ContainerID != "" {
+		t.Errorf("stopped device is %s on %q, want stopped without a container", stopped.Status, stopped.ContainerID)
+	}
+	if n := len(env.rt.Instances()); n != 0 {
+		t.Errorf("%d instances after stop, want 0", n)
+	}
+	if ev := nextEvent(t, events); ev.Type != EventStopped || ev.Status != StatusStopped {
+		t.Errorf("event = %s (%s), want %s", ev.Type, ev.Status, EventStopped)
+	}
+
+	started, err := env.m.StartDevice(ctx, dev.ID)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	inst, ok := env.rt.Instance(started.ContainerID)
+	if started.Status != StatusRunning || !ok || !inst.State.Running {
+		t.Errorf("started device is %s on %q, want running", started.Status, started.ContainerID)
+	}
+	// The stream and the credentials outlive the container.
+	if !env.streams.has(dev.streamName()) || inst.Spec.MQTTPassword != dev.MQTTPassword {
+		t.Errorf("start did not reuse the device's stream and credentials")
+	}
+	if ev := nextEvent(t, events); ev.Type != EventStarted || ev.Status != StatusRunning {
+		t.Errorf("event = %s (%s), want %s", ev.Type, ev.Status, EventStarted)
+	}
+
+	restarted, err := env.m.RestartDevice(ctx, dev.ID)
+	if err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	if restarted.Status != StatusRunning || restarted.ContainerID == started.ContainerID {
+		t.Errorf("restarted device is %s on %q, want running on a new container", restarted.Status, restarted.ContainerID)
+	}
+	if n := len(env.rt.Instances()); n != 1 {
+		t.Errorf("%d instances after restart, want 1", n)
+	}
+	if ev := nextEvent(t, events); ev.Type != EventRestarted {
+		t.Errorf("event = %s, want %s", ev.Type, EventRestarted)
+	}
+}
+
+func TestInvalidTransitions(t *testing.T) {
+	tests := []struct {
+		name   string
+		status Status
+		action func(m *Manager, id string) error
+	}{
+		{"start running", StatusRunning, func(m *Manager, id string) error {
+			_, err := m.StartDevice(context.Background(), id)
+			return err
+		}},
+		{"stop stopped", StatusStopped, func(m *Manager, id string) error {
+			_, err := m.StopDevice(context.Background(), id)
+			return err
+		}},
+		{"restart stopped", StatusStopped, func(m *Manager, id string) error {
+			_, err := m.RestartDevice(context.Background(), id)
+			return err
+		}},
+		{"start deleted", StatusDeleted, func(m *Manager, id string) error {
+			_, err := m.StartDevice(context.Background(), id)
+			return err
+		}},
+		{"stop deleted", StatusDeleted, func(m *Manager, id string) error {
+			_, err := m.StopDevice(context.Background(), id)
+			return err
+		}},
+		{"restart deleted", StatusDeleted, func(m *Manager, id string) error {
+			_, err := m.RestartDevice(context.Background(), id)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestManager(t, Options{})
+			dev := env.addDevice(t, "plc-1")
+			switch tt.status {
+			case StatusStopped:
+				if _, err := env.m.StopDevice(context.Background(), dev.ID); err != nil {
+					t.Fatalf("stop: %v", err)
+				}
+			case StatusDeleted:
+				if err := env.m.RemoveDevice(context.Background(), dev.ID); err != nil {
+					t.Fatalf("remove: %v", err)
+				}
+			}
+			before := env.device(t, dev.ID)
+
+			if err := tt.action(env.m, dev.ID); !errors.Is(err, ErrInvalidTransition) {
+				t.Fatalf("err = %v, want %v", err, ErrInvalidTransition)
+			}
+			if got := env.device(t, dev.ID); got.Status != tt.status || got.ContainerID != before.ContainerID {
+				t.Errorf("device is %s on %q, want it left %s on %q", got.Status, got.ContainerID, tt.status, before.ContainerID)
+			}
+			if err := env.m.checkNoOperation(context.Background(), dev.ID); err != nil {
+				t.Errorf("operation recorded for a rejected transition: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package devices
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidQuery is returned when list options cannot be applied.
+var ErrInvalidQuery = errors.New("invalid list query")
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// sortColumns maps the public sort keys to SQL expressions.
+var sortColumns = map[string]string{
+	"created_at": "created_at",
+	"name":       "COALESCE(name, '')",
+	"type":       "device_type",
+	"status":     "status",
+}
+
+// ListOptions filters, sorts and paginates ListDevices.
+type ListOptions struct {
+	Limit    int    // page size; 0 uses the default
+	Cursor   string // opaque cursor returned as Page.NextCursor
+	Type     string
+	Status   Status
+	Image    string
+	Selector string // label selector, e.g. "env=prod,site in (a,b)"
+	Search   string // case-insensitive substring of the name
+	Sort     string // sort key, prefixed with "-" for descending; defaults to "created_at"
+}
+
+// Page is one page of ListDevices results.
+type Page struct {
+	Devices []Device
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+// cursor is the decoded form of Page.NextCursor. It pins the sort order so a
+// cursor cannot be reused with a different sort.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// ListDevices returns one page of devices matching opts.
+func (m *Manager) ListDevices(ctx context.Context, opts ListOptions) (*Page, error) {
+	sortKey := opts.Sort
+	if sortKey == "" {
+		sortKey = "created_at"
+	}
+	desc := strings.HasPrefix(sortKey, "-")
+	col, ok := sortColumns[strings.TrimPrefix(sortKey, "-")]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown sort key %q", ErrInvalidQuery, sortKey)
+	}
+
+	limit := opts.Limit
+	switch {
+	case limit == 0:
+		limit = defaultPageSize
+	case limit < 0 || limit > maxPageSize:
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, maxPageSize)
+	}
+
+	sel, err := ParseSelector(opts.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := m.db.WithContext(ctx).Model(&Device{})
+	if opts.Type != "" {
+		tx = tx.Where("device_type = ?", opts.Type)
+	}
+	if opts.Status != "" {
+		tx = tx.Where("status = ?", opts.Status)
+	}
+	if opts.Image != "" {
+		tx = tx.Where("image = ?", opts.Image)
+	}
+	if opts.Search != "" {
+		tx = tx.Where("name ILIKE ?", "%"+escapeLike(opts.Search)+"%")
+	}
+	tx = sel.apply(tx)
+
+	if opts.Cursor != "" {
+		c, err := decodeCursor(opts.Cursor)
+		if err != nil || c.Sort != sortKey {
+			return nil, fmt.Errorf("%w: bad cursor", ErrInvalidQuery)
+		}
+		var value any = c.Value
+		if col == "created_at" {
+			if value, err = time.Parse(time.RFC3339Nano, c.Value); err != nil {
+				return nil, fmt.Errorf("%w: bad cursor", ErrInvalidQuery)
+			}
+		}
+		cmp := ">"
+		if desc {
+			cmp = "<"
+		}
+		tx = tx.Where(fmt.Sprintf("(%s, id) %s (?, ?)", col, cmp), value, c.ID)
+	}
+
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	tx = tx.Order(fmt.Sprintf("%s %s, id %s", col, dir, dir))
+
+	// Fetch one extra row to learn whether another page exists.
+	var devices []Device
+	if err := tx.Limit(limit + 1).Find(&devices).Error; err != nil {
+		return nil, err
+	}
+
+	page := &Page{Devices: devices}
+	if len(devices) > limit {
+		page.Devices = devices[:limit]
+		last := page.Devices[limit-1]
+		page.NextCursor = encodeCursor(cursor{
+			Sort:  sortKey,
+			Value: sortValue(&last, strings.TrimPrefix(sortKey, "-")),
+			ID:    last.ID,
+		})
+	}
+	return page, nil
+}
+
+func sortValue(d *Device, key string) string {
+	switch key {
+	case "name":
+		return d.Name
+	case "type":
+		return d.DeviceType
+	case "status":
+		return string(d.Status)
+	default:
+		return d.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+func encodeCursor(c cursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(raw, &c)
+	return c, err
+}
+
+// escapeLike escapes the LIKE wildcards in a user-supplied search term.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
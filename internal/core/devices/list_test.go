@@ -0,0 +1,96 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestListDevicesCursor(t *testing.T) {
+	env := newTestManager(t, Options{})
+	var added []*Device
+	for _, name := range []string{"plc-c", "plc-a", "plc-e", "plc-b", "plc-d"} {
+		added = append(added, env.addDevice(t, name))
+	}
+	byName := slices.Clone(added)
+	sort.Slice(byName, func(i, j int) bool { return byName[i].Name < byName[j].Name })
+	ids := func(devs []*Device) []string {
+		var out []string
+		for _, d := range devs {
+			out = append(out, d.ID)
+		}
+		return out
+	}
+	reversed := func(s []string) []string {
+		s = slices.Clone(s)
+		slices.Reverse(s)
+		return s
+	}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"created_at", ids(added)},
+		{"-created_at", reversed(ids(added))},
+		{"name", ids(byName)},
+		{"-name", reversed(ids(byName))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			var got []string
+			opts := ListOptions{Limit: 2, Sort: tt.sort}
+			for pages := 0; ; pages++ {
+				if pages > len(added) {
+					t.Fatalf("cursor does not advance")
+				}
+				page, err := env.m.ListDevices(context.Background(), opts)
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				for _, d := range page.Devices {
+					got = append(got, d.ID)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				opts.Cursor = page.NextCursor
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListDevicesInvalidQuery(t *testing.T) {
+	env := newTestManager(t, Options{})
+	env.addDevice(t, "plc-a")
+	env.addDevice(t, "plc-b")
+	page, err := env.m.ListDevices(context.Background(), ListOptions{Limit: 1})
+	if err != nil || page.NextCursor == "" {
+		t.Fatalf("list = %+v, %v, want a next page", page, err)
+	}
+
+	tests := []struct {
+		name string
+		opts ListOptions
+	}{
+		{"unknown sort", ListOptions{Sort: "host"}},
+		{"negative limit", ListOptions{Limit: -1}},
+		{"limit too large", ListOptions{Limit: maxPageSize + 1}},
+		{"garbled cursor", ListOptions{Cursor: "not-a-cursor"}},
+		{"cursor of another sort", ListOptions{Cursor: page.NextCursor, Sort: "name"}},
+		{"bad selector", ListOptions{Selector: "env in (a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := env.m.ListDevices(context.Background(), tt.opts)
+			if !errors.Is(err, ErrInvalidQuery) && !errors.Is(err, ErrInvalidSelector) {
+				t.Errorf("err = %v, want an invalid query", err)
+			}
+		})
+	}
+}
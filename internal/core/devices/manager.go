@@ -4,11 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	ncore "service-io/internal/adapters/nats"
+	"maps"
+	"net/http"
 	"service-io/internal/adapters/traefik"
+	"strings"
+	"sync"
 	"time"
 
-	"service-io/internal/core/docker"
+	"service-io/internal/core/runtime"
 	"service-io/pkg/rand"
 
 	"github.com/rs/zerolog"
@@ -16,40 +19,194 @@ import (
 )
 
 type Manager struct {
-	db         *gorm.DB
-	nc         *ncore.Client
-	docker     *docker.Client
-	traefik    *traefik.Client
-	natsURL    string
-	adapterMap map[string]string
-	lg         zerolog.Logger
+	db      *gorm.DB
+	nc      Streams
+	rt      runtime.Runtime
+	traefik *traefik.Client
+	natsURL string
+	opts    Options
+	lg      zerolog.Logger
+
+	hostsMu      sync.Mutex
+	hostRuntimes map[string]runtime.Runtime
+
+	// reconcileMu keeps reconcile passes from overlapping.
+	reconcileMu sync.Mutex
+	reportMu    sync.Mutex
+	lastReport  *ReconcileReport
+
+	events eventBus
+	// outboxWake and tailWake are signalled when an event was recorded.
+	outboxWake chan struct{}
+	tailWake   chan struct{}
+
+	crashMu sync.Mutex
+	crashes map[string]*crashHistory
+
+	bootMu sync.Mutex
+	boot   *BootReport
+
+	// running holds the cancel functions of the operations this replica runs.
+	opMu    sync.Mutex
+	running map[string]context.CancelCauseFunc
+}
+
+// Streams manages the per-device JetStream streams. It is implemented by
+// the NATS adapter.
+type Streams interface {
+	EnsureStream(subject, name string) error
+	DeleteStream(name string) error
+	StreamNames() ([]string, error)
+}
+
+// Options tunes the behaviour of a Manager.
+type Options struct {
+	// RequireImageContract rejects adapter images that declare no
+	// io.scadable.adapter.* labels.
+	RequireImageContract bool
+
+	// HostRuntime connects to a registered host. Without it, devices can
+	// only run on the default runtime.
+	HostRuntime func(*Host) (runtime.Runtime, error)
+
+	// A device whose container exits CrashLoopThreshold times within
+	// CrashLoopWindow is crashlooping. Restarts are delayed by RestartBackoff,
+	// doubling with every exit in the window up to MaxRestartBackoff.
+	CrashLoopThreshold int
+	CrashLoopWindow    time.Duration
+	RestartBackoff     time.Duration
+	MaxRestartBackoff  time.Duration
+
+	// RestartRunningDevices restores up to BootParallelism devices at once,
+	// giving each BootDeviceTimeout. Devices matching an earlier
+	// BootPrioritySelectors entry go first, then those of an earlier
+	// BootPriorityTypes entry.
+	BootParallelism       int
+	BootDeviceTimeout     time.Duration
+	BootPrioritySelectors []Selector
+	BootPriorityTypes     []string
+
+	// IsLeader reports whether this replica manages the adapter fleet. Nil
+	// means it always does.
+	IsLeader func() bool
+
+	// EventPublishTimeout bounds each attempt of ForwardEvents to publish
+	// an event.
+	EventPublishTimeout time.Duration
+
+	// WebhookClient posts webhook deliveries. A delivery is attempted up
+	// to WebhookMaxAttempts times, waiting WebhookBackoff after the first
+	// failure and doubling up to WebhookMaxBackoff.
+	WebhookClient      *http.Client
+	WebhookMaxAttempts int
+	WebhookBackoff     time.Duration
+	WebhookMaxBackoff  time.Duration
+}
+
+// setDefaults fills in unset options.
+func (o *Options) setDefaults() {
+	if o.CrashLoopThreshold <= 0 {
+		o.CrashLoopThreshold = 5
+	}
+	if o.CrashLoopWindow <= 0 {
+		o.CrashLoopWindow = 10 * time.Minute
+	}
+	if o.RestartBackoff <= 0 {
+		o.RestartBackoff = time.Second
+	}
+	if o.MaxRestartBackoff <= 0 {
+		o.MaxRestartBackoff = 5 * time.Minute
+	}
+	if o.BootParallelism <= 0 {
+		o.BootParallelism = 8
+	}
+	if o.BootDeviceTimeout <= 0 {
+		o.BootDeviceTimeout = 5 * time.Minute
+	}
+	if o.EventPublishTimeout <= 0 {
+		o.EventPublishTimeout = 5 * time.Second
+	}
+	if o.WebhookClient == nil {
+		o.WebhookClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if o.WebhookMaxAttempts <= 0 {
+		o.WebhookMaxAttempts = 8
+	}
+	if o.WebhookBackoff <= 0 {
+		o.WebhookBackoff = 10 * time.Second
+	}
+	if o.WebhookMaxBackoff <= 0 {
+		o.WebhookMaxBackoff = time.Hour
+	}
 }
 
 func New(
 	db *gorm.DB,
-	nc *ncore.Client,
+	nc Streams,
 	natsURL string,
-	adapterMap map[string]string,
-	dcli *docker.Client,
+	rt runtime.Runtime,
 	traefikClient *traefik.Client,
 	lg zerolog.Logger,
+	opts Options,
 ) (*Manager, error) {
+	opts.setDefaults()
 	return &Manager{
-		db:         db,
-		nc:         nc,
-		docker:     dcli,
-		traefik:    traefikClient,
-		natsURL:    natsURL,
-		adapterMap: adapterMap,
-		lg:         lg.With().Str("component", "manager").Logger(),
+		db:      db,
+		nc:      nc,
+		rt:      rt,
+		traefik: traefikClient,
+		natsURL: natsURL,
+		opts:    opts,
+		lg:      lg.With().Str("component", "manager").Logger(),
+
+		hostRuntimes: make(map[string]runtime.Runtime),
+		crashes:      make(map[string]*crashHistory),
+		running:      make(map[string]context.CancelCauseFunc),
+		outboxWake:   make(chan struct{}, 1),
+		tailWake:     make(chan struct{}, 1),
 	}, nil
 }
 
-// AddDevice -> create DB record, NATS stream, and then the adapter container.
-func (m *Manager) AddDevice(ctx context.Context, devType string) (*Device, error) {
-	img, ok := m.adapterMap[devType]
-	if !ok {
-		return nil, fmt.Errorf("unsupported device type %q", devType)
+// AddDevice -> create DB record, NATS stream, and then the adapter container,
+// as a create operation.
+func (m *Manager) AddDevice(ctx context.Context, spec NewDevice) (*Device, error) {
+	op, err := m.prepareAdd(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	return m.runDeviceOperation(ctx, op)
+}
+
+// SubmitAddDevice is AddDevice returning as soon as the device is recorded,
+// with the operation creating it in the background.
+func (m *Manager) SubmitAddDevice(ctx context.Context, spec NewDevice) (*Operation, error) {
+	op, err := m.prepareAdd(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	return m.goOperation(op), nil
+}
+
+// prepareAdd validates a new device, schedules it and records it together
+// with the operation creating it.
+func (m *Manager) prepareAdd(ctx context.Context, spec NewDevice) (*Operation, error) {
+	devType := spec.Type
+	adapter, err := m.GetAdapterType(ctx, devType)
+	if err != nil {
+		return nil, err
+	}
+	if adapter.Deprecated {
+		return nil, fmt.Errorf("%w: %s", ErrAdapterTypeDeprecated, devType)
+	}
+	if err := spec.Labels.Validate(); err != nil {
+		return nil, err
+	}
+	if err := validateCatalogConfig(adapter, spec.Config); err != nil {
+		return nil, err
+	}
+	placement, err := ParseSelector(spec.Placement)
+	if err != nil {
+		return nil, err
 	}
 
 	var devID string
@@ -68,142 +225,343 @@ func (m *Manager) AddDevice(ctx context.Context, devType string) (*Device, error
 
 	dev := &Device{
 		ID:            devID,
+		Name:          spec.Name,
+		Description:   spec.Description,
+		Labels:        spec.Labels,
+		Config:        spec.Config,
 		DeviceType:    devType,
-		Image:         img,
+		Image:         adapter.Image,
 		NatsSubject:   fmt.Sprintf("devices.%s.telemetry", devID),
 		ContainerName: "adapter-" + devID,
-		Status:        "running",
+		Placement:     spec.Placement,
+		Status:        StatusPending,
 		CreatedAt:     time.Now().UTC(),
 	}
 
-	// If it's an MQTT adapter, generate and set credentials.
-	if devType == "mqtt" {
-		dev.MQTTUser = devID // Use the device ID as the username
-		dev.MQTTPassword = rand.Password(16)
+	if dev.Config != nil {
+		dev.ConfigVersion = 1
 	}
-
-	// Generate Traefik config
-	labels, url := m.traefik.GenerateConfigForContainer(dev.ContainerName, dev.ID, "1883")
-	dev.ContainerURL = url
-
-	streamName := "DEV_" + dev.ID
-	if err := m.nc.EnsureStream(dev.NatsSubject, streamName); err != nil {
-		return nil, fmt.Errorf("ensure nats stream: %w", err)
+	// The record is inserted together with the operation creating the
+	// device, so a crash at any later step is resumed or compensated, and in
+	// the transaction that placed it, so it counts towards its host.
+	op := m.newOperation(ctx, OperationCreate, dev.ID, 1)
+	err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		host, err := schedule(tx, placement)
+		if err != nil {
+			return err
+		}
+		if host != nil {
+			dev.Host = host.Name
+		}
+		if err := tx.Create(dev).Error; err != nil {
+			return err
+		}
+		if dev.Config != nil {
+			if err := recordRevision(tx, dev); err != nil {
+				return err
+			}
+		}
+		return tx.Create(op).Error
+	})
+	if errors.Is(err, ErrNoHostAvailable) {
+		return nil, err
 	}
-
-	if err := m.db.Create(dev).Error; err != nil {
+	if err != nil {
 		return nil, fmt.Errorf("create device record in db: %w", err)
 	}
+	if dev.Host != "" {
+		m.lg.Info().Str("device_id", dev.ID).Str("host", dev.Host).Msg("device scheduled")
+	}
+	return op, nil
+}
 
-	// Pass MQTT credentials to RunAdapter. They will be empty for non-MQTT types.
-	containerID, err := m.docker.RunAdapter(ctx, dev.ID, dev.Image, m.natsURL, dev.MQTTUser, dev.MQTTPassword, labels)
+// GetDevice returns a device merged with the live state of its container.
+func (m *Manager) GetDevice(ctx context.Context, deviceID string) (*DeviceDetails, error) {
+	dev, err := m.findDevice(deviceID)
 	if err != nil {
-		m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to start container, rolling back")
-		if delErr := m.nc.DeleteStream(streamName); delErr != nil {
-			m.lg.Error().Err(delErr).Str("stream_name", streamName).Msg("rollback failed to delete nats stream")
-		}
-		if delErr := m.db.Delete(dev).Error; delErr != nil {
-			m.lg.Error().Err(delErr).Str("device_id", dev.ID).Msg("rollback failed to delete db record")
-		}
-		return nil, fmt.Errorf("start adapter container: %w", err)
+		return nil, err
 	}
 
-	dev.ContainerID = containerID
-	if err := m.db.Save(dev).Error; err != nil {
-		m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to save container id to db")
+	details := &DeviceDetails{Device: *dev}
+	state, err := m.inspectContainer(ctx, dev)
+	if err != nil {
+		// The stored record is still useful without the live state.
+		m.lg.Warn().Err(err).Str("device_id", deviceID).Msg("failed to inspect device container")
+		return details, nil
 	}
-
-	return dev, nil
+	details.Container = state
+	return details, nil
 }
 
-// RestartRunningDevices finds all devices with "running" status and starts them.
-func (m *Manager) RestartRunningDevices(ctx context.Context) error {
-	m.lg.Info().Msg("restarting any previously running devices...")
-	var runningDevices []Device
-	if err := m.db.Where("status = ?", "running").Find(&runningDevices).Error; err != nil {
-		return fmt.Errorf("could not query running devices: %w", err)
+// UpdateDevice applies the mutable fields in upd to a device. Changing the
+// image or config of a running device recreates its container; if the new
+// container fails to start, the previous image and config are restored. It
+// fails with ErrOperationInProgress while an operation runs on the device,
+// and with ErrConflict if the device changed status or config meanwhile.
+func (m *Manager) UpdateDevice(ctx context.Context, deviceID string, upd DeviceUpdate) (*Device, error) {
+	dev, err := m.findDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkNoOperation(ctx, deviceID); err != nil {
+		return nil, err
 	}
 
-	for _, dev := range runningDevices {
-		m.lg.Info().Str("device_id", dev.ID).Msg("restarting device")
+	// Only the columns the update may change are saved, so that a
+	// concurrent status change is not overwritten.
+	columns := []string{"name", "description", "labels"}
+	var changed []string
+	if upd.Name != nil && *upd.Name != dev.Name {
+		dev.Name = *upd.Name
+		changed = append(changed, "name")
+	}
+	if upd.Description != nil && *upd.Description != dev.Description {
+		dev.Description = *upd.Description
+		changed = append(changed, "description")
+	}
+	if upd.Labels != nil {
+		if err := upd.Labels.Validate(); err != nil {
+			return nil, err
+		}
+		if !maps.Equal(upd.Labels, dev.Labels) {
+			changed = append(changed, "labels")
+		}
+		dev.Labels = upd.Labels
+	}
 
-		// Regenerate Traefik config for the restarting container.
-		labels, url := m.traefik.GenerateConfigForContainer(dev.ContainerName, dev.ID, "1883")
-		dev.ContainerURL = url // Update the URL in case the domain config changed.
+	prev := *dev
+	recreate := false
+	if upd.Image != nil && *upd.Image != dev.Image {
+		if *upd.Image == "" {
+			return nil, fmt.Errorf("%w: image must not be empty", ErrInvalidUpdate)
+		}
+		dev.Image = *upd.Image
+		dev.ImageDigest = "" // resolved again from the new tag
+		recreate = true
+		changed = append(changed, "image")
+		columns = append(columns, "image", "image_digest")
+	}
+	configChanged := upd.Config != nil && !upd.Config.equal(dev.Config)
+	if configChanged {
+		if err := validateCatalogConfig(m.deviceAdapterType(ctx, dev), upd.Config); err != nil {
+			return nil, err
+		}
+		dev.Config = upd.Config
+		dev.ConfigVersion++
+		recreate = true
+		changed = append(changed, "config")
+		columns = append(columns, "config", "config_version")
+	}
 
-		// Pass the generated labels and credentials to the RunAdapter function.
-		containerID, err := m.docker.RunAdapter(ctx, dev.ID, dev.Image, m.natsURL, dev.MQTTUser, dev.MQTTPassword, labels)
+	if recreate {
+		// A new image may declare a different contract, so check the
+		// (possibly unchanged) config against it too.
+		rt, err := m.runtimeFor(ctx, dev.Host)
 		if err != nil {
-			m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to restart device container")
-			dev.Status = "stopped"
-		} else {
-			dev.ContainerID = containerID
+			return nil, err
 		}
+		profile, err := m.resolveAdapter(ctx, rt, m.deviceAdapterType(ctx, dev), dev.imageRef(), false)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateConfig(dev.DeviceType, profile.schema, dev.Config); err != nil {
+			return nil, err
+		}
+	}
 
-		if err := m.db.Save(&dev).Error; err != nil {
-			m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to update device record after restart attempt")
+	if recreate && dev.Status == StatusRunning {
+		m.lg.Info().Str("device_id", dev.ID).Str("image", dev.Image).
+			Int("config_version", dev.ConfigVersion).Msg("adapter changed, recreating container")
+		if err := m.runContainer(ctx, dev); err != nil {
+			m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("recreate failed, restoring previous adapter")
+			if rbErr := m.runContainer(ctx, &prev); rbErr != nil {
+				m.lg.Error().Err(rbErr).Str("device_id", dev.ID).Msg("failed to restore previous adapter")
+			} else if _, saveErr := m.saveDeviceIf(ctx, &prev, []Status{prev.Status}, containerColumns...); saveErr != nil {
+				m.lg.Error().Err(saveErr).Str("device_id", dev.ID).Msg("failed to save restored container id")
+			}
+			return nil, fmt.Errorf("recreate adapter container: %w", err)
 		}
+		columns = append(columns, containerColumns...)
 	}
-	m.lg.Info().Int("count", len(runningDevices)).Msg("device restart process complete")
-	return nil
+
+	err = m.withEvents(ctx, func(tx *gorm.DB) error {
+		res := tx.Model(dev).Where("status = ? AND config_version = ?", prev.Status, prev.ConfigVersion).
+			Select(columns).Updates(dev)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("%w: %s", ErrConflict, dev.ID)
+		}
+		if configChanged {
+			if err := recordRevision(tx, dev); err != nil {
+				return err
+			}
+		}
+		if len(changed) == 0 {
+			return nil
+		}
+		return m.publish(tx, Event{DeviceID: dev.ID, Type: EventUpdated, Status: dev.Status, Device: dev,
+			Actor: ActorFrom(ctx), Reason: "changed " + strings.Join(changed, ", ")})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("update device record in db: %w", err)
+	}
+	return dev, nil
 }
 
-// ... (rest of the file is unchanged) ...
-// RemoveDevice stops the container and marks the device as "stopped".
+// RemoveDevice stops the container and marks the device as "deleted", as a
+// delete operation. The record and its stream are kept.
 func (m *Manager) RemoveDevice(ctx context.Context, deviceID string) error {
-	var dev Device
-	if err := m.db.First(&dev, "id = ?", deviceID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("device with ID '%s' not found", deviceID)
-		}
+	op, err := m.prepareRemove(ctx, deviceID)
+	if err != nil || op == nil {
 		return err
 	}
-
-	containerIdentifier := dev.ContainerID
-	if containerIdentifier == "" {
-		containerIdentifier = dev.ContainerName
+	if err := m.runOperation(ctx, op); err != nil {
+		return err
 	}
+	m.lg.Info().Str("device_id", deviceID).Msg("device deleted successfully")
+	return nil
+}
 
-	if err := m.docker.StopAndRemoveContainer(ctx, containerIdentifier); err != nil {
-		m.lg.Error().Err(err).Str("device_id", deviceID).Msg("failed to stop/remove container, proceeding to update status")
+// SubmitRemoveDevice is RemoveDevice in the background. It returns a nil
+// operation if the device is already deleted.
+func (m *Manager) SubmitRemoveDevice(ctx context.Context, deviceID string) (*Operation, error) {
+	op, err := m.prepareRemove(ctx, deviceID)
+	if err != nil || op == nil {
+		return nil, err
 	}
+	return m.goOperation(op), nil
+}
 
-	dev.Status = "stopped"
-	if err := m.db.Save(&dev).Error; err != nil {
-		return fmt.Errorf("failed to update device status to stopped: %w", err)
+func (m *Manager) prepareRemove(ctx context.Context, deviceID string) (*Operation, error) {
+	dev, err := m.findDevice(deviceID)
+	if err != nil {
+		return nil, err
 	}
-
-	m.lg.Info().Str("device_id", deviceID).Msg("device stopped successfully")
-	return nil
+	if dev.Status == StatusDeleted {
+		return nil, nil
+	}
+	if err := dev.transition(StatusDeleted); err != nil {
+		return nil, err
+	}
+	op, err := m.recordOperation(ctx, OperationDelete, dev.ID)
+	if err != nil {
+		return nil, err
+	}
+	// A pending restart must not bring the adapter back.
+	m.forgetCrashes(dev.ID)
+	return op, nil
 }
 
 // CleanupAdapters stops all managed containers.
 func (m *Manager) CleanupAdapters(ctx context.Context) error {
 	m.lg.Info().Msg("cleaning up all adapter containers")
-	devices, err := m.ListDevices()
-	if err != nil {
+	var runningDevices []Device
+	if err := m.db.Where("status IN ?", activeStatuses).Find(&runningDevices).Error; err != nil {
 		return fmt.Errorf("could not list devices for cleanup: %w", err)
 	}
 
-	for _, dev := range devices {
-		if dev.Status == "running" {
-			containerIdentifier := dev.ContainerID
-			if containerIdentifier == "" {
-				containerIdentifier = dev.ContainerName
-			}
-			if err := m.docker.StopAndRemoveContainer(ctx, containerIdentifier); err != nil {
-				m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed during cleanup")
-			}
+	for _, dev := range runningDevices {
+		if err := m.stopContainer(ctx, &dev); err != nil {
+			m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed during cleanup")
 		}
 	}
 	m.lg.Info().Msg("adapter cleanup complete")
 	return nil
 }
 
-func (m *Manager) ListDevices() ([]Device, error) {
-	var devices []Device
-	if err := m.db.Find(&devices).Error; err != nil {
+// Ping checks that the database is reachable.
+func (m *Manager) Ping(ctx context.Context) error {
+	return m.db.WithContext(ctx).Exec("SELECT 1").Error
+}
+
+// findDevice loads a device record, mapping a missing row to ErrNotFound.
+func (m *Manager) findDevice(deviceID string) (*Device, error) {
+	var dev Device
+	if err := m.db.First(&dev, "id = ?", deviceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, deviceID)
+		}
+		return nil, err
+	}
+	return &dev, nil
+}
+
+// containerColumns are the device columns runContainer sets.
+var containerColumns = []string{"container_id", "container_url", "image_digest", "health"}
+
+// saveDeviceIf saves columns of dev unless the device left the statuses in
+// from since it was read, e.g. because it was stopped or deleted
+// meanwhile, and reports whether it saved them.
+func (m *Manager) saveDeviceIf(ctx context.Context, dev *Device, from []Status, columns ...string) (bool, error) {
+	res := m.db.WithContext(ctx).Model(dev).Where("status IN ?", from).Select(columns).Updates(dev)
+	if res.Error != nil {
+		return false, fmt.Errorf("update device record in db: %w", res.Error)
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// runContainer (re)creates the adapter container for a device and records
+// the new container ID, public URL and image digest on it. The record is
+// not saved.
+func (m *Manager) runContainer(ctx context.Context, dev *Device) error {
+	rt, err := m.runtimeFor(ctx, dev.Host)
+	if err != nil {
+		return err
+	}
+	profile, err := m.resolveAdapter(ctx, rt, m.deviceAdapterType(ctx, dev), dev.imageRef(), false)
+	if err != nil {
+		return err
+	}
+
+	// Regenerate Traefik config in case the domain or the adapter's port changed.
+	route, url := m.traefik.RouteForDevice(dev.ID, profile.port, profile.tls)
+	labels := dev.containerLabels(m.traefik.DockerLabels(dev.ContainerName, route))
+
+	// Run replaces the current container, which must not count as a crash.
+	m.expectExit(dev.ContainerID)
+	// MQTT credentials will be empty for non-MQTT types.
+	containerID, err := rt.Run(ctx, runtime.AdapterSpec{
+		Name:          dev.ContainerName,
+		DeviceID:      dev.ID,
+		Image:         profile.digest,
+		NATSURL:       m.natsURL,
+		NATSSubject:   dev.NatsSubject,
+		MQTTUser:      dev.MQTTUser,
+		MQTTPassword:  dev.MQTTPassword,
+		Labels:        labels,
+		Route:         route,
+		Config:        dev.Config,
+		ConfigVersion: dev.ConfigVersion,
+	})
+	if err != nil {
+		return err
+	}
+	dev.ContainerID = containerID
+	dev.ContainerURL = url
+	dev.ImageDigest = profile.digest
+	// Health is reported per container; the new one has not been checked yet.
+	dev.Health = ""
+	return nil
+}
+
+// stopContainer stops and removes a device's container on its host.
+func (m *Manager) stopContainer(ctx context.Context, dev *Device) error {
+	rt, err := m.runtimeFor(ctx, dev.Host)
+	if err != nil {
+		return err
+	}
+	m.expectExit(dev.ContainerID)
+	return rt.Stop(ctx, dev.containerRef())
+}
+
+// inspectContainer returns the live state of a device's container on its
+// host, or nil if there is none.
+func (m *Manager) inspectContainer(ctx context.Context, dev *Device) (*runtime.State, error) {
+	rt, err := m.runtimeFor(ctx, dev.Host)
+	if err != nil {
 		return nil, err
 	}
-	return devices, nil
+	return rt.Inspect(ctx, dev.containerRef())
 }
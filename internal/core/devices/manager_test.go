@@ -0,0 +1,506 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"service-io/internal/adapters/traefik"
+	"service-io/internal/core/runtime"
+	"service-io/internal/core/runtime/fake"
+
+	"github.com/glebarez/sqlite"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	gormlog "gorm.io/gorm/logger"
+)
+
+const testImage = "registry.example.com/adapter-mqtt:1"
+
+// fakeStreams is an in-memory Streams.
+type fakeStreams struct {
+	mu      sync.Mutex
+	streams map[string]string // name -> subject
+}
+
+func (s *fakeStreams) EnsureStream(subject, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.streams == nil {
+		s.streams = make(map[string]string)
+	}
+	s.streams[name] = subject
+	return nil
+}
+
+func (s *fakeStreams) DeleteStream(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.streams, name)
+	return nil
+}
+
+func (s *fakeStreams) StreamNames() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.streams))
+	for name := range s.streams {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (s *fakeStreams) has(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.streams[name]
+	return ok
+}
+
+// testDB returns a private in-memory database with the service-io schema.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", name)), &gorm.Config{
+		Logger: gormlog.Discard,
+	})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	// A single connection keeps the in-memory database alive and serialises
+	// writers, which SQLite cannot run concurrently.
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	err = db.AutoMigrate(
+		&Device{},
+		&AuditEntry{},
+		&ConfigRevision{},
+		&AdapterType{},
+		&Host{},
+		&Operation{},
+		&Webhook{},
+		&WebhookDelivery{},
+		&ExpectedExit{},
+		&OutboxEvent{},
+	)
+	if err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	return db
+}
+
+type testEnv struct {
+	m       *Manager
+	rt      *fake.Runtime
+	streams *fakeStreams
+}
+
+// newTestManager returns a Manager on the fake runtime with the mqtt type
+// in its catalog, running testImage.
+func newTestManager(t *testing.T, opts Options) *testEnv {
+	t.Helper()
+	env := &testEnv{rt: fake.New(), streams: &fakeStreams{}}
+	tc := traefik.New(traefik.Config{BaseDomain: "localhost", Network: "test", Logger: zerolog.Nop()})
+	m, err := New(testDB(t), env.streams, "nats://nats:4222", env.rt, tc, zerolog.Nop(), opts)
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	env.m = m
+	t.Cleanup(m.forgetAllCrashes)
+	if _, err := m.CreateAdapterType(context.Background(), AdapterType{Name: "mqtt", Image: testImage}); err != nil {
+		t.Fatalf("create adapter type: %v", err)
+	}
+	return env
+}
+
+func (env *testEnv) addDevice(t *testing.T, name string) *Device {
+	t.Helper()
+	dev, err := env.m.AddDevice(context.Background(), NewDevice{Type: "mqtt", Name: name})
+	if err != nil {
+		t.Fatalf("add device %s: %v", name, err)
+	}
+	return dev
+}
+
+func (env *testEnv) device(t *testing.T, id string) *Device {
+	t.Helper()
+	dev, err := env.m.findDevice(id)
+	if err != nil {
+		t.Fatalf("find device %s: %v", id, err)
+	}
+	return dev
+}
+
+// die reports the exit of a device's current container to the manager, as
+// the runtime watcher would.
+func (env *testEnv) die(t *testing.T, dev *Device) {
+	t.Helper()
+	inst, ok := env.rt.Instance(dev.ContainerID)
+	if !ok {
+		t.Fatalf("device %s has no instance %s", dev.ID, dev.ContainerID)
+	}
+	ev := runtime.Event{ID: inst.ID, Name: inst.Spec.Name, DeviceID: dev.ID, Action: runtime.EventDie,
+		ExitCode: inst.State.ExitCode, Time: time.Now().UTC()}
+	if err := env.m.applyRuntimeEvent(context.Background(), dev.Host, ev, false); err != nil {
+		t.Fatalf("apply die event: %v", err)
+	}
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAddDevice(t *testing.T) {
+	env := newTestManager(t, Options{})
+	events, unsubscribe := env.m.Subscribe()
+	defer unsubscribe()
+
+	dev := env.addDevice(t, "plc-1")
+	if dev.Status != StatusRunning {
+		t.Errorf("status = %s, want %s", dev.Status, StatusRunning)
+	}
+	if dev.MQTTUser != dev.ID || dev.MQTTPassword == "" {
+		t.Errorf("mqtt credentials not generated: user %q", dev.MQTTUser)
+	}
+	if !strings.HasPrefix(dev.ImageDigest, testImage+"@sha256:") {
+		t.Errorf("image digest = %q, want %s pinned", dev.ImageDigest, testImage)
+	}
+	if !env.streams.has(dev.streamName()) {
+		t.Errorf("stream %s not created", dev.streamName())
+	}
+
+	inst, ok := env.rt.Instance(dev.ContainerID)
+	if !ok {
+		t.Fatalf("no instance %s", dev.ContainerID)
+	}
+	if !inst.State.Running || inst.Spec.Image != dev.ImageDigest || inst.Spec.DeviceID != dev.ID {
+		t.Errorf("instance = %+v, want running %s for %s", inst, dev.ImageDigest, dev.ID)
+	}
+	if inst.Spec.Labels[runtime.LabelManagedBy] != runtime.ManagedByValue {
+		t.Errorf("instance not labelled as managed: %v", inst.Spec.Labels)
+	}
+
+	select {
+	case ev := <-events:
+		if ev.Type != EventCreated || ev.DeviceID != dev.ID || ev.Status != StatusRunning {
+			t.Errorf("event = %s %s %s, want %s %s %s", ev.Type, ev.DeviceID, ev.Status, EventCreated, dev.ID, StatusRunning)
+		}
+		if ev.Device == nil || ev.Device.MQTTPassword != "" {
+			t.Errorf("event device snapshot missing or carrying the mqtt password")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("no event published")
+	}
+}
+
+func TestAddDeviceUndoneWhenAdapterFails(t *testing.T) {
+	env := newTestManager(t, Options{})
+	runErr := errors.New("no space left on device")
+	env.rt.FailRun(testImage, runErr)
+
+	_, err := env.m.AddDevice(context.Background(), NewDevice{Type: "mqtt", Name: "plc-1"})
+	if !errors.Is(err, runErr) {
+		t.Fatalf("err = %v, want %v", err, runErr)
+	}
+
+	var count int64
+	env.m.db.Model(&Device{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d device records left, want none", count)
+	}
+	if names, _ := env.streams.StreamNames(); len(names) != 0 {
+		t.Errorf("streams left: %v", names)
+	}
+	if n := len(env.rt.Instances()); n != 0 {
+		t.Errorf("%d instances left, want none", n)
+	}
+
+	var op Operation
+	if err := env.m.db.First(&op).Error; err != nil {
+		t.Fatalf("load operation: %v", err)
+	}
+	if op.Status != OperationFailed {
+		t.Errorf("operation status = %s, want %s", op.Status, OperationFailed)
+	}
+}
+
+func TestAddDeviceTimesOutOnSlowStart(t *testing.T) {
+	env := newTestManager(t, Options{})
+	env.rt.SetStartDelay(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := env.m.AddDevice(ctx, NewDevice{Type: "mqtt", Name: "plc-1"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The operation is interrupted rather than failed, so that it is
+	// resumed and the device eventually comes up.
+	var op Operation
+	if err := env.m.db.First(&op).Error; err != nil {
+		t.Fatalf("load operation: %v", err)
+	}
+	if op.Status != OperationRunning || op.CurrentStep != "start_adapter" {
+		t.Errorf("operation %s at %q, want %s at start_adapter", op.Status, op.CurrentStep, OperationRunning)
+	}
+
+	env.rt.SetStartDelay(0)
+	env.m.db.Model(&Operation{}).Where("id = ?", op.ID).Update("lease_until", time.Now().UTC().Add(-time.Second))
+	if err := env.m.ResumeOperations(context.Background()); err != nil {
+		t.Fatalf("resume operations: %v", err)
+	}
+	if dev := env.device(t, op.DeviceID); dev.Status != StatusRunning {
+		t.Errorf("status after resume = %s, want %s", dev.Status, StatusRunning)
+	}
+}
+
+func TestOperationLeaseLost(t *testing.T) {
+	env := newTestManager(t, Options{})
+	env.rt.SetStartDelay(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := env.m.AddDevice(ctx, NewDevice{Type: "mqtt", Name: "plc-1"}); err == nil {
+		t.Fatal("add device did not time out")
+	}
+	var stale Operation
+	if err := env.m.db.First(&stale).Error; err != nil {
+		t.Fatalf("load operation: %v", err)
+	}
+
+	// Another replica claims the operation after the lease ran out and
+	// finishes it; the replica it was taken from can no longer save.
+	env.rt.SetStartDelay(0)
+	env.m.db.Model(&Operation{}).Where("id = ?", stale.ID).Update("lease_until", time.Now().UTC().Add(-time.Second))
+	if err := env.m.ResumeOperations(context.Background()); err != nil {
+		t.Fatalf("resume operations: %v", err)
+	}
+	stale.Status = OperationFailed
+	if err := env.m.saveOperation(&stale); !errors.Is(err, ErrOperationLeaseLost) {
+		t.Fatalf("save with the old lease: err = %v, want %v", err, ErrOperationLeaseLost)
+	}
+	op, err := env.m.GetOperation(context.Background(), stale.ID)
+	if err != nil {
+		t.Fatalf("get operation: %v", err)
+	}
+	if op.Status != OperationSucceeded || op.LeaseToken == stale.LeaseToken {
+		t.Errorf("operation %s with token %q, want %s under a new lease", op.Status, op.LeaseToken, OperationSucceeded)
+	}
+}
+
+func TestCrashLoop(t *testing.T) {
+	env := newTestManager(t, Options{
+		CrashLoopThreshold: 3,
+		CrashLoopWindow:    time.Minute,
+		RestartBackoff:     time.Millisecond,
+		MaxRestartBackoff:  5 * time.Millisecond,
+	})
+	dev := env.addDevice(t, "plc-1")
+
+	// From now on every instance exits right after it is started.
+	env.rt.CrashOnStart(testImage, 1)
+	if err := env.rt.Crash(dev.ContainerID, 1); err != nil {
+		t.Fatalf("crash: %v", err)
+	}
+	for exit := 1; exit <= 3; exit++ {
+		env.die(t, dev)
+		got := env.device(t, dev.ID)
+		want := StatusExited
+		if exit == 3 {
+			want = StatusCrashLooping
+		}
+		if got.Status != want || got.ExitCode != 1 {
+			t.Fatalf("after exit %d: status %s, exit code %d, want %s, 1", exit, got.Status, got.ExitCode, want)
+		}
+
+		// The supervisor restarts it after the backoff.
+		prev := got.ContainerID
+		waitFor(t, "restart", func() bool {
+			dev = env.device(t, dev.ID)
+			return dev.ContainerID != prev
+		})
+		if dev.RestartCount != exit {
+			t.Errorf("restart count = %d, want %d", dev.RestartCount, exit)
+		}
+	}
+	if dev.Status != StatusCrashLooping {
+		t.Errorf("status after restart = %s, want %s", dev.Status, StatusCrashLooping)
+	}
+}
+
+func TestRestartPolicyNever(t *testing.T) {
+	env := newTestManager(t, Options{RestartBackoff: time.Millisecond})
+	never := RestartNever
+	if _, err := env.m.UpdateAdapterType(context.Background(), "mqtt", AdapterTypeUpdate{RestartPolicy: &never}); err != nil {
+		t.Fatalf("update adapter type: %v", err)
+	}
+	dev := env.addDevice(t, "plc-1")
+	if err := env.rt.Crash(dev.ContainerID, 1); err != nil {
+		t.Fatalf("crash: %v", err)
+	}
+	env.die(t, dev)
+
+	time.Sleep(20 * time.Millisecond)
+	got := env.device(t, dev.ID)
+	if got.Status != StatusExited || got.ContainerID != dev.ContainerID {
+		t.Errorf("device %s on %s, want %s on %s without restart", got.Status, got.ContainerID, StatusExited, dev.ContainerID)
+	}
+}
+
+func TestRestartDroppedWhenDeviceChanged(t *testing.T) {
+	env := newTestManager(t, Options{RestartBackoff: time.Millisecond})
+	dev := env.addDevice(t, "plc-1")
+	if err := env.rt.Crash(dev.ContainerID, 1); err != nil {
+		t.Fatalf("crash: %v", err)
+	}
+	env.rt.SetStartDelay(100 * time.Millisecond)
+	env.die(t, dev)
+
+	// The device is stopped while the supervisor restarts it.
+	time.Sleep(30 * time.Millisecond)
+	env.m.db.Model(&Device{}).Where("id = ?", dev.ID).Update("status", StatusStopped)
+	waitFor(t, "the new container to be removed", func() bool {
+		return len(env.rt.Instances()) == 0
+	})
+	got := env.device(t, dev.ID)
+	if got.Status != StatusStopped || got.ContainerID != dev.ContainerID || got.RestartCount != 0 {
+		t.Errorf("device %s on %s after %d restarts, want it left %s on %s",
+			got.Status, got.ContainerID, got.RestartCount, StatusStopped, dev.ContainerID)
+	}
+}
+
+func TestRestartRunningDevices(t *testing.T) {
+	env := newTestManager(t, Options{BootParallelism: 4})
+	adopted := env.addDevice(t, "adopted")
+	lost := env.addDevice(t, "lost")
+	stopped := env.addDevice(t, "stopped")
+	if _, err := env.m.StopDevice(context.Background(), stopped.ID); err != nil {
+		t.Fatalf("stop device: %v", err)
+	}
+	// The adapter of "lost" went away with the engine, e.g. on a reboot.
+	if err := env.rt.Stop(context.Background(), lost.ContainerID); err != nil {
+		t.Fatalf("stop instance: %v", err)
+	}
+
+	if err := env.m.RestartRunningDevices(context.Background()); err != nil {
+		t.Fatalf("restart running devices: %v", err)
+	}
+	rep := env.m.BootProgress()
+	if !rep.Restored() || rep.Total != 2 || rep.Adopted != 1 || rep.Restarted != 1 || rep.Failed != 0 {
+		t.Errorf("boot report = %+v, want 2 devices, 1 adopted, 1 restarted", rep)
+	}
+	if got := env.device(t, adopted.ID); got.ContainerID != adopted.ContainerID {
+		t.Errorf("adopted device moved to %s, want %s kept", got.ContainerID, adopted.ContainerID)
+	}
+	got := env.device(t, lost.ID)
+	if inst, ok := env.rt.Instance(got.ContainerID); got.Status != StatusRunning || !ok || !inst.State.Running {
+		t.Errorf("lost device %s on %s, want running on a new instance", got.Status, got.ContainerID)
+	}
+	if got := env.device(t, stopped.ID); got.Status != StatusStopped || got.ContainerID != "" {
+		t.Errorf("stopped device %s on %q, want it left stopped", got.Status, got.ContainerID)
+	}
+}
+
+func TestRestartRunningDevicesGivesUpOnSlowStarts(t *testing.T) {
+	env := newTestManager(t, Options{BootParallelism: 3, BootDeviceTimeout: 100 * time.Millisecond})
+	var devs []*Device
+	for i := range 3 {
+		devs = append(devs, env.addDevice(t, fmt.Sprintf("plc-%d", i)))
+	}
+	for _, dev := range devs {
+		env.rt.Stop(context.Background(), dev.ContainerID)
+	}
+
+	// Devices start in parallel, each within its own timeout.
+	env.rt.SetStartDelay(50 * time.Millisecond)
+	start := time.Now()
+	if err := env.m.RestartRunningDevices(context.Background()); err != nil {
+		t.Fatalf("restart running devices: %v", err)
+	}
+	if took := time.Since(start); took >= 150*time.Millisecond {
+		t.Errorf("restoring 3 devices took %s, want them restored in parallel", took)
+	}
+	if rep := env.m.BootProgress(); rep.Restarted != 3 {
+		t.Errorf("boot report = %+v, want 3 restarted", rep)
+	}
+
+	// Devices that do not start within BootDeviceTimeout are stopped.
+	for _, dev := range devs {
+		env.rt.Stop(context.Background(), env.device(t, dev.ID).ContainerID)
+	}
+	env.rt.SetStartDelay(time.Second)
+	if err := env.m.RestartRunningDevices(context.Background()); err != nil {
+		t.Fatalf("restart running devices: %v", err)
+	}
+	rep := env.m.BootProgress()
+	if rep.Failed != 3 || len(rep.Failures) != 3 {
+		t.Errorf("boot report = %+v, want 3 failed", rep)
+	}
+	for _, dev := range devs {
+		if got := env.device(t, dev.ID); got.Status != StatusStopped {
+			t.Errorf("device %s is %s, want %s", dev.ID, got.Status, StatusStopped)
+		}
+	}
+}
+
+func TestCleanupAdapters(t *testing.T) {
+	env := newTestManager(t, Options{})
+	a := env.addDevice(t, "plc-1")
+	b := env.addDevice(t, "plc-2")
+
+	if err := env.m.CleanupAdapters(context.Background()); err != nil {
+		t.Fatalf("cleanup adapters: %v", err)
+	}
+	if n := len(env.rt.Instances()); n != 0 {
+		t.Errorf("%d instances left, want none", n)
+	}
+	for _, dev := range []*Device{a, b} {
+		// The devices stay running, so they are brought back at the next
+		// boot, and the exits are not taken for crashes.
+		if got := env.device(t, dev.ID); got.Status != StatusRunning {
+			t.Errorf("device %s is %s, want %s", dev.ID, got.Status, StatusRunning)
+		}
+		if !env.m.exitExpected(dev.ContainerID) {
+			t.Errorf("exit of %s not expected", dev.ContainerID)
+		}
+	}
+}
+
+func TestExpectedExitSeenByLeader(t *testing.T) {
+	env := newTestManager(t, Options{})
+	dev := env.addDevice(t, "plc-1")
+
+	// The replica serving the request stops the container, the leader
+	// watching the runtime sees it exit.
+	tc := traefik.New(traefik.Config{BaseDomain: "localhost", Network: "test", Logger: zerolog.Nop()})
+	leader, err := New(env.m.db, env.streams, "nats://nats:4222", env.rt, tc, zerolog.Nop(), Options{})
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	t.Cleanup(leader.forgetAllCrashes)
+	env.m.expectExit(dev.ContainerID)
+	env.m = leader
+	env.die(t, dev)
+	if got := env.device(t, dev.ID); got.Status != StatusRunning || got.LastError != "" {
+		t.Errorf("device %s (%q), want running without error", got.Status, got.LastError)
+	}
+	if leader.exitExpected(dev.ContainerID) {
+		t.Errorf("exit of %s still expected after it was seen", dev.ContainerID)
+	}
+}
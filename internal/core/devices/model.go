@@ -1,22 +1,100 @@
 package devices
 
-import "time"
+import (
+	"time"
+
+	"service-io/internal/core/runtime"
+)
 
 // Device represents a single device adapter instance.
 // It includes GORM tags for database mapping and JSON tags for API responses.
 type Device struct {
 	ID            string    `gorm:"primaryKey" json:"id" example:"EDIVRWCLGGPGCW7M"`
+	Name          string    `json:"name,omitempty" example:"boiler-room-plc-3"`
+	Description   string    `json:"description,omitempty" example:"Modbus PLC in the boiler room"`
+	Labels        Labels    `gorm:"type:jsonb" json:"labels,omitempty" swaggertype:"object,string" example:"site:plant-a"`
 	DeviceType    string    `json:"type" example:"mqtt"`
 	Image         string    `json:"image" example:"registry.digitalocean.com/scadable-container-registry/adapter-mqtt:latest"`
+	ImageDigest   string    `json:"image_digest,omitempty" example:"registry.digitalocean.com/scadable-container-registry/adapter-mqtt@sha256:9b2c..."`
 	NatsSubject   string    `json:"nats_subject" example:"devices.EDIVRWCLGGPGCW7M.telemetry"`
 	ContainerID   string    `json:"container_id" example:"3518d34547496f2a8c4af44be3c71d7f..."`
 	ContainerName string    `json:"container_name" example:"adapter-EDIVRWCLGGPGCW7M"`
 	ContainerURL  string    `json:"container_url" example:"EDIVRWCLGGPGCW7M.localhost"`
-	Status        string    `json:"status" example:"running"`
+	Status        Status    `json:"status" example:"running"`
 	CreatedAt     time.Time `json:"created_at"`
 
+	// Adapter configuration delivered to the container; the version is
+	// bumped on every change.
+	Config        AdapterConfig `gorm:"type:jsonb" json:"config,omitempty" swaggertype:"object"`
+	ConfigVersion int           `json:"config_version" example:"1"`
+
+	// Host is the engine the adapter was scheduled on; empty for the default
+	// runtime. Placement is the host selector it was scheduled with.
+	Host      string `gorm:"index" json:"host,omitempty" example:"edge-1"`
+	Placement string `json:"placement,omitempty" example:"site=plant-a"`
+
+	// Last observed state of the adapter container, kept up to date from
+	// runtime events.
+	ExitCode     int    `json:"exit_code" example:"0"`
+	LastError    string `json:"last_error,omitempty" example:"exited with code 1"`
+	RestartCount int    `json:"restart_count" example:"0"`
+	Health       string `json:"health,omitempty" example:"healthy"`
+	// LogTail holds the last lines the container logged before it exited.
+	LogTail string `json:"log_tail,omitempty" example:"panic: dial tcp 10.0.0.7:502: connection refused"`
+
 	// MQTT credentials, only populated for 'mqtt' type devices.
 	MQTTUser string `json:"mqtt_user,omitempty" example:"EDIVRWCLGGPGCW7M"`
 	// The JSON tag is changed from "-" to "mqtt_password,omitempty" to expose it.
 	MQTTPassword string `json:"mqtt_password,omitempty" example:"aBc12DeF34gH56iJ"`
 }
+
+// DeviceDetails is a Device merged with the live state of its container.
+type DeviceDetails struct {
+	Device
+	// Container is nil when no container exists for the device.
+	Container *runtime.State `json:"container,omitempty"`
+}
+
+// NewDevice describes a device to be created by AddDevice.
+type NewDevice struct {
+	Type        string
+	Name        string
+	Description string
+	Labels      Labels
+	Config      AdapterConfig
+	// Placement is a label selector over host labels restricting where the
+	// adapter may be scheduled.
+	Placement string
+}
+
+// DeviceUpdate lists the mutable fields of a device. Nil fields are left unchanged.
+type DeviceUpdate struct {
+	Name        *string
+	Description *string
+	Labels      Labels
+	Image       *string
+	// Config replaces the whole adapter configuration when non-nil.
+	Config AdapterConfig
+}
+
+// containerRef returns the identifier used to address the device's container.
+func (d *Device) containerRef() string {
+	if d.ContainerID != "" {
+		return d.ContainerID
+	}
+	return d.ContainerName
+}
+
+// streamName returns the name of the device's dedicated JetStream stream.
+func (d *Device) streamName() string {
+	return "DEV_" + d.ID
+}
+
+// imageRef returns the image reference to run: the pinned digest when known,
+// otherwise the configured tag.
+func (d *Device) imageRef() string {
+	if d.ImageDigest != "" {
+		return d.ImageDigest
+	}
+	return d.Image
+}
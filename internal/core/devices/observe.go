@@ -0,0 +1,48 @@
+package devices
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"service-io/internal/core/runtime"
+)
+
+// DeviceLogs streams the logs of a device's adapter container.
+func (m *Manager) DeviceLogs(ctx context.Context, deviceID string, opts runtime.LogOptions) (io.ReadCloser, error) {
+	dev, rt, err := m.liveDevice(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return rt.Logs(ctx, dev.containerRef(), opts)
+}
+
+// DeviceStats samples the resource usage of a device's adapter container.
+func (m *Manager) DeviceStats(ctx context.Context, deviceID string) (*runtime.Stats, error) {
+	dev, rt, err := m.liveDevice(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return rt.Stats(ctx, dev.containerRef())
+}
+
+// liveDevice loads a device and checks that its container exists. It also
+// returns the runtime of the device's host.
+func (m *Manager) liveDevice(ctx context.Context, deviceID string) (*Device, runtime.Runtime, error) {
+	dev, err := m.findDevice(deviceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	rt, err := m.runtimeFor(ctx, dev.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+	state, err := rt.Inspect(ctx, dev.containerRef())
+	if err != nil {
+		return nil, nil, fmt.Errorf("inspect adapter container: %w", err)
+	}
+	if state == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrNoContainer, deviceID)
+	}
+	return dev, rt, nil
+}
@@ -0,0 +1,673 @@
+package devices
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"service-io/internal/core/runtime"
+	"service-io/pkg/rand"
+
+	"gorm.io/gorm"
+)
+
+// Operation kinds.
+const (
+	OperationCreate  = "create"
+	OperationStart   = "start"
+	OperationStop    = "stop"
+	OperationRestart = "restart"
+	OperationDelete  = "delete"
+	OperationPurge   = "purge"
+)
+
+// OperationStatus is the state of an operation.
+type OperationStatus string
+
+const (
+	// OperationRunning operations are carrying out their steps.
+	OperationRunning OperationStatus = "running"
+	// OperationCompensating operations failed or were cancelled and are
+	// undoing the steps they completed.
+	OperationCompensating OperationStatus = "compensating"
+	OperationSucceeded    OperationStatus = "succeeded"
+	// OperationFailed and OperationCancelled operations undid whatever
+	// could be undone.
+	OperationFailed    OperationStatus = "failed"
+	OperationCancelled OperationStatus = "cancelled"
+)
+
+// unfinishedOperations are the statuses of operations still at work.
+var unfinishedOperations = []OperationStatus{OperationRunning, OperationCompensating}
+
+// Step states.
+const (
+	StepPending     = "pending"
+	StepRunning     = "running"
+	StepDone        = "done"
+	StepFailed      = "failed"
+	StepCompensated = "compensated"
+)
+
+var (
+	// ErrOperationNotFound is returned when an operation ID does not match any record.
+	ErrOperationNotFound = errors.New("operation not found")
+	// ErrOperationNotCancellable is returned when cancelling an operation
+	// that finished or is already being undone.
+	ErrOperationNotCancellable = errors.New("operation can no longer be cancelled")
+	// ErrOperationCancelled is the error of a cancelled operation.
+	ErrOperationCancelled = errors.New("operation cancelled")
+	// ErrOperationInProgress is returned when starting an operation on a
+	// device that has an unfinished one.
+	ErrOperationInProgress = errors.New("device has an operation in progress")
+	// ErrOperationLeaseLost is returned when another replica claimed an
+	// operation this replica was running, after its lease ran out.
+	ErrOperationLeaseLost = errors.New("operation lease lost")
+)
+
+const (
+	// operationLease is how long an operation stays claimed by the replica
+	// running it without a heartbeat. Operations whose lease ran out were
+	// interrupted and are resumed by the leader.
+	operationLease = 30 * time.Second
+	// resumeOperationsEvery is how often the leader looks for interrupted
+	// operations.
+	resumeOperationsEvery = 15 * time.Second
+	// pullProgressEvery throttles how often image pull progress is saved.
+	pullProgressEvery = time.Second
+	// waitOperationPoll is how often WaitOperation checks an operation.
+	waitOperationPoll = 500 * time.Millisecond
+)
+
+// Operation is a persisted, multi-step change to a device. Every step is
+// idempotent, so an operation interrupted by a crash is resumed from the step
+// it was in; a failed or cancelled one undoes its completed steps in reverse
+// order.
+type Operation struct {
+	ID   string `gorm:"primaryKey" json:"id" example:"K7Q2M9XW4TBN8CPL"`
+	Kind string `gorm:"index" json:"kind" example:"create"`
+	// A device has at most one unfinished operation.
+	DeviceID string          `gorm:"index;uniqueIndex:idx_operations_unfinished,where:status = 'running' OR status = 'compensating'" json:"device_id" example:"EDIVRWCLGGPGCW7M"`
+	Status   OperationStatus `gorm:"index" json:"status" example:"running"`
+	// Step is the index of the step being run or compensated.
+	Step       int            `json:"-"`
+	Steps      OperationSteps `gorm:"type:jsonb" json:"steps"`
+	Error      string         `json:"error,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+
+	LeaseUntil time.Time `gorm:"index" json:"-"`
+	// LeaseToken identifies the claim on the operation. It changes with every
+	// claim, so a replica that lost its lease can no longer renew it or save
+	// progress.
+	LeaseToken string `json:"-"`
+
+	// CurrentStep names the step being run or compensated.
+	CurrentStep string `json:"current_step,omitempty" example:"pull_image"`
+	// Progress is the latest image pull progress, if the operation pulled.
+	Progress *ImagePullProgress `gorm:"type:jsonb" json:"progress,omitempty"`
+	// Result is the device as the operation left it, once it succeeded.
+	Result          RawJSON `gorm:"type:jsonb" json:"result,omitempty" swaggertype:"object"`
+	CancelRequested bool    `json:"cancel_requested"`
+	// Actor is who requested the operation; its events are published on
+	// their behalf.
+	Actor string `json:"actor,omitempty" example:"api"`
+}
+
+// OperationStep is the progress of one step of an operation.
+type OperationStep struct {
+	Name       string     `json:"name" example:"start_adapter"`
+	Status     string     `json:"status" example:"done"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// OperationSteps is stored as a JSONB array.
+type OperationSteps []OperationStep
+
+// Value implements driver.Valuer for storing the steps as JSONB.
+func (s OperationSteps) Value() (driver.Value, error) {
+	if s == nil {
+		return "[]", nil
+	}
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+// Scan implements sql.Scanner for reading the JSONB column back.
+func (s *OperationSteps) Scan(src any) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("operation steps: unsupported scan type %T", src)
+	}
+	return json.Unmarshal(raw, s)
+}
+
+// ImagePullProgress is image pull progress stored as JSONB.
+type ImagePullProgress struct {
+	runtime.PullProgress
+}
+
+// Value implements driver.Valuer for storing the progress as JSONB.
+func (p ImagePullProgress) Value() (driver.Value, error) {
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+// Scan implements sql.Scanner for reading the JSONB column back.
+func (p *ImagePullProgress) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	default:
+		return fmt.Errorf("image pull progress: unsupported scan type %T", src)
+	}
+}
+
+// Done reports whether the operation finished, successfully or not.
+func (op *Operation) Done() bool {
+	switch op.Status {
+	case OperationSucceeded, OperationFailed, OperationCancelled:
+		return true
+	}
+	return false
+}
+
+// workflowStep is one idempotent step of an operation. undo, if set, reverts
+// it and must be idempotent too; it is also called for the step that failed,
+// which may have been partly applied.
+type workflowStep struct {
+	name string
+	do   func(ctx context.Context, op *Operation) error
+	undo func(ctx context.Context, op *Operation) error
+}
+
+// workflow returns the steps of an operation kind.
+func (m *Manager) workflow(kind string) []workflowStep {
+	switch kind {
+	case OperationCreate:
+		return m.createWorkflow()
+	case OperationStart:
+		return m.startWorkflow()
+	case OperationStop:
+		return m.stopWorkflow()
+	case OperationRestart:
+		return m.restartWorkflow()
+	case OperationDelete:
+		return m.deleteWorkflow()
+	case OperationPurge:
+		return m.purgeWorkflow()
+	}
+	return nil
+}
+
+// newOperation returns an operation of the given kind, claimed by this
+// replica. Steps already done, e.g. in the transaction that records the
+// operation, are passed as done.
+func (m *Manager) newOperation(ctx context.Context, kind, deviceID string, done int) *Operation {
+	now := time.Now().UTC()
+	op := &Operation{
+		ID:         rand.ID16(),
+		Kind:       kind,
+		DeviceID:   deviceID,
+		Status:     OperationRunning,
+		Step:       done,
+		Actor:      ActorFrom(ctx),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		LeaseUntil: now.Add(operationLease),
+		LeaseToken: rand.ID16(),
+	}
+	for i, s := range m.workflow(kind) {
+		st := OperationStep{Name: s.name, Status: StepPending}
+		if i < done {
+			st.Status, st.StartedAt, st.FinishedAt = StepDone, &now, &now
+		}
+		op.Steps = append(op.Steps, st)
+	}
+	op.CurrentStep = op.Steps[done].Name
+	return op
+}
+
+// recordOperation inserts a new operation of the given kind on behalf of the
+// actor in ctx. It fails with ErrOperationInProgress if the device has an
+// unfinished operation.
+func (m *Manager) recordOperation(ctx context.Context, kind, deviceID string) (*Operation, error) {
+	op := m.newOperation(ctx, kind, deviceID, 0)
+	if err := m.checkNoOperation(ctx, deviceID); err != nil {
+		return nil, err
+	}
+	if err := m.db.Create(op).Error; err != nil {
+		// The unique index on unfinished operations rejects one recorded
+		// concurrently.
+		if err := m.checkNoOperation(ctx, deviceID); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("record %s operation: %w", kind, err)
+	}
+	return op, nil
+}
+
+// busyDevices returns the IDs of the devices with an unfinished operation.
+func (m *Manager) busyDevices(ctx context.Context) (map[string]bool, error) {
+	var ids []string
+	err := m.db.WithContext(ctx).Model(&Operation{}).
+		Where("status IN ?", unfinishedOperations).Pluck("device_id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("list unfinished operations: %w", err)
+	}
+	busy := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		busy[id] = true
+	}
+	return busy, nil
+}
+
+// checkNoOperation returns ErrOperationInProgress if the device has an
+// unfinished operation.
+func (m *Manager) checkNoOperation(ctx context.Context, deviceID string) error {
+	var op Operation
+	err := m.db.WithContext(ctx).Select("id", "kind").
+		Where("device_id = ? AND status IN ?", deviceID, unfinishedOperations).
+		Limit(1).Find(&op).Error
+	if err != nil {
+		return fmt.Errorf("check operations: %w", err)
+	}
+	if op.ID != "" {
+		return fmt.Errorf("%w: %s operation %s", ErrOperationInProgress, op.Kind, op.ID)
+	}
+	return nil
+}
+
+// goOperation runs an operation in the background and returns a snapshot of
+// it as submitted.
+func (m *Manager) goOperation(op *Operation) *Operation {
+	snapshot := *op
+	snapshot.Steps = slices.Clone(op.Steps)
+	go func() {
+		if err := m.runOperation(context.Background(), op); err != nil {
+			m.lg.Error().Err(err).Str("operation_id", op.ID).Str("kind", op.Kind).Msg("operation failed")
+		}
+	}()
+	return &snapshot
+}
+
+// runDeviceOperation runs an operation and returns the device it left.
+func (m *Manager) runDeviceOperation(ctx context.Context, op *Operation) (*Device, error) {
+	if err := m.runOperation(ctx, op); err != nil {
+		return nil, err
+	}
+	return m.findDevice(op.DeviceID)
+}
+
+// runOperation carries out an operation claimed by this replica from the
+// step it is in, compensating if a step fails or the operation is
+// cancelled. It returns the error of the failed step. An operation
+// interrupted by ctx is left to be resumed.
+func (m *Manager) runOperation(ctx context.Context, op *Operation) error {
+	steps := m.workflow(op.Kind)
+	if len(steps) != len(op.Steps) {
+		return fmt.Errorf("operation %s: unknown kind %q", op.ID, op.Kind)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if op.CancelRequested {
+		cancel(ErrOperationCancelled)
+	}
+	m.trackOperation(op.ID, cancel)
+	defer m.untrackOperation(op.ID)
+	stop := m.keepLease(op.ID, op.LeaseToken, cancel)
+	defer stop()
+	stepCtx := runtime.WithPullProgress(ctx, m.pullReporter(op.ID))
+	lg := m.lg.With().Str("operation_id", op.ID).Str("kind", op.Kind).Str("device_id", op.DeviceID).Logger()
+
+	var failure error
+	for op.Status == OperationRunning && op.Step < len(steps) {
+		if errors.Is(context.Cause(ctx), ErrOperationCancelled) {
+			failure = ErrOperationCancelled
+			op.Status, op.Error, op.CancelRequested = OperationCompensating, failure.Error(), true
+			break
+		}
+		s, st := steps[op.Step], &op.Steps[op.Step]
+		now := time.Now().UTC()
+		st.Status, st.StartedAt = StepRunning, &now
+		if err := m.saveOperation(op); err != nil {
+			return err
+		}
+		err := s.do(stepCtx, op)
+		if err != nil && ctx.Err() != nil {
+			if !errors.Is(context.Cause(ctx), ErrOperationCancelled) {
+				// Interrupted rather than failed: the step is run again
+				// when the operation is resumed.
+				lg.Warn().Err(err).Str("step", s.name).Msg("operation interrupted")
+				return fmt.Errorf("%s: %w", s.name, err)
+			}
+			err, op.CancelRequested = ErrOperationCancelled, true
+		}
+		now = time.Now().UTC()
+		st.FinishedAt = &now
+		if err != nil {
+			lg.Error().Err(err).Str("step", s.name).Msg("operation step failed, compensating")
+			failure = err
+			st.Status, st.Error = StepFailed, err.Error()
+			op.Status, op.Error = OperationCompensating, fmt.Sprintf("%s: %v", s.name, err)
+			break
+		}
+		st.Status = StepDone
+		op.Step++
+		if op.Step == len(steps) {
+			op.Status, op.FinishedAt = OperationSucceeded, &now
+			op.Result = m.operationResult(op)
+		}
+		if err := m.saveStep(ctx, op); err != nil {
+			return err
+		}
+	}
+
+	if op.Status == OperationCompensating {
+		// Compensation must finish even if the caller gave up.
+		ctx := context.WithoutCancel(ctx)
+		for op.Step = min(op.Step, len(steps)-1); op.Step >= 0; op.Step-- {
+			s, st := steps[op.Step], &op.Steps[op.Step]
+			if s.undo == nil || st.Status == StepPending || st.Status == StepCompensated {
+				continue
+			}
+			if err := s.undo(ctx, op); err != nil {
+				lg.Error().Err(err).Str("step", s.name).Msg("operation compensation failed, will retry")
+				st.Error = fmt.Sprintf("undo: %v", err)
+				_ = m.saveOperation(op)
+				return errors.Join(failure, err)
+			}
+			st.Status = StepCompensated
+			if err := m.saveOperation(op); err != nil {
+				return err
+			}
+		}
+		now := time.Now().UTC()
+		op.Step, op.Status, op.FinishedAt = 0, OperationFailed, &now
+		if op.CancelRequested {
+			op.Status = OperationCancelled
+		}
+		if err := m.saveOperation(op); err != nil {
+			return err
+		}
+		if failure == nil {
+			// Resumed compensation; the original error is on the operation.
+			failure = errors.New(op.Error)
+		}
+		return failure
+	}
+	return nil
+}
+
+// operationResult returns the device as a finished operation left it, or
+// nil if it is gone.
+func (m *Manager) operationResult(op *Operation) RawJSON {
+	dev, err := m.findDevice(op.DeviceID)
+	if err != nil {
+		return nil
+	}
+	raw, err := json.Marshal(dev)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+// saveOperation persists an operation's progress, leaving its lease, pull
+// progress and cancel request alone. It fails with ErrOperationLeaseLost
+// once another replica claimed the operation.
+func (m *Manager) saveOperation(op *Operation) error {
+	return storeOperation(m.db, op)
+}
+
+// saveStep saves the progress of an operation after a step. The event of an
+// operation that succeeded is published with it.
+func (m *Manager) saveStep(ctx context.Context, op *Operation) error {
+	if op.Status != OperationSucceeded {
+		return m.saveOperation(op)
+	}
+	return m.withEvents(context.WithoutCancel(ctx), func(tx *gorm.DB) error {
+		if err := storeOperation(tx, op); err != nil {
+			return err
+		}
+		return m.publishOperation(tx, op)
+	})
+}
+
+// storeOperation saves op within tx; see saveOperation.
+func storeOperation(tx *gorm.DB, op *Operation) error {
+	op.UpdatedAt = time.Now().UTC()
+	op.CurrentStep = ""
+	if !op.Done() && op.Step >= 0 && op.Step < len(op.Steps) {
+		op.CurrentStep = op.Steps[op.Step].Name
+	}
+	res := tx.Model(op).Where("lease_token = ?", op.LeaseToken).
+		Select("status", "step", "steps", "current_step", "error", "result", "updated_at", "finished_at").
+		Updates(op)
+	if res.Error != nil {
+		return fmt.Errorf("save operation %s: %w", op.ID, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("save operation %s: %w", op.ID, ErrOperationLeaseLost)
+	}
+	return nil
+}
+
+// keepLease renews the lease held with token on an operation until the
+// returned function is called. It cancels the operation when a cancel was
+// requested from another replica, or with ErrOperationLeaseLost when
+// another replica claimed it.
+func (m *Manager) keepLease(opID, token string, cancel context.CancelCauseFunc) func() {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(operationLease / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+			res := m.db.Model(&Operation{}).Where("id = ? AND lease_token = ?", opID, token).
+				Update("lease_until", time.Now().UTC().Add(operationLease))
+			if res.Error != nil {
+				m.lg.Warn().Err(res.Error).Str("operation_id", opID).Msg("failed to renew operation lease")
+				continue
+			}
+			if res.RowsAffected == 0 {
+				m.lg.Warn().Str("operation_id", opID).Msg("operation claimed by another replica, abandoning it")
+				cancel(ErrOperationLeaseLost)
+				return
+			}
+			var requested bool
+			err := m.db.Model(&Operation{}).Select("cancel_requested").Where("id = ?", opID).Scan(&requested).Error
+			if err == nil && requested {
+				cancel(ErrOperationCancelled)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		// Release the lease, so a failed compensation is retried soon.
+		_ = m.db.Model(&Operation{}).Where("id = ? AND lease_token = ?", opID, token).
+			Update("lease_until", time.Now().UTC()).Error
+	}
+}
+
+// pullReporter returns a callback saving the image pull progress of an
+// operation, at most every pullProgressEvery.
+func (m *Manager) pullReporter(opID string) func(runtime.PullProgress) {
+	var last time.Time
+	return func(p runtime.PullProgress) {
+		if time.Since(last) < pullProgressEvery && (p.Layers == 0 || p.LayersDone < p.Layers) {
+			return
+		}
+		last = time.Now()
+		err := m.db.Model(&Operation{}).Where("id = ?", opID).
+			Update("progress", ImagePullProgress{PullProgress: p}).Error
+		if err != nil {
+			m.lg.Warn().Err(err).Str("operation_id", opID).Msg("failed to save image pull progress")
+		}
+	}
+}
+
+func (m *Manager) trackOperation(id string, cancel context.CancelCauseFunc) {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	m.running[id] = cancel
+}
+
+func (m *Manager) untrackOperation(id string) {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	delete(m.running, id)
+}
+
+// RunOperations resumes interrupted operations until ctx is done.
+func (m *Manager) RunOperations(ctx context.Context) {
+	t := time.NewTicker(resumeOperationsEvery)
+	defer t.Stop()
+	for {
+		if err := m.ResumeOperations(ctx); err != nil && ctx.Err() == nil {
+			m.lg.Error().Err(err).Msg("failed to resume operations")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// ResumeOperations claims the unfinished operations whose replica stopped
+// renewing their lease, e.g. because it crashed, and carries them on.
+func (m *Manager) ResumeOperations(ctx context.Context) error {
+	var ops []Operation
+	err := m.db.WithContext(ctx).
+		Where("status IN ? AND lease_until < ?", unfinishedOperations, time.Now().UTC()).
+		Order("created_at").Find(&ops).Error
+	if err != nil {
+		return fmt.Errorf("list interrupted operations: %w", err)
+	}
+	for i := range ops {
+		op := &ops[i]
+		token := rand.ID16()
+		res := m.db.WithContext(ctx).Model(&Operation{}).
+			Where("id = ? AND lease_token = ? AND lease_until < ?", op.ID, op.LeaseToken, time.Now().UTC()).
+			Updates(map[string]any{"lease_until": time.Now().UTC().Add(operationLease), "lease_token": token})
+		if res.Error != nil {
+			return fmt.Errorf("claim operation %s: %w", op.ID, res.Error)
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+		op.LeaseToken = token
+		m.lg.Info().Str("operation_id", op.ID).Str("kind", op.Kind).Str("device_id", op.DeviceID).
+			Str("status", string(op.Status)).Msg("resuming interrupted operation")
+		if err := m.runOperation(ctx, op); err != nil {
+			m.lg.Error().Err(err).Str("operation_id", op.ID).Msg("resumed operation failed")
+		}
+	}
+	return nil
+}
+
+// GetOperation returns an operation by ID.
+func (m *Manager) GetOperation(ctx context.Context, id string) (*Operation, error) {
+	var op Operation
+	if err := m.db.WithContext(ctx).First(&op, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrOperationNotFound, id)
+		}
+		return nil, err
+	}
+	return &op, nil
+}
+
+// WaitOperation waits until an operation is done or ctx is, and returns the
+// operation as it is then.
+func (m *Manager) WaitOperation(ctx context.Context, id string) (*Operation, error) {
+	t := time.NewTicker(waitOperationPoll)
+	defer t.Stop()
+	for {
+		op, err := m.GetOperation(context.WithoutCancel(ctx), id)
+		if err != nil || op.Done() {
+			return op, err
+		}
+		select {
+		case <-ctx.Done():
+			return op, nil
+		case <-t.C:
+		}
+	}
+}
+
+// CancelOperation asks a running operation to stop. The operation then
+// undoes the steps it completed and ends cancelled; steps that cannot be
+// undone stay done.
+func (m *Manager) CancelOperation(ctx context.Context, id string) (*Operation, error) {
+	res := m.db.WithContext(ctx).Model(&Operation{}).
+		Where("id = ? AND status = ?", id, OperationRunning).
+		Update("cancel_requested", true)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		op, err := m.GetOperation(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: it is %s", ErrOperationNotCancellable, op.Status)
+	}
+
+	m.opMu.Lock()
+	if cancel, ok := m.running[id]; ok {
+		cancel(ErrOperationCancelled)
+	}
+	m.opMu.Unlock()
+	m.lg.Info().Str("operation_id", id).Msg("operation cancel requested")
+	return m.GetOperation(ctx, id)
+}
+
+// ListOperations returns the latest operations on a device, newest first.
+// The operations of a purged device are still listed; a device that never
+// existed is ErrNotFound.
+func (m *Manager) ListOperations(ctx context.Context, deviceID string) ([]Operation, error) {
+	if _, err := m.findDevice(deviceID); errors.Is(err, ErrNotFound) {
+		purged, checkErr := m.purged(ctx, deviceID)
+		if checkErr != nil {
+			return nil, checkErr
+		}
+		if !purged {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	ops := []Operation{}
+	err := m.db.WithContext(ctx).Where("device_id = ?", deviceID).
+		Order("created_at DESC").Limit(50).Find(&ops).Error
+	return ops, err
+}
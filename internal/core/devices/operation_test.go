@@ -0,0 +1,78 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestOperationInProgress(t *testing.T) {
+	env := newTestManager(t, Options{})
+	dev := env.addDevice(t, "plc-1")
+	ctx := context.Background()
+
+	if _, err := env.m.recordOperation(ctx, OperationStop, dev.ID); err != nil {
+		t.Fatalf("record stop: %v", err)
+	}
+	if _, err := env.m.RestartDevice(ctx, dev.ID); !errors.Is(err, ErrOperationInProgress) {
+		t.Errorf("restart: err = %v, want %v", err, ErrOperationInProgress)
+	}
+	if err := env.m.PurgeDevice(ctx, dev.ID); !errors.Is(err, ErrOperationInProgress) {
+		t.Errorf("purge: err = %v, want %v", err, ErrOperationInProgress)
+	}
+	name := "plc-renamed"
+	if _, err := env.m.UpdateDevice(ctx, dev.ID, DeviceUpdate{Name: &name}); !errors.Is(err, ErrOperationInProgress) {
+		t.Errorf("update: err = %v, want %v", err, ErrOperationInProgress)
+	}
+	// Operations recorded concurrently are caught by the database.
+	if err := env.m.db.Create(env.m.newOperation(ctx, OperationDelete, dev.ID, 0)).Error; err == nil {
+		t.Errorf("second unfinished operation inserted")
+	}
+}
+
+func TestStartDoesNotReviveDeletedDevice(t *testing.T) {
+	env := newTestManager(t, Options{})
+	dev := env.addDevice(t, "plc-1")
+	ctx := context.Background()
+	if _, err := env.m.StopDevice(ctx, dev.ID); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	// The device is deleted while the start operation is interrupted.
+	op, err := env.m.prepareStart(ctx, dev.ID)
+	if err != nil {
+		t.Fatalf("prepare start: %v", err)
+	}
+	env.m.db.Model(&Device{}).Where("id = ?", dev.ID).Update("status", StatusDeleted)
+	if err := env.m.runOperation(ctx, op); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("start: err = %v, want %v", err, ErrInvalidTransition)
+	}
+
+	if got := env.device(t, dev.ID); got.Status != StatusDeleted {
+		t.Errorf("device is %s, want %s", got.Status, StatusDeleted)
+	}
+	if n := len(env.rt.Instances()); n != 0 {
+		t.Errorf("%d instances left, want the new container removed", n)
+	}
+}
+
+func TestListOperations(t *testing.T) {
+	env := newTestManager(t, Options{})
+	dev := env.addDevice(t, "plc-1")
+	ctx := context.Background()
+
+	if _, err := env.m.ListOperations(ctx, "UNKNOWN"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown device: err = %v, want %v", err, ErrNotFound)
+	}
+	// Operations outlive a purged device.
+	if err := env.m.PurgeDevice(ctx, dev.ID); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	ops, err := env.m.ListOperations(ctx, dev.ID)
+	if err != nil {
+		t.Fatalf("list operations of purged device: %v", err)
+	}
+	if len(ops) != 2 || ops[0].Kind != OperationPurge || ops[1].Kind != OperationCreate {
+		t.Errorf("operations = %+v, want the purge and the create", ops)
+	}
+}
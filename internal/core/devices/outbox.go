@@ -0,0 +1,203 @@
+package devices
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// drainOutboxEvery is how often the leader looks for events to forward,
+	// besides right after publishing one itself.
+	drainOutboxEvery = time.Second
+	// outboxBatch is how many events are forwarded or queued per query.
+	outboxBatch = 100
+	// outboxRetention is how long events are kept in the outbox once
+	// published, and pruneOutboxEvery how often older ones are dropped.
+	outboxRetention  = 24 * time.Hour
+	pruneOutboxEvery = time.Hour
+)
+
+// OutboxEvent is a lifecycle event recorded by the replica that published
+// it, so that the leader forwards it to the event stream and queues its
+// webhook deliveries even if that replica goes away or the stream is down,
+// and every replica sends it to its subscribers. Seq orders the events of
+// all replicas.
+type OutboxEvent struct {
+	Seq      uint64 `gorm:"primaryKey;autoIncrement"`
+	EventID  string `gorm:"uniqueIndex"`
+	DeviceID string
+	Type     string
+	// Payload is the EventEnvelope.
+	Payload     RawJSON    `gorm:"type:jsonb"`
+	CreatedAt   time.Time  `gorm:"index"`
+	ForwardedAt *time.Time `gorm:"index"`
+	QueuedAt    *time.Time `gorm:"index"`
+}
+
+// recordEvent adds ev to the outbox within tx, the transaction that saves
+// the change behind ev, so that the event is recorded if and only if the
+// change is.
+func recordEvent(tx *gorm.DB, ev Event) error {
+	payload, err := json.Marshal(EventEnvelope{Version: EventEnvelopeVersion, Event: ev})
+	if err != nil {
+		return fmt.Errorf("encode event %s: %w", ev.ID, err)
+	}
+	err = tx.Create(&OutboxEvent{EventID: ev.ID, DeviceID: ev.DeviceID, Type: ev.Type, Payload: payload}).Error
+	if err != nil {
+		return fmt.Errorf("record %s event of device %s: %w", ev.Type, ev.DeviceID, err)
+	}
+	return nil
+}
+
+// withEvents runs fn in a transaction and, once it committed, wakes the
+// leader's outbox loop and the subscribers' tail if they run on this
+// replica, for the events fn published.
+func (m *Manager) withEvents(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	if err := m.db.WithContext(ctx).Transaction(fn); err != nil {
+		return err
+	}
+	for _, wake := range []chan struct{}{m.outboxWake, m.tailWake} {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// event decodes the recorded event.
+func (e *OutboxEvent) event() (Event, error) {
+	var env EventEnvelope
+	if err := json.Unmarshal(e.Payload, &env); err != nil {
+		return Event{}, fmt.Errorf("decode event %s: %w", e.EventID, err)
+	}
+	env.Event.Seq = e.Seq
+	return env.Event, nil
+}
+
+// RunEventOutbox forwards recorded events to out and queues their webhook
+// deliveries until ctx is done, and drops events older than
+// outboxRetention. With a nil out, events are not forwarded. Only the
+// leader should run it.
+func (m *Manager) RunEventOutbox(ctx context.Context, out EventStream) {
+	t := time.NewTicker(drainOutboxEvery)
+	defer t.Stop()
+	var pruned time.Time
+	for {
+		if out != nil {
+			m.forwardAll(ctx, out)
+		}
+		m.queueAll(ctx)
+		if time.Since(pruned) >= pruneOutboxEvery {
+			if err := m.pruneOutbox(ctx, out != nil); err != nil && ctx.Err() == nil {
+				m.lg.Error().Err(err).Msg("failed to prune event outbox")
+			}
+			pruned = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-m.outboxWake:
+		}
+	}
+}
+
+// forwardAll forwards events until none are left or one fails, which is
+// reported along with how many events are waiting behind it.
+func (m *Manager) forwardAll(ctx context.Context, out EventStream) {
+	for {
+		n, err := m.ForwardEvents(ctx, out)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			var waiting int64
+			m.db.Model(&OutboxEvent{}).Where("forwarded_at IS NULL").Count(&waiting)
+			m.lg.Error().Err(err).Int64("waiting", waiting).Msg("failed to forward events, will retry")
+			return
+		}
+		if n < outboxBatch {
+			return
+		}
+	}
+}
+
+// queueAll queues the webhook deliveries of events until none are left or
+// queueing fails, which is reported.
+func (m *Manager) queueAll(ctx context.Context) {
+	for {
+		n, err := m.QueueWebhookDeliveries(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				m.lg.Error().Err(err).Msg("failed to queue webhook deliveries, will retry")
+			}
+			return
+		}
+		if n < outboxBatch {
+			return
+		}
+	}
+}
+
+// ForwardEvents publishes the events not forwarded yet to out once, oldest
+// first, and returns how many were. It stops at the first event that cannot
+// be published, so the stream keeps the order of the events; the message ID
+// makes it safe to publish an event again.
+func (m *Manager) ForwardEvents(ctx context.Context, out EventStream) (int, error) {
+	var pending []OutboxEvent
+	err := m.db.WithContext(ctx).Where("forwarded_at IS NULL").Order("seq").Limit(outboxBatch).Find(&pending).Error
+	if err != nil || len(pending) == 0 {
+		return 0, err
+	}
+	var forwarded []uint64
+	for _, e := range pending {
+		pubCtx, cancel := context.WithTimeout(ctx, m.opts.EventPublishTimeout)
+		err = out.Publish(pubCtx, EventSubject(e.DeviceID, e.Type), e.EventID, e.Payload)
+		cancel()
+		if err != nil {
+			err = fmt.Errorf("publish event %s: %w", e.EventID, err)
+			break
+		}
+		forwarded = append(forwarded, e.Seq)
+	}
+	if len(forwarded) > 0 {
+		markErr := m.db.Model(&OutboxEvent{}).Where("seq IN ?", forwarded).
+			Update("forwarded_at", time.Now().UTC()).Error
+		if markErr != nil && err == nil {
+			err = fmt.Errorf("mark events forwarded: %w", markErr)
+		}
+	}
+	return len(forwarded), err
+}
+
+// pruneOutbox drops the events older than outboxRetention. Events whose
+// webhook deliveries were never queued, or that were never forwarded
+// although forwarding is on, are reported as gaps.
+func (m *Manager) pruneOutbox(ctx context.Context, forwarding bool) error {
+	cutoff := time.Now().UTC().Add(-outboxRetention)
+	db := m.db.WithContext(ctx)
+	var unqueued int64
+	if err := db.Model(&OutboxEvent{}).Where("created_at < ? AND queued_at IS NULL", cutoff).Count(&unqueued).Error; err != nil {
+		return err
+	}
+	if unqueued > 0 {
+		m.lg.Error().Int64("events", unqueued).Dur("retention", outboxRetention).
+			Msg("dropping events whose webhook deliveries were never queued")
+	}
+	if forwarding {
+		var lost int64
+		if err := db.Model(&OutboxEvent{}).Where("created_at < ? AND forwarded_at IS NULL", cutoff).Count(&lost).Error; err != nil {
+			return err
+		}
+		if lost > 0 {
+			m.lg.Error().Int64("events", lost).Dur("retention", outboxRetention).
+				Msg("dropping events that were never forwarded, the event stream has a gap")
+		}
+	}
+	return db.Where("created_at < ?", cutoff).Delete(&OutboxEvent{}).Error
+}
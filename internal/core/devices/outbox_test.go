@@ -0,0 +1,173 @@
+package devices
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"service-io/internal/adapters/traefik"
+
+	"github.com/rs/zerolog"
+)
+
+// fakeEventStream is an in-memory EventStream that fails while down.
+type fakeEventStream struct {
+	mu       sync.Mutex
+	down     bool
+	subjects []string
+	events   []EventEnvelope
+}
+
+func (s *fakeEventStream) Publish(ctx context.Context, subject, msgID string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		return errors.New("nats: no responders available for request")
+	}
+	var env EventEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return err
+	}
+	if env.ID != msgID {
+		return errors.New("message ID is not the event ID")
+	}
+	s.subjects = append(s.subjects, subject)
+	s.events = append(s.events, env)
+	return nil
+}
+
+func (s *fakeEventStream) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func TestForwardEvents(t *testing.T) {
+	env := newTestManager(t, Options{})
+	out := &fakeEventStream{down: true}
+
+	a := env.addDevice(t, "plc-1")
+	b := env.addDevice(t, "plc-2")
+
+	// Events published while the stream is down wait in the outbox.
+	if n, err := env.m.ForwardEvents(context.Background(), out); err == nil || n != 0 {
+		t.Fatalf("forward while down = %d, %v, want an error", n, err)
+	}
+	out.setDown(false)
+	n, err := env.m.ForwardEvents(context.Background(), out)
+	if err != nil || n != 2 {
+		t.Fatalf("forward = %d, %v, want 2 events", n, err)
+	}
+	for i, dev := range []*Device{a, b} {
+		got := out.events[i]
+		if got.Version != EventEnvelopeVersion || got.DeviceID != dev.ID || got.Type != EventCreated {
+			t.Errorf("event %d = %+v, want v%d created of %s", i, got, EventEnvelopeVersion, dev.ID)
+		}
+		if want := EventSubject(dev.ID, EventCreated); out.subjects[i] != want {
+			t.Errorf("subject %d = %s, want %s", i, out.subjects[i], want)
+		}
+	}
+
+	if n, err := env.m.ForwardEvents(context.Background(), out); err != nil || n != 0 {
+		t.Errorf("forward again = %d, %v, want nothing left", n, err)
+	}
+}
+
+func TestEventRecordedWithChange(t *testing.T) {
+	env := newTestManager(t, Options{})
+	dev := env.addDevice(t, "plc-1")
+
+	// A change whose event cannot be recorded is not saved either.
+	if err := env.m.db.Migrator().DropTable(&OutboxEvent{}); err != nil {
+		t.Fatalf("drop outbox: %v", err)
+	}
+	name := "plc-renamed"
+	if _, err := env.m.UpdateDevice(context.Background(), dev.ID, DeviceUpdate{Name: &name}); err == nil {
+		t.Fatalf("update saved without its event")
+	}
+	if got := env.device(t, dev.ID); got.Name != dev.Name {
+		t.Errorf("name = %q, want %q", got.Name, dev.Name)
+	}
+}
+
+// nextEvent returns the next event of a subscription.
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return Event{}
+}
+
+func TestSubscribeSeesEveryReplica(t *testing.T) {
+	env := newTestManager(t, Options{})
+	tc := traefik.New(traefik.Config{BaseDomain: "localhost", Network: "test", Logger: zerolog.Nop()})
+	other, err := New(env.m.db, env.streams, "nats://nats:4222", env.rt, tc, zerolog.Nop(), Options{})
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	events, unsubscribe := env.m.Subscribe()
+	defer unsubscribe()
+
+	// A device added through another replica.
+	dev, err := other.AddDevice(context.Background(), NewDevice{Type: "mqtt", Name: "plc-1"})
+	if err != nil {
+		t.Fatalf("add device: %v", err)
+	}
+	first := nextEvent(t, events)
+	if first.Type != EventCreated || first.DeviceID != dev.ID || first.Seq == 0 {
+		t.Fatalf("event = %+v, want the created event of %s with its sequence number", first, dev.ID)
+	}
+
+	// A subscriber that saw the first event gets the ones after it.
+	if _, err := other.StopDevice(context.Background(), dev.ID); err != nil {
+		t.Fatalf("stop device: %v", err)
+	}
+	if ev := nextEvent(t, events); ev.Type != EventStopped {
+		t.Fatalf("event = %s, want %s", ev.Type, EventStopped)
+	}
+	missed, resumed, cancel, ok := env.m.Resume(context.Background(), first.Seq)
+	defer cancel()
+	if !ok || len(missed) != 1 || missed[0].Type != EventStopped || missed[0].Seq <= first.Seq {
+		t.Errorf("missed = %+v, %v, want the stopped event", missed, ok)
+	}
+	if _, err := other.StartDevice(context.Background(), dev.ID); err != nil {
+		t.Fatalf("start device: %v", err)
+	}
+	if ev := nextEvent(t, resumed); ev.Type != EventStarted {
+		t.Errorf("event = %s, want %s", ev.Type, EventStarted)
+	}
+
+	// Unknown sequence numbers cannot be resumed from.
+	_, _, cancelUnknown, ok := env.m.Resume(context.Background(), first.Seq+1000)
+	cancelUnknown()
+	if ok {
+		t.Errorf("resumed after an unknown event")
+	}
+}
+
+func TestCloseSubscriptions(t *testing.T) {
+	env := newTestManager(t, Options{})
+	events, unsubscribe := env.m.Subscribe()
+	defer unsubscribe()
+
+	env.m.CloseSubscriptions()
+	if _, ok := <-events; ok {
+		t.Errorf("subscription still open")
+	}
+	// Streams opened while shutting down end right away.
+	later, unsubscribeLater := env.m.Subscribe()
+	defer unsubscribeLater()
+	if _, ok := <-later; ok {
+		t.Errorf("new subscription open after closing")
+	}
+}
@@ -0,0 +1,396 @@
+package devices
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"service-io/internal/core/runtime"
+)
+
+// Repair actions taken by the reconciler.
+const (
+	RepairRecreated       = "recreated"
+	RepairFailed          = "failed"
+	RepairRemoved         = "removed"
+	RepairStreamRecreated = "stream_recreated"
+)
+
+// ReconcileReport is the outcome of one reconcile pass.
+type ReconcileReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Checked is the number of devices compared against their containers
+	// and streams.
+	Checked int      `json:"checked" example:"42"`
+	Repairs []Repair `json:"repairs"`
+	// Orphans are adapter containers and DEV_* streams that belong to no
+	// device. They are reported, never removed.
+	OrphanContainers []OrphanContainer `json:"orphan_containers"`
+	OrphanStreams    []string          `json:"orphan_streams" example:"DEV_EDIVRWCLGGPGCW7M"`
+	// Errors lists checks that could not be done, e.g. for an unreachable host.
+	Errors []string `json:"errors"`
+}
+
+// Repair is drift the reconciler found on a device and what it did about it.
+type Repair struct {
+	DeviceID string `json:"device_id" example:"EDIVRWCLGGPGCW7M"`
+	Action   string `json:"action" example:"recreated"`
+	Reason   string `json:"reason" example:"container missing"`
+	Error    string `json:"error,omitempty"`
+}
+
+// OrphanContainer is an adapter container without a device record.
+type OrphanContainer struct {
+	Host     string `json:"host,omitempty" example:"edge-1"`
+	ID       string `json:"id" example:"3518d34547496f2a8c4af44be3c71d7f..."`
+	Name     string `json:"name" example:"adapter-EDIVRWCLGGPGCW7M"`
+	DeviceID string `json:"device_id" example:"EDIVRWCLGGPGCW7M"`
+}
+
+// RunReconciler reconciles every interval until ctx is done.
+func (m *Manager) RunReconciler(ctx context.Context, interval time.Duration) {
+	m.lg.Info().Dur("interval", interval).Msg("reconciler started")
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if _, err := m.Reconcile(ctx); err != nil && ctx.Err() == nil {
+			m.lg.Error().Err(err).Msg("reconcile failed")
+		}
+	}
+}
+
+// LastReconcile returns the report of the latest reconcile pass, or nil if
+// none has run yet.
+func (m *Manager) LastReconcile() *ReconcileReport {
+	m.reportMu.Lock()
+	defer m.reportMu.Unlock()
+	return m.lastReport
+}
+
+// Reconcile compares every device record with its container, its DEV_<id>
+// stream and its routing labels, and repairs drift:
+//
+//   - a running device whose container is missing, not running or carries
+//     stale routing labels is recreated, or marked failed if that does not
+//     work;
+//   - a container left behind by a stopped, failed or deleted device is removed;
+//   - a missing stream is recreated.
+//
+// Pending devices are skipped, since they are still being created. Only the
+// leader replica reconciles; others get ErrNotLeader.
+func (m *Manager) Reconcile(ctx context.Context) (*ReconcileReport, error) {
+	if m.opts.IsLeader != nil && !m.opts.IsLeader() {
+		return nil, ErrNotLeader
+	}
+	m.reconcileMu.Lock()
+	defer m.reconcileMu.Unlock()
+
+	rep := &ReconcileReport{
+		StartedAt:        time.Now().UTC(),
+		Repairs:          []Repair{},
+		OrphanContainers: []OrphanContainer{},
+		OrphanStreams:    []string{},
+		Errors:           []string{},
+	}
+
+	// Instances and streams are listed before the devices, so anything
+	// created in between has its record already and is not an orphan.
+	hosts := []string{""}
+	registered, err := m.ListHosts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list hosts: %w", err)
+	}
+	for _, h := range registered {
+		hosts = append(hosts, h.Name)
+	}
+	instances := make(map[string]map[string]runtime.Instance, len(hosts))
+	for _, host := range hosts {
+		list, err := m.listInstances(ctx, host)
+		if err != nil {
+			rep.Errors = append(rep.Errors, fmt.Sprintf("host %q: %v", host, err))
+			continue
+		}
+		instances[host] = list
+	}
+	streams := make(map[string]bool)
+	names, err := m.nc.StreamNames()
+	if err != nil {
+		rep.Errors = append(rep.Errors, fmt.Sprintf("list streams: %v", err))
+		streams = nil
+	}
+	for _, n := range names {
+		streams[n] = true
+	}
+
+	var devs []Device
+	if err := m.db.WithContext(ctx).Where("status <> ?", StatusPending).Find(&devs).Error; err != nil {
+		return nil, fmt.Errorf("list devices: %w", err)
+	}
+	// Devices with an operation at work are left to it; their containers
+	// and streams come and go as it goes on.
+	busy, err := m.busyDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range devs {
+		dev := &devs[i]
+		if streams != nil {
+			if !streams[dev.streamName()] && dev.Status != StatusDeleted && !busy[dev.ID] {
+				if r, ok := m.repairStream(ctx, dev); ok {
+					rep.Repairs = append(rep.Repairs, r)
+				}
+			}
+			delete(streams, dev.streamName())
+		}
+
+		onHost, ok := instances[dev.Host]
+		if !ok {
+			// The host could not be listed; its error is already reported.
+			continue
+		}
+		rep.Checked++
+		inst, found := onHost[dev.ID]
+		delete(onHost, dev.ID)
+		if busy[dev.ID] {
+			continue
+		}
+
+		if !dev.Status.active() {
+			if found {
+				if r, ok := m.removeLeftover(ctx, dev, inst); ok {
+					rep.Repairs = append(rep.Repairs, r)
+				}
+			}
+			continue
+		}
+		if dev.Status != StatusRunning {
+			// Exited adapters are restarted according to their type's
+			// restart policy, not by the reconciler.
+			continue
+		}
+		var reason string
+		down := !found || !inst.Running
+		switch {
+		case !found:
+			reason = "container missing"
+		case !inst.Running:
+			reason = "container not running"
+		default:
+			drifted, err := m.routeDrifted(ctx, dev, inst)
+			if err != nil {
+				rep.Errors = append(rep.Errors, fmt.Sprintf("device %s: check routing labels: %v", dev.ID, err))
+			} else if drifted {
+				reason = "routing labels out of date"
+			}
+		}
+		if reason != "" {
+			if r, ok := m.recreate(ctx, dev, reason, down); ok {
+				rep.Repairs = append(rep.Repairs, r)
+			}
+		}
+	}
+
+	for host, left := range instances {
+		for _, inst := range left {
+			rep.OrphanContainers = append(rep.OrphanContainers, OrphanContainer{
+				Host: host, ID: inst.ID, Name: inst.Name, DeviceID: inst.DeviceID,
+			})
+		}
+	}
+	sort.Slice(rep.OrphanContainers, func(i, j int) bool {
+		a, b := rep.OrphanContainers[i], rep.OrphanContainers[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		return a.Name < b.Name
+	})
+	for name := range streams {
+		if strings.HasPrefix(name, "DEV_") {
+			rep.OrphanStreams = append(rep.OrphanStreams, name)
+		}
+	}
+	sort.Strings(rep.OrphanStreams)
+
+	rep.FinishedAt = time.Now().UTC()
+	m.reportMu.Lock()
+	m.lastReport = rep
+	m.reportMu.Unlock()
+
+	ev := m.lg.Info()
+	if len(rep.Repairs) > 0 || len(rep.OrphanContainers) > 0 || len(rep.OrphanStreams) > 0 || len(rep.Errors) > 0 {
+		ev = m.lg.Warn()
+	}
+	ev.Int("checked", rep.Checked).Int("repairs", len(rep.Repairs)).
+		Int("orphan_containers", len(rep.OrphanContainers)).Int("orphan_streams", len(rep.OrphanStreams)).
+		Int("errors", len(rep.Errors)).Dur("took", rep.FinishedAt.Sub(rep.StartedAt)).Msg("reconcile complete")
+	return rep, nil
+}
+
+// listInstances returns the adapter instances on a host by device ID.
+func (m *Manager) listInstances(ctx context.Context, host string) (map[string]runtime.Instance, error) {
+	rt, err := m.runtimeFor(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	list, err := rt.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byDevice := make(map[string]runtime.Instance, len(list))
+	for _, inst := range list {
+		byDevice[inst.DeviceID] = inst
+	}
+	return byDevice, nil
+}
+
+// routeDrifted reports whether the routing labels of a device's instance
+// differ from the ones it would be created with now, e.g. after the base
+// domain or the adapter's port changed. Instances without routing labels
+// are routed by other means and never drift.
+func (m *Manager) routeDrifted(ctx context.Context, dev *Device, inst runtime.Instance) (bool, error) {
+	if inst.Labels["traefik.enable"] == "" {
+		return false, nil
+	}
+	rt, err := m.runtimeFor(ctx, dev.Host)
+	if err != nil {
+		return false, err
+	}
+	profile, err := m.resolveAdapter(ctx, rt, m.deviceAdapterType(ctx, dev), dev.imageRef(), false)
+	if err != nil {
+		return false, err
+	}
+	route, _ := m.traefik.RouteForDevice(dev.ID, profile.port, profile.tls)
+	want := m.traefik.DockerLabels(dev.ContainerName, route)
+
+	for k, v := range want {
+		if inst.Labels[k] != v {
+			return true, nil
+		}
+	}
+	for k := range inst.Labels {
+		if _, ok := want[k]; !ok && strings.HasPrefix(k, "traefik.") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// unchanged reloads a listed device and reports whether it still is as
+// listed and no operation started on it since.
+func (m *Manager) unchanged(ctx context.Context, listed *Device) (*Device, bool) {
+	dev, err := m.findDevice(listed.ID)
+	if err != nil || dev.Status != listed.Status || dev.ContainerID != listed.ContainerID {
+		return nil, false
+	}
+	if m.checkNoOperation(ctx, dev.ID) != nil {
+		return nil, false
+	}
+	return dev, true
+}
+
+// recreate brings a running device's container back, or marks the device
+// failed if that is not possible. It reports false if the device changed
+// since it was listed, in which case nothing is done; a container recreated
+// meanwhile is removed again.
+func (m *Manager) recreate(ctx context.Context, listed *Device, reason string, down bool) (Repair, bool) {
+	dev, ok := m.unchanged(ctx, listed)
+	if !ok {
+		return Repair{}, false
+	}
+	if down {
+		// The container may have come back (or been restarted) meanwhile.
+		if st, err := m.inspectContainer(ctx, dev); err == nil && st != nil && st.Running {
+			return Repair{}, false
+		}
+	}
+
+	r := Repair{DeviceID: dev.ID, Action: RepairRecreated, Reason: reason}
+	ev := Event{DeviceID: dev.ID, Type: EventRestarted, Actor: ActorFrom(ctx), Reason: reason}
+	columns := containerColumns
+	m.lg.Warn().Str("device_id", dev.ID).Str("reason", reason).Msg("drift detected, recreating adapter container")
+	if err := m.runContainer(ctx, dev); err != nil {
+		m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to recreate adapter container, marking device failed")
+		_ = dev.transition(StatusFailed)
+		dev.ContainerID = ""
+		columns = []string{"status", "container_id"}
+		r.Action, r.Error = RepairFailed, err.Error()
+		ev.Type, ev.Error = EventFailed, err.Error()
+	}
+	ev.Status = dev.Status
+	saved := false
+	err := m.withEvents(ctx, func(tx *gorm.DB) error {
+		res := tx.Model(dev).Where("status = ? AND container_id = ?", listed.Status, listed.ContainerID).
+			Select(columns).Updates(dev)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		saved = true
+		return m.publish(tx, ev)
+	})
+	if err == nil && !saved {
+		m.lg.Info().Str("device_id", dev.ID).Msg("device changed while repairing, removing recreated container")
+		if dev.ContainerID != "" {
+			if err := m.stopContainer(ctx, dev); err != nil {
+				m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to remove recreated container")
+			}
+		}
+		return Repair{}, false
+	}
+	if err != nil {
+		m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to save device after repair")
+		if r.Error == "" {
+			r.Error = err.Error()
+		}
+	}
+	return r, true
+}
+
+// removeLeftover removes a container that exists although its device is not
+// running. It reports false if the device changed since it was listed.
+func (m *Manager) removeLeftover(ctx context.Context, listed *Device, inst runtime.Instance) (Repair, bool) {
+	dev, ok := m.unchanged(ctx, listed)
+	if !ok {
+		return Repair{}, false
+	}
+	r := Repair{
+		DeviceID: dev.ID,
+		Action:   RepairRemoved,
+		Reason:   fmt.Sprintf("container exists for a %s device", dev.Status),
+	}
+	rt, err := m.runtimeFor(ctx, dev.Host)
+	if err == nil {
+		m.expectExit(inst.ID)
+		err = rt.Stop(ctx, inst.ID)
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	m.lg.Warn().Err(err).Str("device_id", dev.ID).Str("status", string(dev.Status)).Msg("removed leftover adapter container")
+	return r, true
+}
+
+// repairStream recreates a device's missing stream. It reports false if the
+// device changed since it was listed, e.g. because it is being purged.
+func (m *Manager) repairStream(ctx context.Context, listed *Device) (Repair, bool) {
+	dev, ok := m.unchanged(ctx, listed)
+	if !ok {
+		return Repair{}, false
+	}
+	r := Repair{DeviceID: dev.ID, Action: RepairStreamRecreated, Reason: "stream missing"}
+	if err := m.nc.EnsureStream(dev.NatsSubject, dev.streamName()); err != nil {
+		r.Error = err.Error()
+	}
+	m.lg.Warn().Str("device_id", dev.ID).Str("stream", dev.streamName()).Msg("recreated missing stream")
+	return r, true
+}
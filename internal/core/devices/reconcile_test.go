@@ -0,0 +1,203 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"service-io/internal/core/runtime"
+)
+
+// reconcile runs one reconcile pass that must check every host and stream.
+func (env *testEnv) reconcile(t *testing.T) *ReconcileReport {
+	t.Helper()
+	rep, err := env.m.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(rep.Errors) > 0 {
+		t.Fatalf("reconcile errors: %v", rep.Errors)
+	}
+	return rep
+}
+
+func TestReconcileRecreates(t *testing.T) {
+	tests := []struct {
+		name   string
+		reason string
+		drift  func(t *testing.T, env *testEnv, dev *Device)
+	}{
+		{"container missing", "container missing", func(t *testing.T, env *testEnv, dev *Device) {
+			env.rt.Stop(context.Background(), dev.ContainerID)
+		}},
+		{"container exited", "container not running", func(t *testing.T, env *testEnv, dev *Device) {
+			env.rt.Crash(dev.ContainerID, 1)
+		}},
+		{"stale route", "routing labels out of date", func(t *testing.T, env *testEnv, dev *Device) {
+			_, err := env.rt.Run(context.Background(), runtime.AdapterSpec{
+				Name: dev.ContainerName, DeviceID: dev.ID, Image: dev.ImageDigest,
+				Labels: map[string]string{
+					"traefik.enable":                      "true",
+					"traefik.tcp.routers.old.entrypoints": "mqtt",
+				},
+			})
+			if err != nil {
+				t.Fatalf("run stale container: %v", err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestManager(t, Options{})
+			dev := env.addDevice(t, "plc-1")
+			tt.drift(t, env, dev)
+
+			rep := env.reconcile(t)
+			want := Repair{DeviceID: dev.ID, Action: RepairRecreated, Reason: tt.reason}
+			if len(rep.Repairs) != 1 || rep.Repairs[0] != want {
+				t.Fatalf("repairs = %+v, want %+v", rep.Repairs, want)
+			}
+			got := env.device(t, dev.ID)
+			inst, ok := env.rt.Instance(got.ContainerID)
+			if got.Status != StatusRunning || !ok || !inst.State.Running {
+				t.Errorf("device is %s on %s, want running on a new container", got.Status, got.ContainerID)
+			}
+			if n := len(env.rt.Instances()); n != 1 {
+				t.Errorf("%d instances, want 1", n)
+			}
+			// The next pass finds nothing to repair.
+			if rep := env.reconcile(t); len(rep.Repairs) != 0 {
+				t.Errorf("repairs again = %+v", rep.Repairs)
+			}
+		})
+	}
+}
+
+func TestReconcileMarksFailed(t *testing.T) {
+	env := newTestManager(t, Options{})
+	dev := env.addDevice(t, "plc-1")
+	env.rt.Stop(context.Background(), dev.ContainerID)
+	env.rt.FailRun(testImage, errors.New("no space left on device"))
+
+	rep := env.reconcile(t)
+	if len(rep.Repairs) != 1 || rep.Repairs[0].Action != RepairFailed || rep.Repairs[0].Error == "" {
+		t.Fatalf("repairs = %+v, want the device marked failed", rep.Repairs)
+	}
+	if got := env.device(t, dev.ID); got.Status != StatusFailed || got.ContainerID != "" {
+		t.Errorf("device is %s on %q, want failed without a container", got.Status, got.ContainerID)
+	}
+}
+
+func TestReconcileRemovesLeftover(t *testing.T) {
+	env := newTestManager(t, Options{})
+	dev := env.addDevice(t, "plc-1")
+	if _, err := env.m.StopDevice(context.Background(), dev.ID); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	// The container comes back, e.g. restarted by hand.
+	_, err := env.rt.Run(context.Background(), runtime.AdapterSpec{Name: dev.ContainerName, DeviceID: dev.ID, Image: dev.ImageDigest})
+	if err != nil {
+		t.Fatalf("run leftover: %v", err)
+	}
+
+	rep := env.reconcile(t)
+	if len(rep.Repairs) != 1 || rep.Repairs[0].Action != RepairRemoved || rep.Repairs[0].Error != "" {
+		t.Fatalf("repairs = %+v, want the leftover removed", rep.Repairs)
+	}
+	if n := len(env.rt.Instances()); n != 0 {
+		t.Errorf("%d instances left", n)
+	}
+	if got := env.device(t, dev.ID); got.Status != StatusStopped {
+		t.Errorf("device is %s, want %s", got.Status, StatusStopped)
+	}
+}
+
+func TestReconcileRecreatesStream(t *testing.T) {
+	env := newTestManager(t, Options{})
+	dev := env.addDevice(t, "plc-1")
+	env.streams.DeleteStream(dev.streamName())
+
+	rep := env.reconcile(t)
+	want := Repair{DeviceID: dev.ID, Action: RepairStreamRecreated, Reason: "stream missing"}
+	if len(rep.Repairs) != 1 || rep.Repairs[0] != want {
+		t.Fatalf("repairs = %+v, want %+v", rep.Repairs, want)
+	}
+	if !env.streams.has(dev.streamName()) {
+		t.Errorf("stream %s not recreated", dev.streamName())
+	}
+}
+
+func TestReconcileReportsOrphans(t *testing.T) {
+	env := newTestManager(t, Options{})
+	env.addDevice(t, "plc-1")
+	id, err := env.rt.Run(context.Background(), runtime.AdapterSpec{Name: "adapter-GONE", DeviceID: "GONE", Image: testImage})
+	if err != nil {
+		t.Fatalf("run orphan: %v", err)
+	}
+	env.streams.EnsureStream("dev.GONE.>", "DEV_GONE")
+
+	rep := env.reconcile(t)
+	if len(rep.Repairs) != 0 {
+		t.Errorf("repairs = %+v, want none", rep.Repairs)
+	}
+	want := OrphanContainer{ID: id, Name: "adapter-GONE", DeviceID: "GONE"}
+	if len(rep.OrphanContainers) != 1 || rep.OrphanContainers[0] != want {
+		t.Errorf("orphan containers = %+v, want %+v", rep.OrphanContainers, want)
+	}
+	if len(rep.OrphanStreams) != 1 || rep.OrphanStreams[0] != "DEV_GONE" {
+		t.Errorf("orphan streams = %v, want DEV_GONE", rep.OrphanStreams)
+	}
+	// Orphans are only reported.
+	if _, ok := env.rt.Instance(id); !ok || !env.streams.has("DEV_GONE") {
+		t.Errorf("orphans removed")
+	}
+}
+
+func TestReconcileSkipsBusyDevices(t *testing.T) {
+	env := newTestManager(t, Options{})
+	dev := env.addDevice(t, "plc-1")
+	// A purge is under way: the container and the stream are already gone.
+	if _, err := env.m.recordOperation(context.Background(), OperationPurge, dev.ID); err != nil {
+		t.Fatalf("record purge: %v", err)
+	}
+	env.rt.Stop(context.Background(), dev.ContainerID)
+	env.streams.DeleteStream(dev.streamName())
+
+	rep := env.reconcile(t)
+	if len(rep.Repairs) != 0 {
+		t.Errorf("repairs = %+v, want the device left to its operation", rep.Repairs)
+	}
+	if n := len(env.rt.Instances()); n != 0 || env.streams.has(dev.streamName()) {
+		t.Errorf("container or stream recreated under a purge")
+	}
+}
+
+func TestReconcileDropsRepairOfChangedDevice(t *testing.T) {
+	env := newTestManager(t, Options{})
+	dev := env.addDevice(t, "plc-1")
+	env.rt.Stop(context.Background(), dev.ContainerID)
+
+	// The device is deleted while its container is being recreated.
+	env.rt.SetStartDelay(200 * time.Millisecond)
+	done := make(chan *ReconcileReport)
+	go func() {
+		rep, _ := env.m.Reconcile(context.Background())
+		done <- rep
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := env.m.db.Model(&Device{}).Where("id = ?", dev.ID).Update("status", StatusDeleted).Error; err != nil {
+		t.Fatalf("delete device: %v", err)
+	}
+
+	rep := <-done
+	if rep == nil || len(rep.Repairs) != 0 {
+		t.Fatalf("report = %+v, want no repairs", rep)
+	}
+	if got := env.device(t, dev.ID); got.Status != StatusDeleted {
+		t.Errorf("device is %s, want %s", got.Status, StatusDeleted)
+	}
+	if n := len(env.rt.Instances()); n != 0 {
+		t.Errorf("%d instances left, want the recreated container removed", n)
+	}
+}
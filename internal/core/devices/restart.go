@@ -0,0 +1,354 @@
+package devices
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"service-io/internal/core/runtime"
+)
+
+const (
+	// logTailLines is how many trailing log lines are kept on a device when
+	// its container exits, up to maxLogTailBytes.
+	logTailLines    = 50
+	maxLogTailBytes = 16 << 10
+	// restartTimeout bounds a supervised restart, including any image pull.
+	restartTimeout = 5 * time.Minute
+)
+
+// crashHistory is the recent exits of one device and its pending timers.
+type crashHistory struct {
+	exits    []time.Time
+	restart  *time.Timer
+	recovery *time.Timer
+}
+
+// afterExit applies the restart policy of a device's type within tx, the
+// transaction recording that its container exited on its own: it records
+// the exit, marks the device crashlooping when it exited too often and
+// schedules a restart with backoff. It returns the device's resulting
+// status.
+func (m *Manager) afterExit(tx *gorm.DB, dev *Device, exitCode int) (Status, error) {
+	// Devices of an unknown type get the default policy.
+	var t AdapterType
+	if err := tx.Limit(1).Find(&t, "name = ?", dev.DeviceType).Error; err != nil {
+		return "", fmt.Errorf("look up adapter type %q: %w", dev.DeviceType, err)
+	}
+	if !t.RestartPolicy.restarts(exitCode) {
+		m.forgetCrashes(dev.ID)
+		m.lg.Info().Str("device_id", dev.ID).Int("exit_code", exitCode).
+			Str("restart_policy", string(t.RestartPolicy)).Msg("adapter exited, not restarting")
+		return dev.Status, nil
+	}
+
+	exits, delay := m.recordExit(dev.ID, dev.ContainerID)
+	status := dev.Status
+	if exits >= m.opts.CrashLoopThreshold {
+		marked, err := m.markCrashLooping(tx, dev.ID, dev.ContainerID)
+		if err != nil {
+			return "", err
+		}
+		if marked {
+			status = StatusCrashLooping
+		}
+	}
+	m.lg.Warn().Str("device_id", dev.ID).Int("exit_code", exitCode).Int("exits", exits).
+		Dur("restart_in", delay).Str("status", string(status)).Msg("adapter exited, restart scheduled")
+	return status, nil
+}
+
+// recordExit adds an exit to a device's history and schedules the restart of
+// containerID. It returns the number of exits within the crash-loop window
+// and the restart delay.
+func (m *Manager) recordExit(deviceID, containerID string) (int, time.Duration) {
+	now := time.Now()
+	m.crashMu.Lock()
+	defer m.crashMu.Unlock()
+
+	h := m.crashes[deviceID]
+	if h == nil {
+		h = &crashHistory{}
+		m.crashes[deviceID] = h
+	}
+	h.exits = append(h.exits, now)
+	h.prune(now, m.opts.CrashLoopWindow)
+	n := len(h.exits)
+
+	delay := m.opts.MaxRestartBackoff
+	if n <= 30 {
+		delay = min(m.opts.RestartBackoff<<(n-1), m.opts.MaxRestartBackoff)
+	}
+	h.stop()
+	h.restart = time.AfterFunc(delay, func() { m.restartExited(deviceID, containerID) })
+	return n, delay
+}
+
+// restartExited recreates the container of an exited or crashlooping
+// device, unless the device changed meanwhile, an operation runs on it or
+// its runtime already restarted the container itself. A container started
+// for a device that changed during the restart is removed again.
+func (m *Manager) restartExited(deviceID, containerID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), restartTimeout)
+	defer cancel()
+
+	dev, err := m.findDevice(deviceID)
+	if err != nil || dev.ContainerID != containerID ||
+		dev.Status != StatusExited && dev.Status != StatusCrashLooping {
+		return
+	}
+	if err := m.checkNoOperation(ctx, deviceID); err != nil {
+		return
+	}
+	if st, err := m.inspectContainer(ctx, dev); err == nil && st != nil && st.Running {
+		return
+	}
+
+	if err := m.runContainer(ctx, dev); err != nil {
+		m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to restart exited adapter")
+		msg := fmt.Sprintf("restart failed: %v", err)
+		err := m.db.Model(&Device{}).Where("id = ? AND container_id = ?", dev.ID, containerID).
+			Update("last_error", msg).Error
+		if err != nil {
+			m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to save restart error")
+		}
+		// Count the failed attempt as another exit so retries back off too.
+		if exits, _ := m.recordExit(dev.ID, containerID); exits >= m.opts.CrashLoopThreshold {
+			err := m.withEvents(context.WithoutCancel(ctx), func(tx *gorm.DB) error {
+				marked, err := m.markCrashLooping(tx, dev.ID, containerID)
+				if err != nil || !marked {
+					return err
+				}
+				return m.publish(tx, Event{DeviceID: dev.ID, Type: EventCrashLooping, Status: StatusCrashLooping,
+					Reason: "restart failed", Error: msg, Time: time.Now().UTC()})
+			})
+			if err != nil {
+				m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to mark device crashlooping")
+			}
+		}
+		return
+	}
+
+	// A crashlooping device keeps its status until it stays up for a while.
+	from := dev.Status
+	if dev.Status == StatusExited {
+		dev.Status = StatusRunning
+	}
+	dev.RestartCount++
+	saved := false
+	err = m.withEvents(context.WithoutCancel(ctx), func(tx *gorm.DB) error {
+		res := tx.Model(&Device{}).Where("id = ? AND status = ? AND container_id = ?", dev.ID, from, containerID).
+			Updates(map[string]any{
+				"status":        dev.Status,
+				"restart_count": gorm.Expr("restart_count + 1"),
+				"container_id":  dev.ContainerID,
+				"container_url": dev.ContainerURL,
+				"image_digest":  dev.ImageDigest,
+				"health":        dev.Health,
+			})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		saved = true
+		return m.publish(tx, Event{DeviceID: dev.ID, Type: EventRestarted, Status: dev.Status,
+			Reason: "restart after exit", Time: time.Now().UTC()})
+	})
+	if err != nil || !saved {
+		if err != nil {
+			m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to save restarted device")
+		} else {
+			m.lg.Info().Str("device_id", dev.ID).Msg("device changed while restarting, removing new container")
+		}
+		if err := m.stopContainer(context.WithoutCancel(ctx), dev); err != nil {
+			m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to remove container of restart")
+		}
+		return
+	}
+	m.lg.Info().Str("device_id", dev.ID).Int("restart_count", dev.RestartCount).Msg("adapter restarted")
+	m.watchRecovery(dev.ID)
+}
+
+// markCrashLooping moves an exited device to crashlooping within tx and
+// reports whether it did.
+func (m *Manager) markCrashLooping(tx *gorm.DB, deviceID, containerID string) (bool, error) {
+	res := tx.Model(&Device{}).
+		Where("id = ? AND container_id = ? AND status = ?", deviceID, containerID, StatusExited).
+		Update("status", StatusCrashLooping)
+	if res.Error != nil {
+		return false, fmt.Errorf("mark device %s crashlooping: %w", deviceID, res.Error)
+	}
+	if res.RowsAffected > 0 {
+		m.lg.Warn().Str("device_id", deviceID).Msg("adapter is crashlooping")
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// watchRecovery clears a device's crash history once its container has
+// stayed up for a whole crash-loop window, and moves a crashlooping device
+// back to running.
+func (m *Manager) watchRecovery(deviceID string) {
+	m.crashMu.Lock()
+	defer m.crashMu.Unlock()
+	h := m.crashes[deviceID]
+	if h == nil {
+		return
+	}
+	if h.recovery != nil {
+		h.recovery.Stop()
+	}
+	h.recovery = time.AfterFunc(m.opts.CrashLoopWindow, func() { m.recover(deviceID) })
+}
+
+func (m *Manager) recover(deviceID string) {
+	m.crashMu.Lock()
+	h := m.crashes[deviceID]
+	if h != nil {
+		h.prune(time.Now(), m.opts.CrashLoopWindow)
+		if len(h.exits) > 0 {
+			// It exited again meanwhile; a later restart checks again.
+			m.crashMu.Unlock()
+			return
+		}
+		delete(m.crashes, deviceID)
+	}
+	m.crashMu.Unlock()
+
+	var recovered bool
+	err := m.withEvents(context.Background(), func(tx *gorm.DB) error {
+		res := tx.Model(&Device{}).Where("id = ? AND status = ?", deviceID, StatusCrashLooping).
+			Update("status", StatusRunning)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		recovered = true
+		return m.publish(tx, Event{DeviceID: deviceID, Type: EventRecovered, Status: StatusRunning,
+			Reason: fmt.Sprintf("up for %s", m.opts.CrashLoopWindow), Time: time.Now().UTC()})
+	})
+	if err != nil {
+		m.lg.Error().Err(err).Str("device_id", deviceID).Msg("failed to clear crashlooping status")
+		return
+	}
+	if recovered {
+		m.lg.Info().Str("device_id", deviceID).Msg("adapter recovered from crash loop")
+	}
+}
+
+// forgetCrashes drops a device's crash history and pending restart, e.g.
+// when it is started or stopped by hand.
+func (m *Manager) forgetCrashes(deviceID string) {
+	m.crashMu.Lock()
+	defer m.crashMu.Unlock()
+	if h := m.crashes[deviceID]; h != nil {
+		h.stop()
+		if h.recovery != nil {
+			h.recovery.Stop()
+		}
+		delete(m.crashes, deviceID)
+	}
+}
+
+// forgetAllCrashes drops the crash history and pending restarts of every
+// device.
+func (m *Manager) forgetAllCrashes() {
+	m.crashMu.Lock()
+	defer m.crashMu.Unlock()
+	for id, h := range m.crashes {
+		h.stop()
+		if h.recovery != nil {
+			h.recovery.Stop()
+		}
+		delete(m.crashes, id)
+	}
+}
+
+// captureLogTail stores the last log lines of an exited container on its
+// device.
+func (m *Manager) captureLogTail(dev Device) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rt, err := m.runtimeFor(ctx, dev.Host)
+	if err != nil {
+		return
+	}
+	rc, err := rt.Logs(ctx, dev.ContainerID, runtime.LogOptions{Tail: logTailLines})
+	if err != nil {
+		m.lg.Warn().Err(err).Str("device_id", dev.ID).Msg("failed to read logs of exited adapter")
+		return
+	}
+	defer rc.Close()
+	raw, err := io.ReadAll(rc)
+	if err != nil && len(raw) == 0 {
+		return
+	}
+	if len(raw) > maxLogTailBytes {
+		raw = raw[len(raw)-maxLogTailBytes:]
+	}
+	err = m.db.Model(&Device{}).Where("id = ? AND container_id = ?", dev.ID, dev.ContainerID).
+		Update("log_tail", string(raw)).Error
+	if err != nil {
+		m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to save adapter log tail")
+	}
+}
+
+// expectExitFor is how long after being stopped by service-io a container's
+// exit is still considered expected.
+const expectExitFor = time.Minute
+
+// ExpectedExit records that service-io is stopping or replacing a container.
+// It is kept in the database because the exit is observed by the leader's
+// watcher, which need not be the replica that stopped the container.
+type ExpectedExit struct {
+	ContainerID string    `gorm:"primaryKey"`
+	At          time.Time `gorm:"index"`
+}
+
+// expectExit notes that service-io is about to stop or replace a container,
+// so its exit is not taken for a crash. Expectations that were never
+// consumed are dropped once they are too old to matter.
+func (m *Manager) expectExit(containerID string) {
+	if containerID == "" {
+		return
+	}
+	now := time.Now()
+	err := m.db.Where("at < ?", now.Add(-expectExitFor)).Delete(&ExpectedExit{}).Error
+	if err == nil {
+		err = m.db.Clauses(clause.OnConflict{UpdateAll: true}).
+			Create(&ExpectedExit{ContainerID: containerID, At: now}).Error
+	}
+	if err != nil {
+		m.lg.Warn().Err(err).Str("container_id", containerID).Msg("failed to record expected exit")
+	}
+}
+
+// exitExpected reports whether service-io stopped the container itself. An
+// expectation covers one exit only, since runtimes that address instances
+// by name reuse the ID for the replacement.
+func (m *Manager) exitExpected(containerID string) bool {
+	res := m.db.Where("container_id = ? AND at >= ?", containerID, time.Now().Add(-expectExitFor)).
+		Delete(&ExpectedExit{})
+	if res.Error != nil {
+		m.lg.Warn().Err(res.Error).Str("container_id", containerID).Msg("failed to check expected exit")
+		return false
+	}
+	return res.RowsAffected > 0
+}
+
+// prune drops exits older than window.
+func (h *crashHistory) prune(now time.Time, window time.Duration) {
+	i := 0
+	for i < len(h.exits) && now.Sub(h.exits[i]) > window {
+		i++
+	}
+	h.exits = h.exits[i:]
+}
+
+func (h *crashHistory) stop() {
+	if h.restart != nil {
+		h.restart.Stop()
+	}
+}
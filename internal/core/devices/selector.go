@@ -0,0 +1,191 @@
+package devices
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidSelector is returned when a label selector cannot be parsed.
+var ErrInvalidSelector = errors.New("invalid label selector")
+
+// Selector operators.
+const (
+	OpEquals       = "="
+	OpNotEquals    = "!="
+	OpIn           = "in"
+	OpNotIn        = "notin"
+	OpExists       = "exists"
+	OpDoesNotExist = "!"
+)
+
+// Requirement is a single clause of a label selector.
+type Requirement struct {
+	Key    string
+	Op     string
+	Values []string
+}
+
+// Selector is a conjunction of label requirements, written in the
+// Kubernetes style: "env=prod,tier!=edge,site in (a,b),critical,!legacy".
+type Selector []Requirement
+
+// ParseSelector parses a comma-separated label selector. An empty string
+// yields an empty selector, which matches everything.
+func ParseSelector(s string) (Selector, error) {
+	clauses, err := splitClauses(s)
+	if err != nil {
+		return nil, err
+	}
+	var sel Selector
+	for _, clause := range clauses {
+		req, err := parseRequirement(clause)
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, req)
+	}
+	return sel, nil
+}
+
+// splitClauses splits a selector on the commas that are not inside a
+// parenthesised value set.
+func splitClauses(s string) ([]string, error) {
+	var (
+		clauses []string
+		depth   int
+		start   int
+	)
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("%w: unbalanced parentheses", ErrInvalidSelector)
+			}
+		case ',':
+			if depth == 0 {
+				clauses = append(clauses, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("%w: unbalanced parentheses", ErrInvalidSelector)
+	}
+	clauses = append(clauses, s[start:])
+
+	out := clauses[:0]
+	for _, c := range clauses {
+		if c = strings.TrimSpace(c); c != "" {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func parseRequirement(clause string) (Requirement, error) {
+	if open := strings.IndexByte(clause, '('); open >= 0 {
+		return parseSetRequirement(clause, open)
+	}
+	switch {
+	case strings.HasPrefix(clause, "!"):
+		return newRequirement(clause[1:], OpDoesNotExist)
+	case strings.Contains(clause, "!="):
+		k, v, _ := strings.Cut(clause, "!=")
+		return newRequirement(k, OpNotEquals, v)
+	case strings.Contains(clause, "=="):
+		k, v, _ := strings.Cut(clause, "==")
+		return newRequirement(k, OpEquals, v)
+	case strings.Contains(clause, "="):
+		k, v, _ := strings.Cut(clause, "=")
+		return newRequirement(k, OpEquals, v)
+	default:
+		return newRequirement(clause, OpExists)
+	}
+}
+
+// parseSetRequirement parses "key in (a,b)" and "key notin (a,b)".
+func parseSetRequirement(clause string, open int) (Requirement, error) {
+	if !strings.HasSuffix(clause, ")") {
+		return Requirement{}, fmt.Errorf("%w: %q", ErrInvalidSelector, clause)
+	}
+	fields := strings.Fields(clause[:open])
+	if len(fields) != 2 || (fields[1] != OpIn && fields[1] != OpNotIn) {
+		return Requirement{}, fmt.Errorf("%w: %q", ErrInvalidSelector, clause)
+	}
+	values := strings.Split(clause[open+1:len(clause)-1], ",")
+	return newRequirement(fields[0], fields[1], values...)
+}
+
+func newRequirement(key, op string, values ...string) (Requirement, error) {
+	key = strings.TrimSpace(key)
+	if err := validateLabelKey(key); err != nil {
+		return Requirement{}, fmt.Errorf("%w: %v", ErrInvalidSelector, err)
+	}
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return Requirement{Key: key, Op: op, Values: values}, nil
+}
+
+// apply adds the selector to a query over the devices table.
+func (s Selector) apply(tx *gorm.DB) *gorm.DB {
+	for _, r := range s {
+		switch r.Op {
+		case OpEquals:
+			tx = tx.Where("labels ->> ? = ?", r.Key, r.Values[0])
+		case OpNotEquals:
+			// Devices without the key match, as in Kubernetes.
+			tx = tx.Where("labels ->> ? IS DISTINCT FROM ?", r.Key, r.Values[0])
+		case OpIn:
+			tx = tx.Where("labels ->> ? IN ?", r.Key, r.Values)
+		case OpNotIn:
+			tx = tx.Where("(labels ->> ? IS NULL OR labels ->> ? NOT IN ?)", r.Key, r.Key, r.Values)
+		case OpExists:
+			tx = tx.Where("labels ->> ? IS NOT NULL", r.Key)
+		case OpDoesNotExist:
+			tx = tx.Where("labels ->> ? IS NULL", r.Key)
+		}
+	}
+	return tx
+}
+
+// Matches reports whether a label set satisfies the selector.
+func (s Selector) Matches(labels Labels) bool {
+	for _, r := range s {
+		v, ok := labels[r.Key]
+		switch r.Op {
+		case OpEquals:
+			if !ok || v != r.Values[0] {
+				return false
+			}
+		case OpNotEquals:
+			if ok && v == r.Values[0] {
+				return false
+			}
+		case OpIn:
+			if !ok || !slices.Contains(r.Values, v) {
+				return false
+			}
+		case OpNotIn:
+			if ok && slices.Contains(r.Values, v) {
+				return false
+			}
+		case OpExists:
+			if !ok {
+				return false
+			}
+		case OpDoesNotExist:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package devices
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Selector
+	}{
+		{"", nil},
+		{"env=prod", Selector{{Key: "env", Op: OpEquals, Values: []string{"prod"}}}},
+		{"env==prod", Selector{{Key: "env", Op: OpEquals, Values: []string{"prod"}}}},
+		{"tier != edge", Selector{{Key: "tier", Op: OpNotEquals, Values: []string{"edge"}}}},
+		{"site in (a, b)", Selector{{Key: "site", Op: OpIn, Values: []string{"a", "b"}}}},
+		{"site notin (a,b)", Selector{{Key: "site", Op: OpNotIn, Values: []string{"a", "b"}}}},
+		{"critical", Selector{{Key: "critical", Op: OpExists}}},
+		{"!legacy", Selector{{Key: "legacy", Op: OpDoesNotExist}}},
+		{"example.com/team=ops", Selector{{Key: "example.com/team", Op: OpEquals, Values: []string{"ops"}}}},
+		{"env=prod, site in (a,b),!legacy", Selector{
+			{Key: "env", Op: OpEquals, Values: []string{"prod"}},
+			{Key: "site", Op: OpIn, Values: []string{"a", "b"}},
+			{Key: "legacy", Op: OpDoesNotExist},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseSelector(tt.in)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsed %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSelectorInvalid(t *testing.T) {
+	for _, in := range []string{
+		"site in (a,b",
+		"site in a,b)",
+		"site within (a,b)",
+		"site in (a,b) x",
+		"!",
+		"-env=prod",
+		"bad key=x",
+		"Example.com/team=ops",
+	} {
+		t.Run(in, func(t *testing.T) {
+			if _, err := ParseSelector(in); !errors.Is(err, ErrInvalidSelector) {
+				t.Errorf("err = %v, want %v", err, ErrInvalidSelector)
+			}
+		})
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	labels := Labels{"env": "prod", "site": "plant-1", "critical": ""}
+	tests := []struct {
+		sel  string
+		want bool
+	}{
+		{"", true},
+		{"env=prod", true},
+		{"env=dev", false},
+		{"env!=dev", true},
+		{"tier!=edge", true}, // a missing key is not equal to anything
+		{"site in (plant-1,plant-2)", true},
+		{"site in (plant-2)", false},
+		{"tier in (edge)", false},
+		{"site notin (plant-2)", true},
+		{"site notin (plant-1)", false},
+		{"tier notin (edge)", true},
+		{"critical", true},
+		{"legacy", false},
+		{"!legacy", true},
+		{"!critical", false},
+		{"env=prod,site in (plant-1),!legacy", true},
+		{"env=prod,site in (plant-2)", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sel, func(t *testing.T) {
+			sel, err := ParseSelector(tt.sel)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if got := sel.Matches(labels); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabelsValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels Labels
+		ok     bool
+	}{
+		{"empty", nil, true},
+		{"plain", Labels{"env": "prod", "site": "plant-1"}, true},
+		{"empty value", Labels{"critical": ""}, true},
+		{"prefixed key", Labels{"example.com/team": "ops"}, true},
+		{"dots and underscores", Labels{"app.kubernetes_io": "a.b_c-d"}, true},
+		{"longest name", Labels{strings.Repeat("k", 63): strings.Repeat("v", 63)}, true},
+		{"name too long", Labels{strings.Repeat("k", 64): "x"}, false},
+		{"value too long", Labels{"env": strings.Repeat("v", 64)}, false},
+		{"empty key", Labels{"": "x"}, false},
+		{"space in key", Labels{"my key": "x"}, false},
+		{"leading dash", Labels{"-env": "x"}, false},
+		{"trailing dot in value", Labels{"env": "prod."}, false},
+		{"uppercase prefix", Labels{"Example.com/team": "ops"}, false},
+		{"empty name after prefix", Labels{"example.com/": "x"}, false},
+		{"slash in value", Labels{"env": "a/b"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.labels.Validate()
+			if tt.ok && err != nil {
+				t.Errorf("validate: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidLabels) {
+				t.Errorf("err = %v, want %v", err, ErrInvalidLabels)
+			}
+		})
+	}
+}
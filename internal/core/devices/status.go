@@ -0,0 +1,84 @@
+package devices
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Status is the lifecycle state of a device.
+type Status string
+
+const (
+	// StatusPending is set while a device is being created and its
+	// container has not been started yet.
+	StatusPending Status = "pending"
+	StatusRunning Status = "running"
+	// StatusExited is set when a running device's container dies on its
+	// own. The device is still meant to run; whether service-io restarts
+	// it depends on the restart policy of its type.
+	StatusExited Status = "exited"
+	// StatusCrashLooping is set when a device's container keeps exiting.
+	// service-io keeps restarting it with growing delays.
+	StatusCrashLooping Status = "crashlooping"
+	StatusStopped      Status = "stopped"
+	// StatusFailed is set when service-io could not bring a running
+	// device's container back; it needs to be started again.
+	StatusFailed Status = "failed"
+	// StatusDeleted is terminal; a deleted device cannot be started again.
+	StatusDeleted Status = "deleted"
+)
+
+// ErrInvalidTransition is returned when a lifecycle action is not allowed
+// from the device's current status.
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// transitions lists the statuses reachable from each status. A running
+// device may "transition" to running again, which is a restart.
+var transitions = map[Status][]Status{
+	StatusPending:      {StatusRunning, StatusStopped, StatusDeleted},
+	StatusRunning:      {StatusRunning, StatusExited, StatusCrashLooping, StatusStopped, StatusFailed, StatusDeleted},
+	StatusExited:       {StatusRunning, StatusCrashLooping, StatusStopped, StatusFailed, StatusDeleted},
+	StatusCrashLooping: {StatusRunning, StatusExited, StatusStopped, StatusFailed, StatusDeleted},
+	StatusStopped:      {StatusRunning, StatusDeleted},
+	StatusFailed:       {StatusRunning, StatusStopped, StatusDeleted},
+}
+
+// activeStatuses are the statuses of devices meant to have a running container.
+var activeStatuses = []Status{StatusRunning, StatusExited, StatusCrashLooping}
+
+// active reports whether a device in status s is meant to have a running
+// container.
+func (s Status) active() bool {
+	return s == StatusRunning || s == StatusExited || s == StatusCrashLooping
+}
+
+// CanTransitionTo reports whether a device in status s may move to next.
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// statusesTo returns the statuses a device may move to next from.
+func statusesTo(next Status) []Status {
+	var from []Status
+	for s := range transitions {
+		if s.CanTransitionTo(next) {
+			from = append(from, s)
+		}
+	}
+	return from
+}
+
+// transition moves the device to next, or returns ErrInvalidTransition.
+// The record is not saved.
+func (d *Device) transition(next Status) error {
+	if !d.Status.CanTransitionTo(next) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, d.Status, next)
+	}
+	d.Status = next
+	return nil
+}
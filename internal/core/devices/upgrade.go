@@ -0,0 +1,284 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultUpgradeHealthWait = 10 * time.Second
+	maxUpgradeHealthWait     = 10 * time.Minute
+)
+
+// Upgrade result statuses.
+const (
+	UpgradeUpgraded   = "upgraded"
+	UpgradeUnchanged  = "unchanged"
+	UpgradeRolledBack = "rolled_back"
+	UpgradeFailed     = "failed"
+	UpgradeSkipped    = "skipped"
+)
+
+// UpgradeRequest selects running devices and the image to move them to.
+// The DeviceID, Type and Selector filters are combined; at least one is
+// required.
+type UpgradeRequest struct {
+	DeviceID string
+	Type     string
+	Selector string
+	// Image is the new image tag. When empty, each device's current tag is
+	// pulled again, which picks up a moved tag such as :latest.
+	Image string
+	// MaxUnavailable is the number of devices recreated at once (default 1).
+	MaxUnavailable int
+	// HealthWait is how long a new container must stay up before the
+	// device counts as upgraded (default 10s).
+	HealthWait time.Duration
+}
+
+// UpgradeResult is the outcome for one device.
+type UpgradeResult struct {
+	DeviceID   string `json:"device_id" example:"EDIVRWCLGGPGCW7M"`
+	Status     string `json:"status" example:"upgraded"`
+	FromDigest string `json:"from_digest,omitempty"`
+	ToDigest   string `json:"to_digest,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// UpgradeReport summarises a rollout.
+type UpgradeReport struct {
+	// Aborted is set when a failure stopped the rollout before all
+	// selected devices were processed.
+	Aborted bool            `json:"aborted"`
+	Results []UpgradeResult `json:"results"`
+}
+
+// UpgradeDevices recreates the selected running devices on a new image digest
+// in batches of MaxUnavailable. Each new container must stay up for
+// HealthWait; otherwise the device is rolled back to its previous digest and
+// the remaining batches are skipped. Devices that changed since they were
+// selected, or have an operation in progress, are skipped too. Once
+// started, the rollout is not
+// cancelled with ctx, so a client giving up does not leave devices half
+// upgraded.
+func (m *Manager) UpgradeDevices(ctx context.Context, req UpgradeRequest) (*UpgradeReport, error) {
+	if req.DeviceID == "" && req.Type == "" && req.Selector == "" {
+		return nil, fmt.Errorf("%w: one of device_id, type or selector is required", ErrInvalidUpdate)
+	}
+	if req.MaxUnavailable <= 0 {
+		req.MaxUnavailable = 1
+	}
+	if req.HealthWait <= 0 {
+		req.HealthWait = defaultUpgradeHealthWait
+	}
+	if req.HealthWait > maxUpgradeHealthWait {
+		return nil, fmt.Errorf("%w: health wait must not exceed %s", ErrInvalidUpdate, maxUpgradeHealthWait)
+	}
+	sel, err := ParseSelector(req.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := m.db.WithContext(ctx).Where("status = ?", StatusRunning)
+	if req.DeviceID != "" {
+		tx = tx.Where("id = ?", req.DeviceID)
+	}
+	if req.Type != "" {
+		tx = tx.Where("device_type = ?", req.Type)
+	}
+	var targets []Device
+	if err := sel.apply(tx).Order("created_at, id").Find(&targets).Error; err != nil {
+		return nil, fmt.Errorf("select devices to upgrade: %w", err)
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	report := &UpgradeReport{Results: make([]UpgradeResult, 0, len(targets))}
+	for start := 0; start < len(targets); start += req.MaxUnavailable {
+		end := min(start+req.MaxUnavailable, len(targets))
+		batch := targets[start:end]
+
+		if report.Aborted {
+			for _, dev := range batch {
+				report.Results = append(report.Results, UpgradeResult{
+					DeviceID: dev.ID, Status: UpgradeSkipped, FromDigest: dev.ImageDigest,
+					Error: "rollout aborted",
+				})
+			}
+			continue
+		}
+
+		results := make([]UpgradeResult, len(batch))
+		var wg sync.WaitGroup
+		for i := range batch {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = m.upgradeDevice(ctx, &batch[i], req)
+			}(i)
+		}
+		wg.Wait()
+
+		for _, r := range results {
+			if r.Status == UpgradeRolledBack || r.Status == UpgradeFailed {
+				report.Aborted = true
+			}
+		}
+		report.Results = append(report.Results, results...)
+	}
+
+	m.lg.Info().Int("devices", len(targets)).Bool("aborted", report.Aborted).Msg("upgrade complete")
+	return report, nil
+}
+
+// upgradeDevice moves one device to the requested image and verifies it.
+// A device that changed since it was selected, or that has an operation in
+// progress, is skipped.
+func (m *Manager) upgradeDevice(ctx context.Context, listed *Device, req UpgradeRequest) UpgradeResult {
+	res := UpgradeResult{DeviceID: listed.ID, FromDigest: listed.ImageDigest}
+	lg := m.lg.With().Str("device_id", listed.ID).Logger()
+	fail := func(status string, err error) UpgradeResult {
+		res.Status, res.Error = status, err.Error()
+		lg.Error().Err(err).Str("result", status).Msg("device upgrade failed")
+		return res
+	}
+	dev, ok := m.unchanged(ctx, listed)
+	if !ok {
+		res.Status, res.Error = UpgradeSkipped, "device changed or has an operation in progress"
+		return res
+	}
+
+	target := req.Image
+	if target == "" {
+		target = dev.Image
+	}
+	rt, err := m.runtimeFor(ctx, dev.Host)
+	if err != nil {
+		return fail(UpgradeFailed, err)
+	}
+	profile, err := m.resolveAdapter(ctx, rt, m.deviceAdapterType(ctx, dev), target, true)
+	if err != nil {
+		return fail(UpgradeFailed, err)
+	}
+	res.ToDigest = profile.digest
+	// Runtimes that cannot pin images return the tag itself, which may have
+	// moved; those devices are always recreated to pull it again.
+	pinned := strings.Contains(profile.digest, "@")
+	if pinned && profile.digest == dev.ImageDigest && target == dev.Image {
+		res.Status = UpgradeUnchanged
+		return res
+	}
+	if err := validateConfig(dev.DeviceType, profile.schema, dev.Config); err != nil {
+		return fail(UpgradeFailed, err)
+	}
+
+	prev := *dev
+	dev.Image, dev.ImageDigest = target, profile.digest
+	err = m.runContainer(ctx, dev)
+	if err == nil {
+		err = m.waitHealthy(ctx, dev, req.HealthWait)
+	}
+	if err != nil {
+		lg.Warn().Err(err).Str("digest", prev.ImageDigest).Msg("new container unhealthy, rolling back")
+		// The rollback must happen even if the upgrade was given up on.
+		columns := containerColumns
+		if rbErr := m.runContainer(context.WithoutCancel(ctx), &prev); rbErr != nil {
+			prev.Status, prev.ContainerID = StatusStopped, ""
+			columns = []string{"status", "container_id"}
+			err = fmt.Errorf("%v; rollback failed: %v", err, rbErr)
+		}
+		saveErr := m.withEvents(context.WithoutCancel(ctx), func(tx *gorm.DB) error {
+			if err := m.saveUpgrade(tx, &prev, listed.ContainerID, columns...); err != nil ||
+				prev.Status != StatusStopped {
+				return err
+			}
+			return m.publish(tx, Event{DeviceID: dev.ID, Type: EventStopped, Status: StatusStopped,
+				Actor: ActorFrom(ctx), Reason: "upgrade rollback failed", Error: err.Error()})
+		})
+		if saveErr != nil {
+			lg.Error().Err(saveErr).Msg("failed to save device after rollback")
+		}
+		if errors.Is(saveErr, ErrConflict) && prev.ContainerID != "" {
+			if stopErr := m.stopContainer(context.WithoutCancel(ctx), &prev); stopErr != nil {
+				lg.Error().Err(stopErr).Msg("failed to remove rolled back container")
+			}
+		}
+		if prev.Status == StatusStopped {
+			return fail(UpgradeFailed, err)
+		}
+		return fail(UpgradeRolledBack, err)
+	}
+
+	err = m.withEvents(context.WithoutCancel(ctx), func(tx *gorm.DB) error {
+		if err := m.saveUpgrade(tx, dev, listed.ContainerID, append([]string{"image"}, containerColumns...)...); err != nil {
+			return err
+		}
+		return m.publish(tx, Event{DeviceID: dev.ID, Type: EventUpgraded, Status: dev.Status, Actor: ActorFrom(ctx),
+			Reason: fmt.Sprintf("upgraded to %s", dev.ImageDigest)})
+	})
+	if errors.Is(err, ErrConflict) {
+		// Stopped or recreated meanwhile; the new container is not the
+		// device's any more.
+		if stopErr := m.stopContainer(context.WithoutCancel(ctx), dev); stopErr != nil {
+			lg.Error().Err(stopErr).Msg("failed to remove upgraded container")
+		}
+	}
+	if err != nil {
+		return fail(UpgradeFailed, fmt.Errorf("update device record in db: %w", err))
+	}
+	res.Status = UpgradeUpgraded
+	lg.Info().Str("digest", dev.ImageDigest).Msg("device upgraded")
+	return res
+}
+
+// saveUpgrade saves columns of dev within tx unless the device stopped
+// running or its container was replaced since the upgrade read it, with
+// containerID, in which case it fails with ErrConflict.
+func (m *Manager) saveUpgrade(tx *gorm.DB, dev *Device, containerID string, columns ...string) error {
+	res := tx.Model(dev).Where("status = ? AND container_id = ?", StatusRunning, containerID).
+		Select(columns).Updates(dev)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrConflict, dev.ID)
+	}
+	return nil
+}
+
+// waitHealthy waits for d and then checks that the device's container is
+// still running and has not been restarted in the meantime.
+func (m *Manager) waitHealthy(ctx context.Context, dev *Device, d time.Duration) error {
+	before, err := m.inspectContainer(ctx, dev)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return fmt.Errorf("container %s disappeared", dev.ContainerName)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+	}
+
+	after, err := m.inspectContainer(ctx, dev)
+	if err != nil {
+		return err
+	}
+	switch {
+	case after == nil:
+		return fmt.Errorf("container %s disappeared", dev.ContainerName)
+	case !after.Running:
+		return fmt.Errorf("container exited with code %d", after.ExitCode)
+	case !after.StartedAt.Equal(before.StartedAt) || after.RestartCount != before.RestartCount:
+		return fmt.Errorf("container restarted during health wait")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package devices
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"service-io/internal/core/runtime"
+)
+
+func TestUpgradeDevicesRollsBack(t *testing.T) {
+	env := newTestManager(t, Options{})
+	dev := env.addDevice(t, "plc-1")
+
+	const broken = "registry.example.com/adapter-mqtt:2"
+	env.rt.CrashOnStart(broken, 1)
+	// The client gives up as soon as the new container starts, which must
+	// not stop the rollback.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	evs, err := env.rt.Events(ctx)
+	if err != nil {
+		t.Fatalf("events: %v", err)
+	}
+	go func() {
+		for ev := range evs {
+			if ev.Action == runtime.EventStart {
+				cancel()
+			}
+		}
+	}()
+	rep, err := env.m.UpgradeDevices(ctx, UpgradeRequest{DeviceID: dev.ID, Image: broken, HealthWait: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	if !rep.Aborted || len(rep.Results) != 1 || rep.Results[0].Status != UpgradeRolledBack {
+		t.Fatalf("report = %+v, want the device rolled back", rep)
+	}
+
+	got := env.device(t, dev.ID)
+	if got.Status != StatusRunning || got.Image != testImage || got.ImageDigest != dev.ImageDigest {
+		t.Errorf("device %s on %s (%s), want running on %s again", got.Status, got.Image, got.ImageDigest, testImage)
+	}
+	if inst, ok := env.rt.Instance(got.ContainerID); !ok || !inst.State.Running || inst.Spec.Image != dev.ImageDigest {
+		t.Errorf("instance %s = %+v, want running %s", got.ContainerID, inst, dev.ImageDigest)
+	}
+}
+
+func TestUpgradeDevicesRepullsUnpinnedTags(t *testing.T) {
+	env := newTestManager(t, Options{})
+	// Like the kubernetes runtime, which leaves pulling to the kubelet.
+	env.rt.SetImage(testImage, runtime.ImageInfo{Digest: testImage})
+	dev := env.addDevice(t, "plc-1")
+
+	rep, err := env.m.UpgradeDevices(context.Background(), UpgradeRequest{DeviceID: dev.ID, HealthWait: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	if len(rep.Results) != 1 || rep.Results[0].Status != UpgradeUpgraded {
+		t.Fatalf("report = %+v, want the device recreated", rep)
+	}
+	if got := env.device(t, dev.ID); got.ContainerID == dev.ContainerID {
+		t.Errorf("device kept container %s, want a new one", got.ContainerID)
+	}
+
+	// Pinned images are left alone when their digest did not change.
+	env.rt.SetImage(testImage, runtime.ImageInfo{})
+	dev = env.addDevice(t, "plc-2")
+	rep, err = env.m.UpgradeDevices(context.Background(), UpgradeRequest{DeviceID: dev.ID, HealthWait: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	if len(rep.Results) != 1 || rep.Results[0].Status != UpgradeUnchanged {
+		t.Errorf("report = %+v, want the device unchanged", rep)
+	}
+}
+
+func TestUpgradeDevicesSkipsBusyDevices(t *testing.T) {
+	env := newTestManager(t, Options{})
+	dev := env.addDevice(t, "plc-1")
+	if _, err := env.m.recordOperation(context.Background(), OperationStop, dev.ID); err != nil {
+		t.Fatalf("record stop: %v", err)
+	}
+
+	rep, err := env.m.UpgradeDevices(context.Background(), UpgradeRequest{DeviceID: dev.ID,
+		Image: "registry.example.com/adapter-mqtt:2", HealthWait: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	if len(rep.Results) != 1 || rep.Results[0].Status != UpgradeSkipped {
+		t.Fatalf("report = %+v, want the device skipped", rep)
+	}
+	if got := env.device(t, dev.ID); got.Image != testImage || got.ContainerID != dev.ContainerID {
+		t.Errorf("device on %s (%s), want %s untouched", got.Image, got.ContainerID, testImage)
+	}
+}
@@ -0,0 +1,203 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"service-io/internal/core/runtime"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// watchHostsEvery is how often WatchEvents looks for newly registered hosts.
+	watchHostsEvery = 30 * time.Second
+	// maxWatchBackoff caps the delay between attempts to resubscribe to a
+	// runtime's events.
+	maxWatchBackoff = 30 * time.Second
+)
+
+// WatchEvents follows the lifecycle events of the adapter instances on the
+// default runtime and every registered host until ctx is done. Each event
+// that concerns a device's current container updates the device record and
+// is published to subscribers. Once ctx is done it waits for the watchers to
+// stop and drops all pending supervised restarts, so that another replica can
+// take over.
+func (m *Manager) WatchEvents(ctx context.Context) {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		watching = make(map[string]bool)
+	)
+	defer m.forgetAllCrashes()
+	defer wg.Wait()
+	watch := func(host string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if watching[host] {
+			return
+		}
+		watching[host] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.watchHost(ctx, host)
+			mu.Lock()
+			delete(watching, host)
+			mu.Unlock()
+		}()
+	}
+
+	t := time.NewTicker(watchHostsEvery)
+	defer t.Stop()
+	for {
+		watch("")
+		hosts, err := m.ListHosts(ctx)
+		if err != nil && ctx.Err() == nil {
+			m.lg.Warn().Err(err).Msg("failed to list hosts to watch")
+		}
+		for _, h := range hosts {
+			watch(h.Name)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// watchHost consumes the events of one host, resubscribing with backoff when
+// the stream ends. It returns when ctx is done or the host is removed.
+func (m *Manager) watchHost(ctx context.Context, host string) {
+	lg := m.lg.With().Str("host", host).Logger()
+	backoff := time.Second
+	for ctx.Err() == nil {
+		evs, err := m.subscribeHost(ctx, host)
+		if errors.Is(err, ErrHostNotFound) {
+			return
+		}
+		if err != nil {
+			lg.Warn().Err(err).Dur("retry_in", backoff).Msg("failed to subscribe to runtime events")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxWatchBackoff)
+			continue
+		}
+		backoff = time.Second
+		lg.Debug().Msg("watching runtime events")
+
+		// OOM kills are reported just before the die event of the same instance.
+		oomKilled := make(map[string]bool)
+		for ev := range evs {
+			if ev.Action == runtime.EventOOM {
+				oomKilled[ev.ID] = true
+			}
+			oom := oomKilled[ev.ID]
+			if ev.Action == runtime.EventDie {
+				delete(oomKilled, ev.ID)
+			}
+			if err := m.applyRuntimeEvent(ctx, host, ev, oom); err != nil {
+				lg.Error().Err(err).Str("device_id", ev.DeviceID).Str("action", ev.Action).Msg("failed to apply runtime event")
+			}
+		}
+	}
+}
+
+func (m *Manager) subscribeHost(ctx context.Context, host string) (<-chan runtime.Event, error) {
+	rt, err := m.runtimeFor(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return rt.Events(ctx)
+}
+
+// A crashlooping device stays crashlooping across restarts and exits until it
+// recovers; see watchRecovery.
+var (
+	started = gorm.Expr("CASE WHEN status = ? THEN ? ELSE status END", StatusExited, StatusRunning)
+	died    = gorm.Expr("CASE WHEN status = ? THEN status ELSE ? END", StatusCrashLooping, StatusExited)
+)
+
+// applyRuntimeEvent records a runtime event on the device whose current
+// container it concerns. Events of replaced containers, and of devices that
+// are not meant to run, are ignored; they come from service-io's own stops
+// and recreations.
+func (m *Manager) applyRuntimeEvent(ctx context.Context, host string, ev runtime.Event, oomKilled bool) error {
+	if ev.DeviceID == "" {
+		return nil
+	}
+	out := Event{DeviceID: ev.DeviceID, Time: ev.Time}
+	var upd map[string]any
+	switch ev.Action {
+	case runtime.EventStart:
+		out.Type = EventStarted
+		upd = map[string]any{"status": started}
+	case runtime.EventRestart:
+		out.Type = EventRestarted
+		upd = map[string]any{"status": started, "restart_count": gorm.Expr("restart_count + 1")}
+	case runtime.EventDie:
+		if m.exitExpected(ev.ID) {
+			return nil
+		}
+		out.Type, out.ExitCode = EventDied, ev.ExitCode
+		out.Error = fmt.Sprintf("exited with code %d", ev.ExitCode)
+		if oomKilled {
+			out.Error = fmt.Sprintf("out of memory (exit code %d)", ev.ExitCode)
+		}
+		upd = map[string]any{"status": died, "exit_code": ev.ExitCode, "last_error": out.Error}
+	case runtime.EventOOM:
+		out.Type, out.Error = EventOOMKilled, "out of memory"
+		upd = map[string]any{"last_error": out.Error}
+	case runtime.EventHealth:
+		out.Type, out.Health = EventHealth, ev.Health
+		upd = map[string]any{"health": ev.Health}
+		if ev.Health == "unhealthy" {
+			out.Error = "health check failing"
+			upd["last_error"] = out.Error
+		}
+	default:
+		return nil
+	}
+
+	var dev *Device
+	err := m.withEvents(ctx, func(tx *gorm.DB) error {
+		res := tx.Model(&Device{}).
+			Where("id = ? AND host = ? AND container_id = ? AND status IN ?", ev.DeviceID, host, ev.ID, activeStatuses).
+			Updates(upd)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		dev = &Device{}
+		if err := tx.First(dev, "id = ?", ev.DeviceID).Error; err != nil {
+			return err
+		}
+		out.Status = dev.Status
+		if out.Type == EventDied {
+			status, err := m.afterExit(tx, dev, ev.ExitCode)
+			if err != nil {
+				return err
+			}
+			out.Status = status
+		}
+		return m.publish(tx, out)
+	})
+	if err != nil || dev == nil {
+		return err
+	}
+	switch out.Type {
+	case EventDied:
+		go m.captureLogTail(*dev)
+	case EventStarted, EventRestarted:
+		m.watchRecovery(dev.ID)
+	}
+	m.lg.Info().Str("device_id", dev.ID).Str("event", out.Type).Str("status", string(out.Status)).
+		Str("error", out.Error).Msg("adapter container event")
+	return nil
+}
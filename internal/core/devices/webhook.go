@@ -0,0 +1,508 @@
+package devices
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"service-io/pkg/rand"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrWebhookNotFound is returned when a webhook ID does not match any
+	// subscription.
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrInvalidWebhook is returned when a webhook subscription is unusable.
+	ErrInvalidWebhook = errors.New("invalid webhook")
+	// ErrDeliveryNotFound is returned when a delivery ID does not match any
+	// delivery of the webhook.
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+// Webhook delivery statuses. A delivery that failed WebhookMaxAttempts
+// times is dead; dead deliveries are kept until redelivered.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// Headers sent with every webhook delivery. The signature is
+// "sha256=" followed by the hex HMAC-SHA256, keyed with the webhook's
+// secret, of the timestamp, a dot and the body; see SignWebhook.
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const (
+	// deliverWebhooksEvery is how often due deliveries are looked for.
+	deliverWebhooksEvery = time.Second
+	// webhookBatch is how many due deliveries are attempted per pass, and
+	// webhookParallelism how many of them at once.
+	webhookBatch       = 100
+	webhookParallelism = 8
+	// maxWebhookErrorBody is how much of a failed response is kept.
+	maxWebhookErrorBody = 512
+)
+
+// Webhook subscribes a URL to device lifecycle events.
+type Webhook struct {
+	ID  string `gorm:"primaryKey" json:"id" example:"W3BHK7Q2M9XW4TBN"`
+	URL string `json:"url" example:"https://example.com/hooks/devices"`
+	// Events are the event types delivered; empty means all of them.
+	Events EventFilter `gorm:"type:jsonb" json:"events" example:"died,deleted"`
+	// Selector limits deliveries to devices whose labels match it.
+	Selector string `json:"selector,omitempty" example:"site=plant-1"`
+	// Secret keys the delivery signatures. It is only returned when the
+	// webhook is created.
+	Secret    string    `json:"secret,omitempty" example:"s3cr3t"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookUpdate lists the mutable fields of a webhook. Nil fields are left
+// unchanged.
+type WebhookUpdate struct {
+	URL      *string
+	Events   *EventFilter
+	Selector *string
+	Secret   *string
+}
+
+// EventFilter is a list of event types stored as a JSONB array.
+type EventFilter []string
+
+// Value implements driver.Valuer for storing the filter as JSONB.
+func (f EventFilter) Value() (driver.Value, error) {
+	if f == nil {
+		return "[]", nil
+	}
+	raw, err := json.Marshal([]string(f))
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+// Scan implements sql.Scanner for reading the JSONB column back.
+func (f *EventFilter) Scan(src any) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("event filter: unsupported scan type %T", src)
+	}
+	return json.Unmarshal(raw, (*[]string)(f))
+}
+
+// WebhookDelivery is one event to be delivered to one webhook.
+type WebhookDelivery struct {
+	ID        string `gorm:"primaryKey" json:"id" example:"D8CPLK7Q2M9XW4TB"`
+	WebhookID string `gorm:"index" json:"webhook_id" example:"W3BHK7Q2M9XW4TBN"`
+	EventID   string `json:"event_id" example:"VQ3M7XKD2HNB5RJT"`
+	EventType string `json:"event_type" example:"died"`
+	DeviceID  string `json:"device_id" example:"EDIVRWCLGGPGCW7M"`
+	// Payload is the EventEnvelope posted to the webhook.
+	Payload       RawJSON    `gorm:"type:jsonb" json:"payload" swaggertype:"object"`
+	Status        string     `gorm:"index" json:"status" example:"pending"`
+	Attempts      int        `json:"attempts" example:"3"`
+	NextAttemptAt time.Time  `gorm:"index" json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty" example:"status 503: upstream unavailable"`
+	LastStatus    int        `json:"last_status,omitempty" example:"503"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+// SignWebhook returns the signature of a delivery body sent at timestamp
+// (Unix seconds), as sent in WebhookSignatureHeader.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// wants reports whether the webhook subscribes to ev.
+func (h *Webhook) wants(ev Event) bool {
+	if len(h.Events) > 0 && !slices.Contains(h.Events, ev.Type) {
+		return false
+	}
+	if h.Selector == "" {
+		return true
+	}
+	sel, err := ParseSelector(h.Selector)
+	if err != nil || ev.Device == nil {
+		return false
+	}
+	return sel.Matches(ev.Device.Labels)
+}
+
+// validate checks that the webhook is usable.
+func (h *Webhook) validate() error {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	for _, t := range h.Events {
+		if !slices.Contains(eventTypes, t) {
+			return fmt.Errorf("%w: unknown event type %q, want one of %s",
+				ErrInvalidWebhook, t, strings.Join(eventTypes, ", "))
+		}
+	}
+	if _, err := ParseSelector(h.Selector); err != nil {
+		return fmt.Errorf("%w: selector: %v", ErrInvalidWebhook, err)
+	}
+	if h.Secret == "" {
+		return fmt.Errorf("%w: secret must not be empty", ErrInvalidWebhook)
+	}
+	return nil
+}
+
+// CreateWebhook subscribes a URL to device events. Without a secret, one is
+// generated; either way it is returned only here.
+func (m *Manager) CreateWebhook(ctx context.Context, h Webhook) (*Webhook, error) {
+	h.ID = rand.ID16()
+	if h.Secret == "" {
+		h.Secret = rand.Password(32)
+	}
+	if h.Events == nil {
+		h.Events = EventFilter{}
+	}
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+	if err := m.db.WithContext(ctx).Create(&h).Error; err != nil {
+		return nil, fmt.Errorf("create webhook in db: %w", err)
+	}
+	m.lg.Info().Str("webhook_id", h.ID).Str("url", h.URL).Msg("webhook created")
+	return &h, nil
+}
+
+// ListWebhooks returns all webhooks, oldest first, without their secrets.
+func (m *Manager) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	hooks := []Webhook{}
+	if err := m.db.WithContext(ctx).Order("created_at").Find(&hooks).Error; err != nil {
+		return nil, err
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	return hooks, nil
+}
+
+// GetWebhook returns a webhook without its secret.
+func (m *Manager) GetWebhook(ctx context.Context, id string) (*Webhook, error) {
+	h, err := m.findWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	h.Secret = ""
+	return h, nil
+}
+
+// UpdateWebhook changes a webhook. Pending deliveries go to the new URL and
+// are signed with the new secret.
+func (m *Manager) UpdateWebhook(ctx context.Context, id string, upd WebhookUpdate) (*Webhook, error) {
+	h, err := m.findWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upd.URL != nil {
+		h.URL = *upd.URL
+	}
+	if upd.Events != nil {
+		h.Events = *upd.Events
+	}
+	if upd.Selector != nil {
+		h.Selector = *upd.Selector
+	}
+	if upd.Secret != nil {
+		h.Secret = *upd.Secret
+	}
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+	if err := m.db.WithContext(ctx).Save(h).Error; err != nil {
+		return nil, fmt.Errorf("update webhook in db: %w", err)
+	}
+	h.Secret = ""
+	return h, nil
+}
+
+// DeleteWebhook removes a webhook and its deliveries.
+func (m *Manager) DeleteWebhook(ctx context.Context, id string) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&Webhook{}, "id = ?", id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("%w: %s", ErrWebhookNotFound, id)
+		}
+		return tx.Delete(&WebhookDelivery{}, "webhook_id = ?", id).Error
+	})
+}
+
+// ListWebhookDeliveries returns the latest deliveries of a webhook, newest
+// first. A non-empty status, e.g. DeliveryDead for the dead-letter list,
+// only returns deliveries in it.
+func (m *Manager) ListWebhookDeliveries(ctx context.Context, hookID, status string) ([]WebhookDelivery, error) {
+	if _, err := m.findWebhook(ctx, hookID); err != nil {
+		return nil, err
+	}
+	tx := m.db.WithContext(ctx).Where("webhook_id = ?", hookID)
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	deliveries := []WebhookDelivery{}
+	err := tx.Order("created_at DESC").Limit(100).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// RedeliverWebhook queues a delivery to be attempted again right away, with
+// a fresh retry budget.
+func (m *Manager) RedeliverWebhook(ctx context.Context, hookID, deliveryID string) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	err := m.db.WithContext(ctx).First(&d, "id = ? AND webhook_id = ?", deliveryID, hookID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrDeliveryNotFound, deliveryID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.Status, d.Attempts, d.NextAttemptAt, d.DeliveredAt = DeliveryPending, 0, time.Now().UTC(), nil
+	err = m.db.WithContext(ctx).Model(&d).
+		Select("status", "attempts", "next_attempt_at", "delivered_at", "updated_at").Updates(&d).Error
+	if err != nil {
+		return nil, fmt.Errorf("requeue webhook delivery: %w", err)
+	}
+	m.lg.Info().Str("webhook_id", hookID).Str("delivery_id", d.ID).Msg("webhook delivery requeued")
+	return &d, nil
+}
+
+func (m *Manager) findWebhook(ctx context.Context, id string) (*Webhook, error) {
+	var h Webhook
+	if err := m.db.WithContext(ctx).First(&h, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrWebhookNotFound, id)
+		}
+		return nil, err
+	}
+	return &h, nil
+}
+
+// QueueWebhookDeliveries stores a delivery for every webhook subscribed to
+// each recorded event not queued yet, oldest first, and returns how many
+// events were queued. An event's deliveries are stored in the transaction
+// marking it queued, so none are lost or stored twice.
+func (m *Manager) QueueWebhookDeliveries(ctx context.Context) (int, error) {
+	var pending []OutboxEvent
+	err := m.db.WithContext(ctx).Where("queued_at IS NULL").Order("seq").Limit(outboxBatch).Find(&pending).Error
+	if err != nil || len(pending) == 0 {
+		return 0, err
+	}
+	var hooks []Webhook
+	if err := m.db.WithContext(ctx).Find(&hooks).Error; err != nil {
+		return 0, err
+	}
+	for i, e := range pending {
+		ev, err := e.event()
+		if err != nil {
+			return i, err
+		}
+		err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&OutboxEvent{}).Where("seq = ? AND queued_at IS NULL", e.Seq).
+				Update("queued_at", time.Now().UTC())
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			return storeDeliveries(tx, hooks, ev, e.Payload)
+		})
+		if err != nil {
+			return i, fmt.Errorf("queue deliveries of event %s: %w", e.EventID, err)
+		}
+	}
+	return len(pending), nil
+}
+
+// storeDeliveries stores a delivery of ev, encoded as payload, for every
+// webhook of hooks subscribed to it.
+func storeDeliveries(tx *gorm.DB, hooks []Webhook, ev Event, payload []byte) error {
+	var deliveries []WebhookDelivery
+	now := time.Now().UTC()
+	for i := range hooks {
+		if !hooks[i].wants(ev) {
+			continue
+		}
+		deliveries = append(deliveries, WebhookDelivery{
+			ID:            rand.ID16(),
+			WebhookID:     hooks[i].ID,
+			EventID:       ev.ID,
+			EventType:     ev.Type,
+			DeviceID:      ev.DeviceID,
+			Payload:       payload,
+			Status:        DeliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return tx.Create(&deliveries).Error
+}
+
+// RunWebhookDeliveries attempts due webhook deliveries until ctx is done.
+// Only the leader should run it.
+func (m *Manager) RunWebhookDeliveries(ctx context.Context) {
+	t := time.NewTicker(deliverWebhooksEvery)
+	defer t.Stop()
+	for {
+		if _, err := m.DeliverWebhooks(ctx); err != nil && ctx.Err() == nil {
+			m.lg.Error().Err(err).Msg("failed to deliver webhooks")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// DeliverWebhooks attempts the deliveries that are due once and returns how
+// many were delivered. Failed deliveries are retried with exponential
+// backoff and end up dead after WebhookMaxAttempts attempts.
+func (m *Manager) DeliverWebhooks(ctx context.Context) (int, error) {
+	var due []WebhookDelivery
+	err := m.db.WithContext(ctx).Where("status = ? AND next_attempt_at <= ?", DeliveryPending, time.Now().UTC()).
+		Order("next_attempt_at").Limit(webhookBatch).Find(&due).Error
+	if err != nil || len(due) == 0 {
+		return 0, err
+	}
+	hooks := make(map[string]*Webhook)
+	for _, d := range due {
+		if _, ok := hooks[d.WebhookID]; ok {
+			continue
+		}
+		h, err := m.findWebhook(ctx, d.WebhookID)
+		if err != nil && !errors.Is(err, ErrWebhookNotFound) {
+			return 0, err
+		}
+		hooks[d.WebhookID] = h
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		delivered int
+	)
+	sem := make(chan struct{}, webhookParallelism)
+	for i := range due {
+		d, h := &due[i], hooks[due[i].WebhookID]
+		if h == nil {
+			// Deleted meanwhile; its deliveries went with it.
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			if m.attemptDelivery(ctx, h, d) {
+				mu.Lock()
+				delivered++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return delivered, nil
+}
+
+// attemptDelivery posts a delivery to its webhook once, records the outcome
+// and reports whether it was delivered.
+func (m *Manager) attemptDelivery(ctx context.Context, h *Webhook, d *WebhookDelivery) bool {
+	status, err := m.postWebhook(ctx, h, d)
+	if ctx.Err() != nil {
+		// Shutting down; the attempt does not count.
+		return false
+	}
+	now := time.Now().UTC()
+	d.Attempts++
+	d.LastStatus = status
+	lg := m.lg.With().Str("webhook_id", h.ID).Str("delivery_id", d.ID).Int("attempts", d.Attempts).Logger()
+	switch {
+	case err == nil:
+		d.Status, d.DeliveredAt, d.LastError = DeliveryDelivered, &now, ""
+	case d.Attempts >= m.opts.WebhookMaxAttempts:
+		d.Status, d.LastError = DeliveryDead, err.Error()
+		lg.Warn().Err(err).Msg("webhook delivery failed for good, moved to dead letters")
+	default:
+		d.LastError = err.Error()
+		delay := m.opts.WebhookMaxBackoff
+		if d.Attempts <= 30 {
+			delay = min(m.opts.WebhookBackoff<<(d.Attempts-1), m.opts.WebhookMaxBackoff)
+		}
+		d.NextAttemptAt = now.Add(delay)
+		lg.Info().Err(err).Dur("retry_in", delay).Msg("webhook delivery failed, retry scheduled")
+	}
+	err = m.db.Model(d).
+		Select("status", "attempts", "next_attempt_at", "last_error", "last_status", "delivered_at", "updated_at").
+		Updates(d).Error
+	if err != nil {
+		lg.Error().Err(err).Msg("failed to save webhook delivery")
+	}
+	return d.Status == DeliveryDelivered
+}
+
+// postWebhook sends a signed delivery and returns the response status. Any
+// status but 2xx is an error.
+func (m *Manager) postWebhook(ctx context.Context, h *Webhook, d *WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "service-io-webhooks")
+	req.Header.Set(WebhookEventHeader, d.EventType)
+	req.Header.Set(WebhookDeliveryHeader, d.ID)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(h.Secret, ts, d.Payload))
+
+	resp, err := m.opts.WebhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookErrorBody))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp.StatusCode, nil
+}
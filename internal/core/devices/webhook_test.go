@@ -0,0 +1,178 @@
+package devices
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookReceiver is a webhook endpoint that checks signatures and answers
+// with status.
+type webhookReceiver struct {
+	t      *testing.T
+	secret string
+	status atomic.Int32
+
+	mu     sync.Mutex
+	events []EventEnvelope
+}
+
+func newWebhookReceiver(t *testing.T, secret string) (*webhookReceiver, *httptest.Server) {
+	rcv := &webhookReceiver{t: t, secret: secret}
+	rcv.status.Store(http.StatusNoContent)
+	srv := httptest.NewServer(rcv)
+	t.Cleanup(srv.Close)
+	return rcv, srv
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		rcv.t.Errorf("read delivery: %v", err)
+		return
+	}
+	ts := r.Header.Get(WebhookTimestampHeader)
+	mac := hmac.New(sha256.New, []byte(rcv.secret))
+	mac.Write([]byte(ts + "." + string(body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := r.Header.Get(WebhookSignatureHeader); !hmac.Equal([]byte(got), []byte(want)) {
+		rcv.t.Errorf("signature = %q, want %q", got, want)
+	}
+	if sec, err := strconv.ParseInt(ts, 10, 64); err != nil || time.Since(time.Unix(sec, 0)) > time.Minute {
+		rcv.t.Errorf("timestamp = %q, want the current time", ts)
+	}
+	var env EventEnvelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		rcv.t.Errorf("decode delivery: %v", err)
+	}
+	if got := r.Header.Get(WebhookEventHeader); got != env.Type {
+		rcv.t.Errorf("event header = %q, want %q", got, env.Type)
+	}
+	rcv.mu.Lock()
+	rcv.events = append(rcv.events, env)
+	rcv.mu.Unlock()
+	w.WriteHeader(int(rcv.status.Load()))
+}
+
+func (rcv *webhookReceiver) received() []EventEnvelope {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return append([]EventEnvelope(nil), rcv.events...)
+}
+
+// queueAndDeliver queues the deliveries of the recorded events and attempts
+// the due ones, as the leader would.
+func (env *testEnv) queueAndDeliver(t *testing.T) int {
+	t.Helper()
+	if _, err := env.m.QueueWebhookDeliveries(context.Background()); err != nil {
+		t.Fatalf("queue webhook deliveries: %v", err)
+	}
+	n, err := env.m.DeliverWebhooks(context.Background())
+	if err != nil {
+		t.Fatalf("deliver webhooks: %v", err)
+	}
+	return n
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	env := newTestManager(t, Options{})
+	rcv, srv := newWebhookReceiver(t, "s3cr3t")
+	hook, err := env.m.CreateWebhook(context.Background(), Webhook{URL: srv.URL, Secret: "s3cr3t"})
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	// Only deleted events of devices on plant-2.
+	_, err = env.m.CreateWebhook(context.Background(), Webhook{URL: srv.URL, Secret: "other",
+		Events: EventFilter{EventDeleted}, Selector: "site=plant-2"})
+	if err != nil {
+		t.Fatalf("create filtered webhook: %v", err)
+	}
+
+	// Events recorded before anyone queued them are not lost.
+	dev := env.addDevice(t, "plc-1")
+	if n := env.queueAndDeliver(t); n != 1 {
+		t.Fatalf("delivered %d, want 1", n)
+	}
+	got := rcv.received()
+	if len(got) != 1 || got[0].DeviceID != dev.ID || got[0].Type != EventCreated || got[0].Version != EventEnvelopeVersion {
+		t.Fatalf("received %+v, want the created event of %s", got, dev.ID)
+	}
+	if got[0].Device == nil || got[0].Device.MQTTPassword != "" {
+		t.Errorf("device snapshot = %+v, want one without the MQTT password", got[0].Device)
+	}
+
+	deliveries, err := env.m.ListWebhookDeliveries(context.Background(), hook.ID, DeliveryDelivered)
+	if err != nil {
+		t.Fatalf("list deliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Attempts != 1 || deliveries[0].LastStatus != http.StatusNoContent {
+		t.Errorf("deliveries = %+v, want one delivered at the first attempt", deliveries)
+	}
+	// Queueing again stores nothing twice.
+	if n := env.queueAndDeliver(t); n != 0 {
+		t.Errorf("delivered %d more, want none", n)
+	}
+}
+
+func TestWebhookRetriesUntilDead(t *testing.T) {
+	env := newTestManager(t, Options{
+		WebhookMaxAttempts: 3,
+		WebhookBackoff:     time.Millisecond,
+		WebhookMaxBackoff:  2 * time.Millisecond,
+	})
+	rcv, srv := newWebhookReceiver(t, "s3cr3t")
+	rcv.status.Store(http.StatusServiceUnavailable)
+	hook, err := env.m.CreateWebhook(context.Background(), Webhook{URL: srv.URL, Secret: "s3cr3t"})
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	env.addDevice(t, "plc-1")
+
+	var d WebhookDelivery
+	waitFor(t, "the delivery to die", func() bool {
+		env.queueAndDeliver(t)
+		if err := env.m.db.First(&d, "webhook_id = ?", hook.ID).Error; err != nil {
+			t.Fatalf("load delivery: %v", err)
+		}
+		return d.Status == DeliveryDead
+	})
+	if d.Attempts != 3 || d.LastStatus != http.StatusServiceUnavailable || d.LastError == "" {
+		t.Errorf("dead delivery = %+v, want 3 attempts failed with 503", d)
+	}
+	if n := len(rcv.received()); n != 3 {
+		t.Errorf("received %d attempts, want 3", n)
+	}
+	dead, err := env.m.ListWebhookDeliveries(context.Background(), hook.ID, DeliveryDead)
+	if err != nil || len(dead) != 1 {
+		t.Fatalf("dead letters = %v, %v, want the delivery", dead, err)
+	}
+
+	// A redelivery gets a fresh retry budget.
+	rcv.status.Store(http.StatusOK)
+	again, err := env.m.RedeliverWebhook(context.Background(), hook.ID, d.ID)
+	if err != nil {
+		t.Fatalf("redeliver: %v", err)
+	}
+	if again.Status != DeliveryPending || again.Attempts != 0 {
+		t.Errorf("redelivery = %+v, want pending without attempts", again)
+	}
+	if n := env.queueAndDeliver(t); n != 1 {
+		t.Fatalf("delivered %d, want the redelivery", n)
+	}
+	if err := env.m.db.First(&d, "id = ?", d.ID).Error; err != nil {
+		t.Fatalf("load delivery: %v", err)
+	}
+	if d.Status != DeliveryDelivered || d.Attempts != 1 || d.DeliveredAt == nil {
+		t.Errorf("delivery = %+v, want delivered at the first new attempt", d)
+	}
+}
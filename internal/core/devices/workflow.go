@@ -0,0 +1,318 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"service-io/pkg/rand"
+
+	"gorm.io/gorm"
+)
+
+// operationDevice loads the device an operation works on.
+func (m *Manager) operationDevice(op *Operation) (*Device, error) {
+	return m.findDevice(op.DeviceID)
+}
+
+// createWorkflow creates a device. Its record is inserted together with the
+// operation, and removed again if the device cannot be brought up.
+func (m *Manager) createWorkflow() []workflowStep {
+	return []workflowStep{
+		{
+			name: "create_record",
+			do:   func(context.Context, *Operation) error { return nil },
+			undo: func(ctx context.Context, op *Operation) error {
+				return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+					if err := tx.Delete(&ConfigRevision{}, "device_id = ?", op.DeviceID).Error; err != nil {
+						return err
+					}
+					return tx.Delete(&Device{}, "id = ?", op.DeviceID).Error
+				})
+			},
+		},
+		{
+			// Pulls the image, so incompatible images and configs are
+			// rejected before anything else is created.
+			name: "pull_image",
+			do: func(ctx context.Context, op *Operation) error {
+				dev, err := m.operationDevice(op)
+				if err != nil {
+					return err
+				}
+				rt, err := m.runtimeFor(ctx, dev.Host)
+				if err != nil {
+					return err
+				}
+				profile, err := m.resolveAdapter(ctx, rt, m.deviceAdapterType(ctx, dev), dev.Image, false)
+				if err != nil {
+					return err
+				}
+				if err := validateConfig(dev.DeviceType, profile.schema, dev.Config); err != nil {
+					return err
+				}
+				dev.ImageDigest = profile.digest
+				// If it's an MQTT adapter, generate and set credentials.
+				if dev.MQTTUser == "" && (dev.DeviceType == "mqtt" || profile.protocol == "mqtt") {
+					dev.MQTTUser = dev.ID // Use the device ID as the username
+					dev.MQTTPassword = rand.Password(16)
+				}
+				return m.db.Save(dev).Error
+			},
+		},
+		{
+			name: "ensure_stream",
+			do: func(ctx context.Context, op *Operation) error {
+				dev, err := m.operationDevice(op)
+				if err != nil {
+					return err
+				}
+				if err := m.nc.EnsureStream(dev.NatsSubject, dev.streamName()); err != nil {
+					return fmt.Errorf("ensure nats stream: %w", err)
+				}
+				return nil
+			},
+			undo: func(ctx context.Context, op *Operation) error {
+				return m.nc.DeleteStream((&Device{ID: op.DeviceID}).streamName())
+			},
+		},
+		{
+			name: "start_adapter",
+			do:   m.startAdapter,
+			undo: m.removeAdapter,
+		},
+		{
+			name: "activate",
+			do: func(ctx context.Context, op *Operation) error {
+				return m.db.WithContext(ctx).Model(&Device{}).
+					Where("id = ? AND status = ?", op.DeviceID, StatusPending).
+					Update("status", StatusRunning).Error
+			},
+		},
+	}
+}
+
+// startWorkflow starts the adapter of a stopped device, reusing its stored
+// credentials and stream.
+func (m *Manager) startWorkflow() []workflowStep {
+	return []workflowStep{
+		{
+			// The stream normally still exists; EnsureStream is idempotent.
+			name: "ensure_stream",
+			do: func(ctx context.Context, op *Operation) error {
+				dev, err := m.operationDevice(op)
+				if err != nil {
+					return err
+				}
+				if err := m.nc.EnsureStream(dev.NatsSubject, dev.streamName()); err != nil {
+					return fmt.Errorf("ensure nats stream: %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name: "start_adapter",
+			do:   m.startAdapter,
+			undo: m.removeAdapter,
+		},
+		{
+			name: "mark_running",
+			do:   m.markRunning,
+		},
+	}
+}
+
+// stopWorkflow stops and removes the adapter of a running device.
+func (m *Manager) stopWorkflow() []workflowStep {
+	return []workflowStep{
+		{
+			name: "stop_adapter",
+			do: func(ctx context.Context, op *Operation) error {
+				dev, err := m.operationDevice(op)
+				if err != nil {
+					return err
+				}
+				if err := m.stopContainer(ctx, dev); err != nil {
+					return fmt.Errorf("stop adapter container: %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name: "mark_stopped",
+			do: func(ctx context.Context, op *Operation) error {
+				dev, err := m.operationDevice(op)
+				if err != nil {
+					return err
+				}
+				if dev.Status != StatusStopped {
+					if err := dev.transition(StatusStopped); err != nil {
+						return err
+					}
+				}
+				dev.ContainerID = ""
+				if err := m.db.Save(dev).Error; err != nil {
+					return fmt.Errorf("update device record in db: %w", err)
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// restartWorkflow recreates the adapter of a running or exited device.
+func (m *Manager) restartWorkflow() []workflowStep {
+	return []workflowStep{
+		{
+			name: "restart_adapter",
+			do:   m.startAdapter,
+			// runtime.Run removes the old container before creating the new
+			// one, so a failed restart leaves the device without a container.
+			undo: func(ctx context.Context, op *Operation) error {
+				return m.db.WithContext(ctx).Model(&Device{}).Where("id = ?", op.DeviceID).
+					Updates(map[string]any{"status": StatusStopped, "container_id": ""}).Error
+			},
+		},
+		{
+			name: "mark_running",
+			do:   m.markRunning,
+		},
+	}
+}
+
+// deleteWorkflow stops a device's adapter and marks the device deleted. Its
+// record and stream are kept.
+func (m *Manager) deleteWorkflow() []workflowStep {
+	return []workflowStep{
+		{
+			name: "stop_adapter",
+			do: func(ctx context.Context, op *Operation) error {
+				dev, err := m.operationDevice(op)
+				if err != nil {
+					return err
+				}
+				if err := m.stopContainer(ctx, dev); err != nil {
+					m.lg.Error().Err(err).Str("device_id", dev.ID).Msg("failed to stop/remove container, proceeding to update status")
+				}
+				return nil
+			},
+		},
+		{
+			name: "mark_deleted",
+			do: func(ctx context.Context, op *Operation) error {
+				dev, err := m.operationDevice(op)
+				if err != nil {
+					return err
+				}
+				if dev.Status == StatusDeleted {
+					return nil
+				}
+				if err := dev.transition(StatusDeleted); err != nil {
+					return err
+				}
+				if err := m.db.Save(dev).Error; err != nil {
+					return fmt.Errorf("failed to update device status to deleted: %w", err)
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// purgeWorkflow permanently removes a device and leaves a tombstone. It only
+// moves forward: a failed purge can be retried.
+func (m *Manager) purgeWorkflow() []workflowStep {
+	return []workflowStep{
+		{
+			// Removing the container also drops its Traefik route, which
+			// lives in the container labels, and the MQTT credentials
+			// passed in its env.
+			name: "remove_adapter",
+			do: func(ctx context.Context, op *Operation) error {
+				dev, err := m.operationDevice(op)
+				if errors.Is(err, ErrNotFound) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if err := m.stopContainer(ctx, dev); err != nil {
+					return fmt.Errorf("remove adapter container: %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name: "delete_stream",
+			do: func(ctx context.Context, op *Operation) error {
+				if err := m.nc.DeleteStream((&Device{ID: op.DeviceID}).streamName()); err != nil {
+					return fmt.Errorf("delete nats stream: %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			name: "delete_record",
+			do: func(ctx context.Context, op *Operation) error {
+				dev, err := m.operationDevice(op)
+				if errors.Is(err, ErrNotFound) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				return m.deleteRecord(ctx, dev)
+			},
+		},
+	}
+}
+
+// startAdapter (re)creates a device's adapter and records its container.
+func (m *Manager) startAdapter(ctx context.Context, op *Operation) error {
+	dev, err := m.operationDevice(op)
+	if err != nil {
+		return err
+	}
+	if err := m.runContainer(ctx, dev); err != nil {
+		return fmt.Errorf("start adapter container: %w", err)
+	}
+	saved, err := m.saveDeviceIf(ctx, dev, statusesTo(StatusRunning), containerColumns...)
+	if err != nil {
+		return err
+	}
+	if !saved {
+		return fmt.Errorf("%w: device can no longer run", ErrInvalidTransition)
+	}
+	return nil
+}
+
+// removeAdapter undoes startAdapter.
+func (m *Manager) removeAdapter(ctx context.Context, op *Operation) error {
+	dev, err := m.operationDevice(op)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return m.stopContainer(ctx, dev)
+}
+
+// markRunning moves a device whose adapter was (re)started to running.
+func (m *Manager) markRunning(ctx context.Context, op *Operation) error {
+	dev, err := m.operationDevice(op)
+	if err != nil {
+		return err
+	}
+	if err := dev.transition(StatusRunning); err != nil {
+		return err
+	}
+	saved, err := m.saveDeviceIf(ctx, dev, statusesTo(StatusRunning), "status")
+	if err != nil {
+		return err
+	}
+	if !saved {
+		return fmt.Errorf("%w: device can no longer run", ErrInvalidTransition)
+	}
+	return nil
+}
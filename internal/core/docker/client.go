@@ -2,12 +2,20 @@
 package docker
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
-	"io"
+	"fmt"
 	"os"
+	"path"
+	"strings"
+	"time"
 
+	"service-io/internal/core/runtime"
+
+	"github.com/distribution/reference"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
@@ -18,6 +26,7 @@ import (
 
 const doRegistry = "registry.digitalocean.com"
 
+// Client runs adapters as local Docker containers.
 type Client struct {
 	cli        *client.Client
 	lg         zerolog.Logger
@@ -33,16 +42,7 @@ func New(lg zerolog.Logger) (*Client, error) {
 		return nil, err
 	}
 
-	c := &Client{cli: cli, lg: lg.With().Str("adapter", "docker").Logger()}
-
-	if tok := os.Getenv("DO_REGISTRY_TOKEN"); tok != "" {
-		if hdr, err := c.loginDO(context.Background(), tok); err == nil {
-			c.authHeader = hdr
-			c.lg.Info().Msg("logged in to DigitalOcean registry")
-		} else {
-			c.lg.Warn().Err(err).Msg("registry login failed; will try anonymous pulls")
-		}
-	}
+	c := newClient(cli, lg.With().Str("adapter", "docker").Logger())
 
 	if nets, err := currentContainerNetworks(cli); err == nil {
 		c.networks = nets
@@ -54,48 +54,86 @@ func New(lg zerolog.Logger) (*Client, error) {
 	return c, nil
 }
 
-// RunAdapter now accepts MQTT credentials.
-func (c *Client) RunAdapter(
-	ctx context.Context,
-	deviceID, image, natsURL, mqttUser, mqttPassword string,
-	labels map[string]string,
-) (containerID string, err error) {
-	name := "adapter-" + deviceID
-	subject := "devices." + deviceID + ".telemetry"
-
-	// Ensure the container is removed if it already exists.
-	_ = c.cli.ContainerRemove(ctx, name,
-		types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
+// Host is a remote Docker engine.
+type Host struct {
+	Name string
+	// Endpoint is tcp://host:port, ssh://[user@]host[:port] or unix:///path.
+	Endpoint string
+	// Client TLS material for tcp:// endpoints; empty for plain TCP.
+	TLSCACert string
+	TLSCert   string
+	TLSKey    string
+}
 
-	if err := c.ensureImage(ctx, image); err != nil {
-		return "", err
+// NewForHost connects to a remote engine.
+func NewForHost(h Host, lg zerolog.Logger) (*Client, error) {
+	opts := []client.Opt{client.WithAPIVersionNegotiation()}
+	if strings.HasPrefix(h.Endpoint, "ssh://") {
+		dial, err := sshDialer(h.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		// The host part is only used in request URLs; dial-stdio picks the socket.
+		opts = append(opts, client.WithHost("http://docker.example.com"), client.WithDialContext(dial))
+	} else {
+		opts = append(opts, client.WithHost(h.Endpoint))
+		if h.TLSCACert != "" || h.TLSCert != "" {
+			opts = append(opts, client.WithTLSClientConfig(h.TLSCACert, h.TLSCert, h.TLSKey))
+		}
+	}
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, err
 	}
+	return newClient(cli, lg.With().Str("adapter", "docker").Str("host", h.Name).Logger()), nil
+}
+
+func newClient(cli *client.Client, lg zerolog.Logger) *Client {
+	c := &Client{cli: cli, lg: lg}
 
-	// Prepare environment variables.
-	env := []string{
-		"NATS_URL=" + natsURL,
-		"DEVICE_ID=" + deviceID,
-		"NATS_SUBJECT=" + subject,
-		"ENABLE_JETSTREAM=true",
+	if tok := os.Getenv("DO_REGISTRY_TOKEN"); tok != "" {
+		if hdr, err := c.loginDO(context.Background(), tok); err == nil {
+			c.authHeader = hdr
+			c.lg.Info().Msg("logged in to DigitalOcean registry")
+		} else {
+			c.lg.Warn().Err(err).Msg("registry login failed; will try anonymous pulls")
+		}
 	}
+	return c
+}
+
+// ConfigFilePath is where the adapter configuration is placed inside the container.
+const ConfigFilePath = "/etc/scadable/adapter-config.json"
+
+// Run (re)creates and starts the adapter container for a device.
+func (c *Client) Run(ctx context.Context, spec runtime.AdapterSpec) (containerID string, err error) {
+	// Ensure the container is removed if it already exists.
+	_ = c.cli.ContainerRemove(ctx, spec.Name,
+		types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
 
-	// Add MQTT credentials if provided.
-	if mqttUser != "" && mqttPassword != "" {
-		env = append(env, "MQTT_USER="+mqttUser, "MQTT_PASSWORD="+mqttPassword)
+	if err := c.ensureImage(ctx, spec.Image); err != nil {
+		return "", err
 	}
 
 	// Apply the labels in the container config.
 	resp, err := c.cli.ContainerCreate(ctx, &container.Config{
-		Image:  image,
-		Env:    env,    // Pass the combined environment variables.
-		Labels: labels, // Apply the Traefik labels here.
-	}, nil, nil, nil, name)
+		Image:  spec.Image,
+		Env:    spec.Env(ConfigFilePath),
+		Labels: spec.Labels, // Apply the Traefik labels here.
+	}, nil, nil, nil, spec.Name)
 	if err != nil {
 		return "", err
 	}
 
+	if spec.Config != nil {
+		if err := c.copyConfig(ctx, resp.ID, spec); err != nil {
+			_ = c.cli.ContainerRemove(ctx, resp.ID, types.ContainerRemoveOptions{Force: true})
+			return "", fmt.Errorf("copy adapter config: %w", err)
+		}
+	}
+
 	// Connect the container to the appropriate network.
-	netName := labels["traefik.docker.network"]
+	netName := spec.Labels["traefik.docker.network"]
 	if netName != "" {
 		err = c.cli.NetworkConnect(ctx, netName, resp.ID, &network.EndpointSettings{})
 		if err != nil {
@@ -110,8 +148,40 @@ func (c *Client) RunAdapter(
 	return resp.ID, nil
 }
 
-// ... (rest of the file is unchanged) ...
-func (c *Client) StopAndRemoveContainer(ctx context.Context, containerIdentifier string) error {
+// copyConfig writes the adapter configuration into a created container at
+// ConfigFilePath. It must run before the container is started.
+func (c *Client) copyConfig(ctx context.Context, containerID string, spec runtime.AdapterSpec) error {
+	raw, err := spec.ConfigJSON()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	dir := strings.TrimPrefix(path.Dir(ConfigFilePath), "/") + "/"
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir, Mode: 0o755}); err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     strings.TrimPrefix(ConfigFilePath, "/"),
+		Mode:     0o644,
+		Size:     int64(len(raw)),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(raw); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return c.cli.CopyToContainer(ctx, containerID, "/", &buf, types.CopyToContainerOptions{})
+}
+
+// Stop stops and removes a container. A missing container is not an error.
+func (c *Client) Stop(ctx context.Context, containerIdentifier string) error {
 	c.lg.Info().Str("container", containerIdentifier).Msg("stopping and removing container")
 
 	// The `Force: true` option in ContainerRemove will stop the container first.
@@ -134,23 +204,119 @@ func (c *Client) StopAndRemoveContainer(ctx context.Context, containerIdentifier
 	return err
 }
 
+// Inspect returns the live state of a container. It returns (nil, nil) if
+// the container does not exist.
+func (c *Client) Inspect(ctx context.Context, containerIdentifier string) (*runtime.State, error) {
+	ins, err := c.cli.ContainerInspect(ctx, containerIdentifier)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	st := &runtime.State{RestartCount: ins.RestartCount}
+	if ins.State != nil {
+		st.Status = ins.State.Status
+		st.Running = ins.State.Running
+		st.ExitCode = ins.State.ExitCode
+		st.StartedAt, _ = time.Parse(time.RFC3339Nano, ins.State.StartedAt)
+		st.FinishedAt, _ = time.Parse(time.RFC3339Nano, ins.State.FinishedAt)
+	}
+	return st, nil
+}
+
+// List returns the adapter containers on the engine: those labelled as
+// managed by service-io and, for containers created before the labels
+// existed, those named adapter-<device ID>.
+func (c *Client) List(ctx context.Context) ([]runtime.Instance, error) {
+	conts, err := c.cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	var out []runtime.Instance
+	for _, ct := range conts {
+		name := ""
+		if len(ct.Names) > 0 {
+			name = strings.TrimPrefix(ct.Names[0], "/")
+		}
+		devID := ct.Labels[runtime.LabelDeviceID]
+		if ct.Labels[runtime.LabelManagedBy] != runtime.ManagedByValue {
+			id, ok := strings.CutPrefix(name, "adapter-")
+			if !ok {
+				continue
+			}
+			devID = id
+		}
+		out = append(out, runtime.Instance{
+			ID:       ct.ID,
+			Name:     name,
+			DeviceID: devID,
+			Running:  ct.State == "running" || ct.State == "restarting",
+			Labels:   ct.Labels,
+		})
+	}
+	return out, nil
+}
+
+// Resolve pulls an image if it is missing (or always, with forcePull) and
+// returns its digest and the adapter contract declared by its labels. The
+// digest is the "repo@sha256:..." of the image's own repository, so other
+// hosts can pull exactly the same image; images without one, e.g. built
+// locally, are rejected with runtime.ErrNoDigest.
+func (c *Client) Resolve(ctx context.Context, image string, forcePull bool) (*runtime.ImageInfo, error) {
+	if forcePull {
+		if err := c.pullImage(ctx, image); err != nil {
+			return nil, err
+		}
+	} else if err := c.ensureImage(ctx, image); err != nil {
+		return nil, err
+	}
+	ins, _, err := c.cli.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+
+	var labels map[string]string
+	if ins.Config != nil {
+		labels = ins.Config.Labels
+	}
+	ct, err := runtime.ParseContract(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := repoDigest(image, ins.RepoDigests)
+	if err != nil {
+		return nil, err
+	}
+	return &runtime.ImageInfo{Digest: digest, Contract: *ct}, nil
+}
+
+// repoDigest picks the digest of image's repository among the repo digests
+// of its local copy, which also lists those of any other repository the
+// same image was pulled or pushed from.
+func repoDigest(image string, repoDigests []string) (string, error) {
+	want, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("parse image reference %q: %w", image, err)
+	}
+	for _, d := range repoDigests {
+		got, err := reference.ParseNormalizedNamed(d)
+		if err == nil && got.Name() == want.Name() {
+			return d, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s was not pulled from %s", runtime.ErrNoDigest, image, reference.FamiliarName(want))
+}
+
 func (c *Client) ensureImage(ctx context.Context, img string) error {
 	_, _, err := c.cli.ImageInspectWithRaw(ctx, img)
 	if err == nil {
 		return nil
 	}
 	if client.IsErrNotFound(err) {
-		opts := types.ImagePullOptions{}
-		if c.authHeader != "" {
-			opts.RegistryAuth = c.authHeader
-		}
-		rc, err := c.cli.ImagePull(ctx, img, opts)
-		if err != nil {
-			return err
-		}
-		io.Copy(io.Discard, rc)
-		rc.Close()
-		return nil
+		return c.pullImage(ctx, img)
 	}
 	return err
 }
@@ -0,0 +1,150 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"service-io/internal/core/runtime"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Logs streams the combined stdout and stderr of a container.
+func (c *Client) Logs(ctx context.Context, ref string, opts runtime.LogOptions) (io.ReadCloser, error) {
+	lo := container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: opts.Follow}
+	if opts.Tail > 0 {
+		lo.Tail = strconv.Itoa(opts.Tail)
+	}
+	if !opts.Since.IsZero() {
+		lo.Since = strconv.FormatInt(opts.Since.Unix(), 10)
+	}
+	rc, err := c.cli.ContainerLogs(ctx, ref, lo)
+	if err != nil {
+		return nil, err
+	}
+
+	// Adapters run without a TTY, so both streams arrive multiplexed.
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(pw, pw, rc)
+		rc.Close()
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// Stats samples the resource usage of a container. It blocks for about a
+// second so the daemon can compute the CPU delta.
+func (c *Client) Stats(ctx context.Context, ref string) (*runtime.Stats, error) {
+	resp, err := c.cli.ContainerStats(ctx, ref, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var s types.StatsJSON
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return nil, fmt.Errorf("decode container stats: %w", err)
+	}
+
+	out := &runtime.Stats{
+		MemoryBytes:      s.MemoryStats.Usage,
+		MemoryLimitBytes: s.MemoryStats.Limit,
+		PIDs:             s.PidsStats.Current,
+		Time:             s.Read,
+	}
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	sysDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	if cpuDelta > 0 && sysDelta > 0 {
+		cpus := float64(s.CPUStats.OnlineCPUs)
+		if cpus == 0 {
+			cpus = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+		}
+		out.CPUPercent = cpuDelta / sysDelta * cpus * 100
+	}
+	for _, n := range s.Networks {
+		out.NetRxBytes += n.RxBytes
+		out.NetTxBytes += n.TxBytes
+	}
+	return out, nil
+}
+
+// Events streams lifecycle events of containers labelled as managed by
+// service-io.
+func (c *Client) Events(ctx context.Context) (<-chan runtime.Event, error) {
+	msgs, errs := c.cli.Events(ctx, types.EventsOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", string(events.ContainerEventType)),
+			filters.Arg("label", runtime.LabelManagedBy+"="+runtime.ManagedByValue),
+		),
+	})
+
+	out := make(chan runtime.Event)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case msg := <-msgs:
+				ev, ok := toEvent(msg)
+				if !ok {
+					continue
+				}
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			case err := <-errs:
+				if err != nil && ctx.Err() == nil && !client.IsErrConnectionFailed(err) {
+					c.lg.Warn().Err(err).Msg("docker event stream ended")
+				}
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// toEvent maps the Docker container events service-io cares about.
+func toEvent(msg events.Message) (runtime.Event, bool) {
+	ev := runtime.Event{
+		ID:       msg.Actor.ID,
+		Name:     msg.Actor.Attributes["name"],
+		DeviceID: msg.Actor.Attributes[runtime.LabelDeviceID],
+		Time:     time.Unix(0, msg.TimeNano).UTC(),
+	}
+	action := string(msg.Action)
+	switch {
+	case action == string(events.ActionStart):
+		ev.Action = runtime.EventStart
+	case action == string(events.ActionDie):
+		ev.Action = runtime.EventDie
+		ev.ExitCode, _ = strconv.Atoi(msg.Actor.Attributes["exitCode"])
+	case action == string(events.ActionOOM):
+		ev.Action = runtime.EventOOM
+	case action == string(events.ActionRestart):
+		ev.Action = runtime.EventRestart
+	case action == string(events.ActionDestroy):
+		ev.Action = runtime.EventDestroy
+	case strings.HasPrefix(action, string(events.ActionHealthStatus)):
+		ev.Action = runtime.EventHealth
+		ev.Health = strings.TrimSpace(strings.TrimPrefix(action, string(events.ActionHealthStatus)+":"))
+	default:
+		return ev, false
+	}
+	return ev, true
+}
+
+var _ runtime.Runtime = (*Client)(nil)
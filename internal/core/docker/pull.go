@@ -0,0 +1,93 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"service-io/internal/core/runtime"
+
+	"github.com/docker/docker/api/types"
+)
+
+// pullMessage is one line of the JSON stream returned by ImagePull.
+type pullMessage struct {
+	Status         string `json:"status"`
+	ID             string `json:"id"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+	Error string `json:"error"`
+}
+
+type pullLayer struct {
+	current, total int64
+	done           bool
+}
+
+// pullImage pulls img, reporting progress to the callback on ctx, if any.
+// Errors reported inside the stream fail the pull.
+func (c *Client) pullImage(ctx context.Context, img string) error {
+	opts := types.ImagePullOptions{}
+	if c.authHeader != "" {
+		opts.RegistryAuth = c.authHeader
+	}
+	rc, err := c.cli.ImagePull(ctx, img, opts)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	report := runtime.PullProgressFunc(ctx)
+	var (
+		layers = make(map[string]*pullLayer)
+		order  []string
+	)
+	dec := json.NewDecoder(rc)
+	for {
+		var msg pullMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Error != "" {
+			return errors.New(msg.Error)
+		}
+		if report == nil {
+			continue
+		}
+
+		// Layer messages carry the layer ID. "Pulling from" carries the tag.
+		if l := layers[msg.ID]; msg.ID != "" && !strings.HasPrefix(msg.Status, "Pulling from") {
+			if l == nil {
+				l = &pullLayer{}
+				layers[msg.ID] = l
+				order = append(order, msg.ID)
+			}
+			switch msg.Status {
+			case "Downloading":
+				l.current, l.total = msg.ProgressDetail.Current, msg.ProgressDetail.Total
+			case "Download complete", "Pull complete", "Already exists":
+				if l.total > 0 {
+					l.current = l.total
+				}
+				l.done = msg.Status != "Download complete"
+			}
+		}
+
+		p := runtime.PullProgress{Image: img, Status: msg.Status, Layers: len(order)}
+		for _, id := range order {
+			l := layers[id]
+			p.Current += l.current
+			p.Total += l.total
+			if l.done {
+				p.LayersDone++
+			}
+		}
+		report(p)
+	}
+}
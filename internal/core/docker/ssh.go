@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// sshDialer returns a dialer that reaches the Docker daemon of an ssh://
+// endpoint by running "docker system dial-stdio" on it, as the docker CLI
+// does. It relies on the local ssh client and its configuration for keys
+// and known hosts.
+func sshDialer(endpoint string) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ssh" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid ssh endpoint %q", endpoint)
+	}
+	args := []string{"-o", "BatchMode=yes"}
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+	if p := u.Port(); p != "" {
+		args = append(args, "-p", p)
+	}
+	args = append(args, "--", u.Hostname(), "docker", "system", "dial-stdio")
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		// The connection outlives the dial context, so it is not bound to it.
+		cmd := exec.Command("ssh", args...)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("start ssh: %w", err)
+		}
+		return &cmdConn{cmd: cmd, r: stdout, w: stdin, remote: u.Host}, nil
+	}, nil
+}
+
+// cmdConn is a net.Conn over the stdio of a command.
+type cmdConn struct {
+	cmd    *exec.Cmd
+	r      io.ReadCloser
+	w      io.WriteCloser
+	remote string
+
+	closeOnce sync.Once
+}
+
+func (c *cmdConn) Read(p []byte) (int, error)  { return c.r.Read(p) }
+func (c *cmdConn) Write(p []byte) (int, error) { return c.w.Write(p) }
+
+func (c *cmdConn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.w.Close()
+		_ = c.r.Close()
+		_ = c.cmd.Process.Kill()
+		_ = c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *cmdConn) LocalAddr() net.Addr  { return cmdAddr("local") }
+func (c *cmdConn) RemoteAddr() net.Addr { return cmdAddr(c.remote) }
+
+// Deadlines are not supported on pipes to a command; the HTTP client relies
+// on context cancellation instead.
+func (c *cmdConn) SetDeadline(t time.Time) error      { return nil }
+func (c *cmdConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *cmdConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type cmdAddr string
+
+func (a cmdAddr) Network() string { return "ssh" }
+func (a cmdAddr) String() string  { return string(a) }
@@ -0,0 +1,453 @@
+// Package kube runs adapters on Kubernetes: one Pod, Secret and Service per
+// device, exposed through a Traefik IngressRouteTCP. Pods are not restarted
+// by Kubernetes; as with the other runtimes, service-io restarts them
+// following the restart policy of the adapter's type.
+package kube
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"service-io/internal/core/runtime"
+	"service-io/pkg/rand"
+
+	"github.com/rs/zerolog"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// IngressRouteTCPResource is Traefik's IngressRouteTCP custom resource.
+var IngressRouteTCPResource = schema.GroupVersionResource{
+	Group:    "traefik.io",
+	Version:  "v1alpha1",
+	Resource: "ingressroutetcps",
+}
+
+// ConfigFilePath is where the adapter configuration is mounted inside the pod.
+const ConfigFilePath = "/etc/scadable/adapter-config.json"
+
+// Kubernetes labels and annotations set on adapter objects, next to the
+// io.scadable.* labels of the spec.
+const (
+	labelName      = "app.kubernetes.io/name"
+	labelInstance  = "app.kubernetes.io/instance"
+	labelManagedBy = "app.kubernetes.io/managed-by"
+
+	containerName = "adapter"
+	configKey     = "adapter-config.json"
+
+	// podGonePoll is how often Run checks whether the previous pod of an
+	// adapter is gone.
+	podGonePoll = time.Second
+)
+
+// Options configures where and how adapters are deployed.
+type Options struct {
+	// Namespace holds all adapter objects.
+	Namespace string
+	// ImagePullSecret optionally names a Secret in Namespace used to pull
+	// adapter images.
+	ImagePullSecret string
+}
+
+// Client runs adapters as Kubernetes Pods.
+type Client struct {
+	cs   kubernetes.Interface
+	dyn  dynamic.Interface
+	opts Options
+	lg   zerolog.Logger
+}
+
+// New returns a Client using the given clientsets, which may be the fakes
+// from k8s.io/client-go/kubernetes/fake and k8s.io/client-go/dynamic/fake.
+func New(cs kubernetes.Interface, dyn dynamic.Interface, opts Options, lg zerolog.Logger) *Client {
+	if opts.Namespace == "" {
+		opts.Namespace = "default"
+	}
+	return &Client{cs: cs, dyn: dyn, opts: opts, lg: lg.With().Str("adapter", "kubernetes").Logger()}
+}
+
+// NewFromKubeconfig connects using a kubeconfig file, or the in-cluster
+// service account when kubeconfig is empty.
+func NewFromKubeconfig(kubeconfig string, opts Options, lg zerolog.Logger) (*Client, error) {
+	var (
+		cfg *rest.Config
+		err error
+	)
+	if kubeconfig == "" {
+		cfg, err = rest.InClusterConfig()
+	} else {
+		cfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes config: %w", err)
+	}
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return New(cs, dyn, opts, lg), nil
+}
+
+var _ runtime.Runtime = (*Client)(nil)
+
+// Resolve returns the image reference unchanged. The kubelet pulls images
+// when pods start, so images are neither pinned to a digest nor checked for
+// an adapter contract here; tags are pulled again whenever a pod starts.
+// REQUIRE_IMAGE_CONTRACT is therefore rejected with this runtime.
+func (c *Client) Resolve(ctx context.Context, image string, forcePull bool) (*runtime.ImageInfo, error) {
+	return &runtime.ImageInfo{Digest: image}, nil
+}
+
+// Run creates or updates the Secret, Service and IngressRouteTCP of an
+// adapter and replaces its pod, waiting for the previous pod to be gone so
+// two never run side by side. The returned ID is the object name shared by
+// all of them; pods are named after it with a random suffix.
+func (c *Client) Run(ctx context.Context, spec runtime.AdapterSpec) (string, error) {
+	name := objectName(spec.Name)
+
+	secret, err := c.secret(name, spec)
+	if err != nil {
+		return "", err
+	}
+	if err := c.deletePods(ctx, name, true); err != nil {
+		return "", err
+	}
+	if err := c.applySecret(ctx, secret); err != nil {
+		return "", fmt.Errorf("apply secret: %w", err)
+	}
+	if _, err := c.cs.CoreV1().Pods(c.opts.Namespace).Create(ctx, c.pod(name, spec, secret), metav1.CreateOptions{}); err != nil {
+		return "", fmt.Errorf("create pod: %w", err)
+	}
+
+	if spec.Route == nil {
+		// The adapter may have been routed before.
+		if err := c.deleteRouting(ctx, name); err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+	if err := c.applyService(ctx, c.service(name, spec)); err != nil {
+		return "", fmt.Errorf("apply service: %w", err)
+	}
+	if err := c.applyIngressRoute(ctx, c.ingressRoute(name, spec)); err != nil {
+		return "", fmt.Errorf("apply ingressroutetcp: %w", err)
+	}
+	return name, nil
+}
+
+// Stop deletes all objects of an adapter. Missing objects are not an error.
+func (c *Client) Stop(ctx context.Context, ref string) error {
+	name := objectName(ref)
+	c.lg.Info().Str("adapter", name).Msg("deleting adapter")
+
+	if err := c.deletePods(ctx, name, false); err != nil {
+		return err
+	}
+	if err := c.deleteRouting(ctx, name); err != nil {
+		return err
+	}
+	err := c.cs.CoreV1().Secrets(c.opts.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if ignoreNotFound(err) != nil {
+		return fmt.Errorf("delete secret: %w", err)
+	}
+	return nil
+}
+
+// deletePods deletes the pods of an adapter and, with wait, returns only
+// once they are gone. The Deployment earlier versions ran adapters in is
+// deleted too.
+func (c *Client) deletePods(ctx context.Context, name string, wait bool) error {
+	fg := metav1.DeletePropagationForeground
+	err := c.cs.AppsV1().Deployments(c.opts.Namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &fg})
+	if ignoreNotFound(err) != nil {
+		return fmt.Errorf("delete deployment: %w", err)
+	}
+
+	api := c.cs.CoreV1().Pods(c.opts.Namespace)
+	sel := metav1.ListOptions{LabelSelector: labels.SelectorFromSet(selector(name)).String()}
+	pods, err := api.List(ctx, sel)
+	if err != nil {
+		return fmt.Errorf("list pods: %w", err)
+	}
+	for _, p := range pods.Items {
+		if p.DeletionTimestamp != nil {
+			continue
+		}
+		if err := api.Delete(ctx, p.Name, metav1.DeleteOptions{}); ignoreNotFound(err) != nil {
+			return fmt.Errorf("delete pod: %w", err)
+		}
+	}
+	for wait && len(pods.Items) > 0 {
+		if pods, err = api.List(ctx, sel); err != nil {
+			return fmt.Errorf("list pods: %w", err)
+		}
+		if len(pods.Items) == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait for pod of %s to be deleted: %w", name, ctx.Err())
+		case <-time.After(podGonePoll):
+		}
+	}
+	return nil
+}
+
+func (c *Client) deleteRouting(ctx context.Context, name string) error {
+	err := c.dyn.Resource(IngressRouteTCPResource).Namespace(c.opts.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if ignoreNotFound(err) != nil {
+		return fmt.Errorf("delete ingressroutetcp: %w", err)
+	}
+	err = c.cs.CoreV1().Services(c.opts.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if ignoreNotFound(err) != nil {
+		return fmt.Errorf("delete service: %w", err)
+	}
+	return nil
+}
+
+// secret holds the adapter's environment and config file, so credentials
+// never appear in the Pod.
+func (c *Client) secret(name string, spec runtime.AdapterSpec) (*corev1.Secret, error) {
+	data := make(map[string][]byte)
+	for _, kv := range spec.Env(ConfigFilePath) {
+		k, v, _ := strings.Cut(kv, "=")
+		data[k] = []byte(v)
+	}
+	if spec.Config != nil {
+		raw, err := spec.ConfigJSON()
+		if err != nil {
+			return nil, fmt.Errorf("encode adapter config: %w", err)
+		}
+		data[configKey] = raw
+	}
+	return &corev1.Secret{
+		ObjectMeta: c.meta(name, spec),
+		Type:       corev1.SecretTypeOpaque,
+		Data:       data,
+	}, nil
+}
+
+// pod returns a new pod of the adapter. It is never restarted in place.
+func (c *Client) pod(name string, spec runtime.AdapterSpec, secret *corev1.Secret) *corev1.Pod {
+	// Reference every variable explicitly; the config file key is not a
+	// valid variable name and is mounted instead.
+	keys := make([]string, 0, len(secret.Data))
+	for k := range secret.Data {
+		if k != configKey {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	env := make([]corev1.EnvVar, 0, len(keys))
+	for _, k := range keys {
+		env = append(env, corev1.EnvVar{Name: k, ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: name},
+				Key:                  k,
+			},
+		}})
+	}
+
+	ctr := corev1.Container{
+		Name:            containerName,
+		Image:           spec.Image,
+		ImagePullPolicy: pullPolicy(spec.Image),
+		Env:             env,
+	}
+	pod := corev1.PodSpec{
+		Containers:    []corev1.Container{ctr},
+		RestartPolicy: corev1.RestartPolicyNever,
+	}
+	if spec.Route != nil {
+		pod.Containers[0].Ports = []corev1.ContainerPort{{Name: "adapter", ContainerPort: int32(spec.Route.Port)}}
+	}
+	if spec.Config != nil {
+		pod.Volumes = []corev1.Volume{{
+			Name: "config",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+				SecretName: name,
+				Items:      []corev1.KeyToPath{{Key: configKey, Path: path.Base(ConfigFilePath)}},
+			}},
+		}}
+		pod.Containers[0].VolumeMounts = []corev1.VolumeMount{{
+			Name:      "config",
+			MountPath: path.Dir(ConfigFilePath),
+			ReadOnly:  true,
+		}}
+	}
+	if c.opts.ImagePullSecret != "" {
+		pod.ImagePullSecrets = []corev1.LocalObjectReference{{Name: c.opts.ImagePullSecret}}
+	}
+
+	meta := c.meta(name, spec)
+	meta.Name = name + "-" + strings.ToLower(rand.ID16()[:5])
+	return &corev1.Pod{ObjectMeta: meta, Spec: pod}
+}
+
+func (c *Client) service(name string, spec runtime.AdapterSpec) *corev1.Service {
+	port := int32(spec.Route.Port)
+	return &corev1.Service{
+		ObjectMeta: c.meta(name, spec),
+		Spec: corev1.ServiceSpec{
+			Selector: selector(name),
+			Ports: []corev1.ServicePort{{
+				Name:       "adapter",
+				Port:       port,
+				TargetPort: intstr.FromInt32(port),
+				Protocol:   corev1.ProtocolTCP,
+			}},
+		},
+	}
+}
+
+func (c *Client) ingressRoute(name string, spec runtime.AdapterSpec) *unstructured.Unstructured {
+	r := spec.Route
+	obj := map[string]any{
+		"apiVersion": IngressRouteTCPResource.GroupVersion().String(),
+		"kind":       "IngressRouteTCP",
+		"spec": map[string]any{
+			"entryPoints": []any{r.EntryPoint},
+			"routes": []any{map[string]any{
+				"match": r.Rule(),
+				"services": []any{map[string]any{
+					"name": name,
+					"port": int64(r.Port),
+				}},
+			}},
+		},
+	}
+	if r.TLS {
+		tls := map[string]any{}
+		if r.Passthrough {
+			tls["passthrough"] = true
+		}
+		if r.CertResolver != "" {
+			tls["certResolver"] = r.CertResolver
+		}
+		if r.TLSOptions != "" {
+			tls["options"] = map[string]any{"name": r.TLSOptions}
+		}
+		if len(r.Domains) > 0 {
+			sans := make([]any, 0, len(r.Domains)-1)
+			for _, d := range r.Domains[1:] {
+				sans = append(sans, d)
+			}
+			tls["domains"] = []any{map[string]any{"main": r.Domains[0], "sans": sans}}
+		}
+		obj["spec"].(map[string]any)["tls"] = tls
+	}
+
+	u := &unstructured.Unstructured{Object: obj}
+	meta := c.meta(name, spec)
+	u.SetName(meta.Name)
+	u.SetNamespace(meta.Namespace)
+	u.SetLabels(meta.Labels)
+	return u
+}
+
+// meta returns the object metadata shared by all objects of an adapter.
+// Only the io.scadable.* labels of the spec are copied; routing labels are
+// meant for Traefik's Docker provider.
+func (c *Client) meta(name string, spec runtime.AdapterSpec) metav1.ObjectMeta {
+	labels := selector(name)
+	labels[labelName] = containerName
+	labels[labelManagedBy] = runtime.ManagedByValue
+	for k, v := range spec.Labels {
+		if strings.HasPrefix(k, "io.scadable.") {
+			labels[k] = v
+		}
+	}
+	return metav1.ObjectMeta{Name: name, Namespace: c.opts.Namespace, Labels: labels}
+}
+
+func (c *Client) applySecret(ctx context.Context, obj *corev1.Secret) error {
+	api := c.cs.CoreV1().Secrets(c.opts.Namespace)
+	cur, err := api.Get(ctx, obj.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = api.Create(ctx, obj, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	obj.ResourceVersion = cur.ResourceVersion
+	_, err = api.Update(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *Client) applyService(ctx context.Context, obj *corev1.Service) error {
+	api := c.cs.CoreV1().Services(c.opts.Namespace)
+	cur, err := api.Get(ctx, obj.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = api.Create(ctx, obj, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	// The cluster IP is immutable.
+	obj.ResourceVersion = cur.ResourceVersion
+	obj.Spec.ClusterIP = cur.Spec.ClusterIP
+	obj.Spec.ClusterIPs = cur.Spec.ClusterIPs
+	_, err = api.Update(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *Client) applyIngressRoute(ctx context.Context, obj *unstructured.Unstructured) error {
+	api := c.dyn.Resource(IngressRouteTCPResource).Namespace(c.opts.Namespace)
+	cur, err := api.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = api.Create(ctx, obj, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	obj.SetResourceVersion(cur.GetResourceVersion())
+	_, err = api.Update(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
+
+// objectName turns a container name into a valid object name. Device IDs
+// are upper case, which Kubernetes names must not be.
+func objectName(ref string) string {
+	return strings.ToLower(ref)
+}
+
+// pullPolicy pulls images given by tag on every start, so a moved tag is
+// picked up when Run rolls the pod. Images pinned to a digest never change.
+func pullPolicy(image string) corev1.PullPolicy {
+	if strings.Contains(image, "@") {
+		return corev1.PullIfNotPresent
+	}
+	return corev1.PullAlways
+}
+
+func selector(name string) map[string]string {
+	return map[string]string{labelInstance: name}
+}
+
+func ignoreNotFound(err error) error {
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
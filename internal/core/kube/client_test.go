@@ -0,0 +1,400 @@
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"service-io/internal/core/runtime"
+
+	"github.com/rs/zerolog"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testNamespace = "adapters"
+
+func newTestClient() (*Client, *fake.Clientset, *dynamicfake.FakeDynamicClient) {
+	cs := fake.NewClientset()
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(k8sruntime.NewScheme(),
+		map[schema.GroupVersionResource]string{IngressRouteTCPResource: "IngressRouteTCPList"})
+	return New(cs, dyn, Options{Namespace: testNamespace, ImagePullSecret: "registry"}, zerolog.Nop()), cs, dyn
+}
+
+func testSpec() runtime.AdapterSpec {
+	return runtime.AdapterSpec{
+		Name:         "adapter-EDIVRWCLGGPGCW7M",
+		DeviceID:     "EDIVRWCLGGPGCW7M",
+		Image:        "registry.example.com/adapter-mqtt:1",
+		NATSURL:      "nats://nats:4222",
+		NATSSubject:  "devices.EDIVRWCLGGPGCW7M.telemetry",
+		MQTTUser:     "EDIVRWCLGGPGCW7M",
+		MQTTPassword: "s3cret",
+		Labels: map[string]string{
+			runtime.LabelManagedBy: runtime.ManagedByValue,
+			runtime.LabelDeviceID:  "EDIVRWCLGGPGCW7M",
+			"traefik.enable":       "true",
+		},
+		Route: &runtime.Route{
+			Host:         "edivrwclggpgcw7m.io.example.com",
+			EntryPoint:   "mqtts",
+			Port:         1883,
+			TLS:          true,
+			CertResolver: "le",
+			TLSOptions:   "mqtt-only@file",
+			Domains:      []string{"*.io.example.com", "io.example.com"},
+		},
+		Config:        map[string]any{"broker": "tcp://plc:1883"},
+		ConfigVersion: 2,
+	}
+}
+
+const testName = "adapter-edivrwclggpgcw7m"
+
+// pods returns the pods of the test adapter.
+func pods(t *testing.T, cs *fake.Clientset) []corev1.Pod {
+	t.Helper()
+	list, err := cs.CoreV1().Pods(testNamespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: labelInstance + "=" + testName,
+	})
+	if err != nil {
+		t.Fatalf("list pods: %v", err)
+	}
+	return list.Items
+}
+
+// onlyPod returns the one pod of the test adapter.
+func onlyPod(t *testing.T, cs *fake.Clientset) *corev1.Pod {
+	t.Helper()
+	items := pods(t, cs)
+	if len(items) != 1 {
+		t.Fatalf("adapter has %d pods, want 1", len(items))
+	}
+	return &items[0]
+}
+
+func TestRun(t *testing.T) {
+	c, cs, dyn := newTestClient()
+	ctx := context.Background()
+
+	id, err := c.Run(ctx, testSpec())
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if id != testName {
+		t.Errorf("id = %q, want %q", id, testName)
+	}
+
+	secret, err := cs.CoreV1().Secrets(testNamespace).Get(ctx, testName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+	if got := string(secret.Data["MQTT_PASSWORD"]); got != "s3cret" {
+		t.Errorf("secret MQTT_PASSWORD = %q, want s3cret", got)
+	}
+	if _, ok := secret.Data[configKey]; !ok {
+		t.Errorf("secret has no %s", configKey)
+	}
+
+	p := onlyPod(t, cs)
+	if p.Labels[runtime.LabelDeviceID] != "EDIVRWCLGGPGCW7M" || p.Labels["traefik.enable"] != "" {
+		t.Errorf("pod labels = %v, want the io.scadable.* labels only", p.Labels)
+	}
+	// service-io restarts adapters itself, following the restart policy of
+	// their type.
+	pod := p.Spec
+	if pod.RestartPolicy != corev1.RestartPolicyNever {
+		t.Errorf("restart policy = %s, want %s", pod.RestartPolicy, corev1.RestartPolicyNever)
+	}
+	ctr := pod.Containers[0]
+	if ctr.Image != "registry.example.com/adapter-mqtt:1" || ctr.ImagePullPolicy != corev1.PullAlways {
+		t.Errorf("container image %s pulled %s, want the tag pulled always", ctr.Image, ctr.ImagePullPolicy)
+	}
+	for _, env := range ctr.Env {
+		if env.Value != "" || env.ValueFrom == nil || env.ValueFrom.SecretKeyRef.Name != testName {
+			t.Errorf("env %s is not taken from the secret", env.Name)
+		}
+	}
+	if len(ctr.VolumeMounts) != 1 || ctr.VolumeMounts[0].MountPath != "/etc/scadable" {
+		t.Errorf("config volume mounts = %+v, want /etc/scadable", ctr.VolumeMounts)
+	}
+	if len(pod.ImagePullSecrets) != 1 || pod.ImagePullSecrets[0].Name != "registry" {
+		t.Errorf("image pull secrets = %v, want registry", pod.ImagePullSecrets)
+	}
+
+	svc, err := cs.CoreV1().Services(testNamespace).Get(ctx, testName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get service: %v", err)
+	}
+	if p := svc.Spec.Ports[0]; p.Port != 1883 || p.TargetPort.IntVal != 1883 {
+		t.Errorf("service port = %+v, want 1883", p)
+	}
+
+	route, err := dyn.Resource(IngressRouteTCPResource).Namespace(testNamespace).Get(ctx, testName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get ingressroutetcp: %v", err)
+	}
+	routes, _, _ := unstructured.NestedSlice(route.Object, "spec", "routes")
+	if len(routes) != 1 || routes[0].(map[string]any)["match"] != "HostSNI(`edivrwclggpgcw7m.io.example.com`)" {
+		t.Errorf("routes = %v, want one matching the device host", routes)
+	}
+	if resolver, _, _ := unstructured.NestedString(route.Object, "spec", "tls", "certResolver"); resolver != "le" {
+		t.Errorf("cert resolver = %q, want le", resolver)
+	}
+	domains, _, _ := unstructured.NestedSlice(route.Object, "spec", "tls", "domains")
+	if len(domains) != 1 || domains[0].(map[string]any)["main"] != "*.io.example.com" {
+		t.Errorf("tls domains = %v, want *.io.example.com", domains)
+	}
+}
+
+func TestRunPinnedImage(t *testing.T) {
+	c, cs, _ := newTestClient()
+	ctx := context.Background()
+	spec := testSpec()
+	spec.Image = "registry.example.com/adapter-mqtt@sha256:9b2c"
+
+	if _, err := c.Run(ctx, spec); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if p := onlyPod(t, cs).Spec.Containers[0].ImagePullPolicy; p != corev1.PullIfNotPresent {
+		t.Errorf("pull policy = %s, want %s", p, corev1.PullIfNotPresent)
+	}
+}
+
+func TestRunReplacesPod(t *testing.T) {
+	c, cs, dyn := newTestClient()
+	ctx := context.Background()
+	// Earlier versions ran adapters in a Deployment of the same name.
+	legacy := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: testName, Namespace: testNamespace}}
+	if _, err := cs.AppsV1().Deployments(testNamespace).Create(ctx, legacy, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create deployment: %v", err)
+	}
+	if _, err := c.Run(ctx, testSpec()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if _, err := cs.AppsV1().Deployments(testNamespace).Get(ctx, testName, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("deployment of an earlier version still exists: %v", err)
+	}
+	first := onlyPod(t, cs)
+
+	spec := testSpec()
+	spec.Route = nil
+	spec.Config = nil
+	if _, err := c.Run(ctx, spec); err != nil {
+		t.Fatalf("run again: %v", err)
+	}
+	second := onlyPod(t, cs)
+	if second.Name == first.Name {
+		t.Errorf("pod %s kept, want it replaced", first.Name)
+	}
+	if n := len(second.Spec.Volumes); n != 0 {
+		t.Errorf("%d volumes left after the config was removed", n)
+	}
+	_, err := cs.CoreV1().Services(testNamespace).Get(ctx, testName, metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("service still exists: %v", err)
+	}
+	_, err = dyn.Resource(IngressRouteTCPResource).Namespace(testNamespace).Get(ctx, testName, metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("ingressroutetcp still exists: %v", err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	c, cs, dyn := newTestClient()
+	ctx := context.Background()
+	if _, err := c.Run(ctx, testSpec()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if err := c.Stop(ctx, "adapter-EDIVRWCLGGPGCW7M"); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if n := len(pods(t, cs)); n != 0 {
+		t.Errorf("%d pods left, want none", n)
+	}
+	if _, err := cs.CoreV1().Secrets(testNamespace).Get(ctx, testName, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("secret still exists: %v", err)
+	}
+	if _, err := cs.CoreV1().Services(testNamespace).Get(ctx, testName, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("service still exists: %v", err)
+	}
+	_, err := dyn.Resource(IngressRouteTCPResource).Namespace(testNamespace).Get(ctx, testName, metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("ingressroutetcp still exists: %v", err)
+	}
+
+	// Stopping a missing adapter is not an error.
+	if err := c.Stop(ctx, testName); err != nil {
+		t.Errorf("stop again: %v", err)
+	}
+}
+
+// testPod returns a pod of the test adapter with the given container state.
+func testPod(name string, created time.Time, restarts int32, state corev1.ContainerState) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         testNamespace,
+			UID:               types.UID(name),
+			CreationTimestamp: metav1.NewTime(created),
+			Labels: map[string]string{
+				labelInstance:         testName,
+				labelManagedBy:        runtime.ManagedByValue,
+				runtime.LabelDeviceID: "EDIVRWCLGGPGCW7M",
+			},
+		},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:         containerName,
+			RestartCount: restarts,
+			State:        state,
+		}}},
+	}
+}
+
+func TestInspect(t *testing.T) {
+	c, cs, _ := newTestClient()
+	ctx := context.Background()
+
+	st, err := c.Inspect(ctx, testName)
+	if err != nil || st != nil {
+		t.Fatalf("inspect missing adapter = %+v, %v, want nil, nil", st, err)
+	}
+
+	if _, err := c.Run(ctx, testSpec()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	st, err = c.Inspect(ctx, testName)
+	if err != nil || st == nil || st.Status != "created" {
+		t.Fatalf("inspect pending pod = %+v, %v, want created", st, err)
+	}
+	if err := cs.CoreV1().Pods(testNamespace).Delete(ctx, onlyPod(t, cs).Name, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("delete pod: %v", err)
+	}
+
+	started := time.Now().Add(-time.Minute).Truncate(time.Second)
+	old := testPod(testName+"-old", started.Add(-time.Hour), 0, corev1.ContainerState{
+		Terminated: &corev1.ContainerStateTerminated{ExitCode: 0},
+	})
+	cur := testPod(testName+"-cur", started, 2, corev1.ContainerState{
+		Running: &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(started)},
+	})
+	for _, p := range []*corev1.Pod{old, cur} {
+		if _, err := cs.CoreV1().Pods(testNamespace).Create(ctx, p, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("create pod: %v", err)
+		}
+	}
+	st, err = c.Inspect(ctx, "adapter-EDIVRWCLGGPGCW7M")
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	if !st.Running || st.Status != "running" || st.RestartCount != 2 || !st.StartedAt.Equal(started) {
+		t.Errorf("state = %+v, want the newest pod running since %s with 2 restarts", st, started)
+	}
+
+	cur.Status.Phase = corev1.PodFailed
+	cur.Status.ContainerStatuses[0].State = corev1.ContainerState{
+		Terminated: &corev1.ContainerStateTerminated{ExitCode: 3},
+	}
+	if _, err := cs.CoreV1().Pods(testNamespace).Update(ctx, cur, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update pod: %v", err)
+	}
+	st, err = c.Inspect(ctx, testName)
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	if st.Running || st.Status != "exited" || st.ExitCode != 3 {
+		t.Errorf("state = %+v, want exited with code 3", st)
+	}
+	insts, err := c.List(ctx)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(insts) != 1 || insts[0].Running {
+		t.Errorf("instances = %+v, want the exited adapter not running", insts)
+	}
+}
+
+func TestList(t *testing.T) {
+	c, _, _ := newTestClient()
+	ctx := context.Background()
+	if _, err := c.Run(ctx, testSpec()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	insts, err := c.List(ctx)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(insts) != 1 {
+		t.Fatalf("listed %d instances, want 1", len(insts))
+	}
+	in := insts[0]
+	if in.ID != testName || in.DeviceID != "EDIVRWCLGGPGCW7M" || !in.Running ||
+		in.Labels[runtime.LabelManagedBy] != runtime.ManagedByValue {
+		t.Errorf("instance = %+v, want running %s of EDIVRWCLGGPGCW7M", in, testName)
+	}
+}
+
+func TestPodEvents(t *testing.T) {
+	seen := make(map[types.UID]*runtime.State)
+	started := time.Now().Truncate(time.Second)
+	pod := testPod(testName+"-1", started, 0, corev1.ContainerState{
+		Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"},
+	})
+	actions := func(typ watch.EventType) []string {
+		var out []string
+		for _, ev := range podEvents(typ, pod, seen) {
+			if ev.ID != testName || ev.DeviceID != "EDIVRWCLGGPGCW7M" {
+				t.Errorf("event %+v not attributed to %s", ev, testName)
+			}
+			out = append(out, ev.Action)
+		}
+		return out
+	}
+	check := func(step string, got []string, want ...string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Errorf("%s: events %v, want %v", step, got, want)
+			return
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("%s: events %v, want %v", step, got, want)
+				return
+			}
+		}
+	}
+
+	check("created", actions(watch.Added))
+	pod.Status.ContainerStatuses[0].State = corev1.ContainerState{
+		Running: &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(started)},
+	}
+	check("started", actions(watch.Modified), runtime.EventStart)
+
+	// The container crashed and came back between two updates.
+	restarted := started.Add(time.Minute)
+	pod.Status.ContainerStatuses[0].RestartCount = 1
+	pod.Status.ContainerStatuses[0].State = corev1.ContainerState{
+		Running: &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(restarted)},
+	}
+	pod.Status.ContainerStatuses[0].LastTerminationState = corev1.ContainerState{
+		Terminated: &corev1.ContainerStateTerminated{ExitCode: 2},
+	}
+	check("restarted", actions(watch.Modified), runtime.EventDie, runtime.EventRestart, runtime.EventStart)
+
+	pod.Status.ContainerStatuses[0].State = corev1.ContainerState{
+		Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"},
+	}
+	check("oom killed", actions(watch.Modified), runtime.EventOOM, runtime.EventDie)
+	check("deleted", actions(watch.Deleted), runtime.EventDestroy)
+}
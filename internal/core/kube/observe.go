@@ -0,0 +1,255 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"service-io/internal/core/runtime"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Inspect maps the adapter's current pod to a container state. It returns
+// (nil, nil) if the adapter has no pod.
+func (c *Client) Inspect(ctx context.Context, ref string) (*runtime.State, error) {
+	pod, err := c.currentPod(ctx, objectName(ref))
+	if err != nil || pod == nil {
+		return nil, err
+	}
+	return podState(pod), nil
+}
+
+// List returns the adapters in the namespace by their current pod, sorted
+// by name. An adapter whose pod terminated is listed as not running.
+func (c *Client) List(ctx context.Context) ([]runtime.Instance, error) {
+	pods, err := c.cs.CoreV1().Pods(c.opts.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{labelManagedBy: runtime.ManagedByValue}).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]*corev1.Pod)
+	for i := range pods.Items {
+		p := &pods.Items[i]
+		name := p.Labels[labelInstance]
+		if name == "" || p.DeletionTimestamp != nil {
+			continue
+		}
+		if cur := current[name]; cur == nil || p.CreationTimestamp.After(cur.CreationTimestamp.Time) {
+			current[name] = p
+		}
+	}
+	out := make([]runtime.Instance, 0, len(current))
+	for name, p := range current {
+		out = append(out, runtime.Instance{
+			ID:       name,
+			Name:     name,
+			DeviceID: p.Labels[runtime.LabelDeviceID],
+			Running:  p.Status.Phase != corev1.PodSucceeded && p.Status.Phase != corev1.PodFailed,
+			Labels:   p.Labels,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Logs streams the logs of the adapter's current pod.
+func (c *Client) Logs(ctx context.Context, ref string, opts runtime.LogOptions) (io.ReadCloser, error) {
+	name := objectName(ref)
+	pod, err := c.currentPod(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if pod == nil {
+		return nil, fmt.Errorf("adapter %s has no pod", name)
+	}
+
+	lo := &corev1.PodLogOptions{Container: containerName, Follow: opts.Follow}
+	if opts.Tail > 0 {
+		tail := int64(opts.Tail)
+		lo.TailLines = &tail
+	}
+	if !opts.Since.IsZero() {
+		since := metav1.NewTime(opts.Since)
+		lo.SinceTime = &since
+	}
+	return c.cs.CoreV1().Pods(c.opts.Namespace).GetLogs(pod.Name, lo).Stream(ctx)
+}
+
+// Stats is not supported: resource usage lives in the metrics API, which
+// not every cluster serves.
+func (c *Client) Stats(ctx context.Context, ref string) (*runtime.Stats, error) {
+	return nil, fmt.Errorf("stats: %w", runtime.ErrNotSupported)
+}
+
+// Events watches adapter pods and translates their container state changes
+// into runtime events. The channel is closed when ctx is done or the API
+// server ends the watch; callers re-subscribe to continue.
+func (c *Client) Events(ctx context.Context) (<-chan runtime.Event, error) {
+	w, err := c.cs.CoreV1().Pods(c.opts.Namespace).Watch(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{labelManagedBy: runtime.ManagedByValue}).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan runtime.Event)
+	go func() {
+		defer close(out)
+		defer w.Stop()
+		seen := make(map[types.UID]*runtime.State)
+		for {
+			select {
+			case we, ok := <-w.ResultChan():
+				if !ok {
+					return
+				}
+				pod, ok := we.Object.(*corev1.Pod)
+				if !ok {
+					continue
+				}
+				for _, ev := range podEvents(we.Type, pod, seen) {
+					select {
+					case out <- ev:
+					case <-ctx.Done():
+						return
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// podEvents compares a pod with its last seen state and returns the events
+// in between.
+func podEvents(typ watch.EventType, pod *corev1.Pod, seen map[types.UID]*runtime.State) []runtime.Event {
+	base := runtime.Event{
+		ID:       pod.Labels[labelInstance],
+		Name:     pod.Labels[labelInstance],
+		DeviceID: pod.Labels[runtime.LabelDeviceID],
+		Time:     time.Now().UTC(),
+	}
+	with := func(action string, exitCode int) runtime.Event {
+		ev := base
+		ev.Action, ev.ExitCode = action, exitCode
+		return ev
+	}
+
+	prev := seen[pod.UID]
+	if typ == watch.Deleted {
+		delete(seen, pod.UID)
+		return []runtime.Event{with(runtime.EventDestroy, 0)}
+	}
+	cur := podState(pod)
+	seen[pod.UID] = cur
+	if prev == nil {
+		prev = &runtime.State{}
+	}
+
+	var evs []runtime.Event
+	if cur.RestartCount > prev.RestartCount {
+		// The container died and was restarted between two updates.
+		if prev.Running {
+			evs = append(evs, with(runtime.EventDie, lastExitCode(pod)))
+		}
+		evs = append(evs, with(runtime.EventRestart, 0))
+	}
+	switch {
+	case cur.Running && !cur.StartedAt.Equal(prev.StartedAt):
+		evs = append(evs, with(runtime.EventStart, 0))
+	case !cur.Running && prev.Running && cur.RestartCount == prev.RestartCount:
+		if oomKilled(pod) {
+			evs = append(evs, with(runtime.EventOOM, 0))
+		}
+		evs = append(evs, with(runtime.EventDie, cur.ExitCode))
+	}
+	return evs
+}
+
+// currentPod returns the newest live pod of an adapter, or nil.
+func (c *Client) currentPod(ctx context.Context, name string) (*corev1.Pod, error) {
+	pods, err := c.cs.CoreV1().Pods(c.opts.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(selector(name)).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var newest *corev1.Pod
+	for i := range pods.Items {
+		p := &pods.Items[i]
+		if p.DeletionTimestamp != nil {
+			continue
+		}
+		if newest == nil || p.CreationTimestamp.After(newest.CreationTimestamp.Time) {
+			newest = p
+		}
+	}
+	return newest, nil
+}
+
+// podState maps the adapter container's status to Docker's vocabulary:
+// created, running, restarting or exited.
+func podState(pod *corev1.Pod) *runtime.State {
+	st := &runtime.State{Status: "created"}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name != containerName {
+			continue
+		}
+		st.RestartCount = int(cs.RestartCount)
+		switch s := cs.State; {
+		case s.Running != nil:
+			st.Status, st.Running = "running", true
+			st.StartedAt = s.Running.StartedAt.Time
+		case s.Terminated != nil:
+			st.Status = "exited"
+			st.ExitCode = int(s.Terminated.ExitCode)
+			st.StartedAt = s.Terminated.StartedAt.Time
+			st.FinishedAt = s.Terminated.FinishedAt.Time
+		case s.Waiting != nil && s.Waiting.Reason == "CrashLoopBackOff":
+			st.Status = "restarting"
+			if t := cs.LastTerminationState.Terminated; t != nil {
+				st.ExitCode = int(t.ExitCode)
+				st.StartedAt = t.StartedAt.Time
+				st.FinishedAt = t.FinishedAt.Time
+			}
+		case s.Waiting != nil:
+			st.Status = strings.ToLower(s.Waiting.Reason)
+			if st.Status == "" || st.Status == "containercreating" {
+				st.Status = "created"
+			}
+		}
+	}
+	return st
+}
+
+// oomKilled reports whether the adapter container was killed for exceeding
+// its memory limit.
+func oomKilled(pod *corev1.Pod) bool {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == containerName && cs.State.Terminated != nil {
+			return cs.State.Terminated.Reason == "OOMKilled"
+		}
+	}
+	return false
+}
+
+// lastExitCode returns the exit code of the adapter container's previous run.
+func lastExitCode(pod *corev1.Pod) int {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == containerName && cs.LastTerminationState.Terminated != nil {
+			return int(cs.LastTerminationState.Terminated.ExitCode)
+		}
+	}
+	return 0
+}
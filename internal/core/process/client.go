@@ -0,0 +1,433 @@
+// Package process runs adapters as child processes of service-io, for
+// hosts without a container engine. Adapter types name a
+// local executable instead of an image.
+package process
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"service-io/internal/core/runtime"
+
+	"github.com/rs/zerolog"
+)
+
+// ContractSuffix names the optional file next to an adapter executable that
+// declares its contract, as a JSON object of io.scadable.adapter.* labels.
+const ContractSuffix = ".contract.json"
+
+// Options configures where adapters keep their state and their resource
+// limits.
+type Options struct {
+	// StateDir holds one directory per adapter with its config file.
+	StateDir string
+	// LogLines is the number of output lines kept per adapter.
+	LogLines int
+	// StopTimeout is how long an adapter has to exit after SIGTERM.
+	StopTimeout time.Duration
+	Limits      Limits
+}
+
+// Limits caps the resources of each adapter. Zero values mean unlimited.
+// Memory and CPU are enforced with a cgroup when CgroupParent is set and
+// writable, memory falls back to an address space rlimit, and open files are
+// always an rlimit. Limits are only enforced on Linux.
+type Limits struct {
+	MemoryBytes uint64
+	CPUs        float64 // cgroups only
+	OpenFiles   uint64
+	// CgroupParent is a cgroup v2 directory service-io may create child
+	// groups in, e.g. /sys/fs/cgroup/service-io.
+	CgroupParent string
+}
+
+func (o *Options) setDefaults() {
+	if o.StateDir == "" {
+		o.StateDir = filepath.Join(os.TempDir(), "service-io", "adapters")
+	}
+	if o.LogLines <= 0 {
+		o.LogLines = 1000
+	}
+	if o.StopTimeout <= 0 {
+		o.StopTimeout = 10 * time.Second
+	}
+}
+
+// Client runs adapters as child processes.
+type Client struct {
+	opts Options
+	lg   zerolog.Logger
+
+	mu        sync.Mutex
+	instances map[string]*instance // by name
+	subs      []chan runtime.Event
+}
+
+// New returns a Client. Adapters do not outlive service-io; they are
+// started again by RestartRunningDevices.
+func New(opts Options, lg zerolog.Logger) (*Client, error) {
+	opts.setDefaults()
+	if err := os.MkdirAll(opts.StateDir, 0o700); err != nil {
+		return nil, fmt.Errorf("create state dir: %w", err)
+	}
+	return &Client{
+		opts:      opts,
+		lg:        lg.With().Str("adapter", "process").Logger(),
+		instances: make(map[string]*instance),
+	}, nil
+}
+
+var _ runtime.Runtime = (*Client)(nil)
+
+// instance is one adapter process.
+type instance struct {
+	name string
+	spec runtime.AdapterSpec
+	exe  string
+	dir  string
+	logs *ringBuffer
+
+	mu       sync.Mutex
+	state    runtime.State
+	cmd      *exec.Cmd
+	cgroup   *cgroup
+	stopping bool
+
+	done chan struct{}
+}
+
+// Resolve checks that image names an executable and pins it to the hash of
+// its contents. The contract is read from the file named by ContractSuffix.
+func (c *Client) Resolve(ctx context.Context, image string, forcePull bool) (*runtime.ImageInfo, error) {
+	exe := executable(image)
+	sum, err := hashFile(exe)
+	if err != nil {
+		return nil, err
+	}
+
+	ct := &runtime.Contract{}
+	raw, err := os.ReadFile(exe + ContractSuffix)
+	switch {
+	case err == nil:
+		var labels map[string]string
+		if err := json.Unmarshal(raw, &labels); err != nil {
+			return nil, fmt.Errorf("%w: %s%s: %v", runtime.ErrInvalidContract, exe, ContractSuffix, err)
+		}
+		if ct, err = runtime.ParseContract(labels); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+	return &runtime.ImageInfo{Digest: exe + "@sha256:" + sum, Contract: *ct}, nil
+}
+
+// Run stops any adapter with the same name and starts a new one. It returns
+// once the process has been started; its exit is reported as a die event.
+func (c *Client) Run(ctx context.Context, spec runtime.AdapterSpec) (string, error) {
+	if err := c.Stop(ctx, spec.Name); err != nil {
+		return "", err
+	}
+
+	exe := executable(spec.Image)
+	if _, digest, ok := strings.Cut(spec.Image, "@sha256:"); ok {
+		if sum, err := hashFile(exe); err == nil && sum != digest {
+			c.lg.Warn().Str("executable", exe).Msg("adapter binary changed since it was resolved")
+		}
+	}
+
+	in := &instance{
+		name: spec.Name,
+		spec: spec,
+		exe:  exe,
+		dir:  filepath.Join(c.opts.StateDir, spec.Name),
+		logs: newRingBuffer(c.opts.LogLines),
+		done: make(chan struct{}),
+	}
+	if err := os.MkdirAll(in.dir, 0o700); err != nil {
+		return "", fmt.Errorf("create adapter dir: %w", err)
+	}
+	if spec.Config != nil {
+		raw, err := spec.ConfigJSON()
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(in.configFile(), raw, 0o600); err != nil {
+			return "", fmt.Errorf("write adapter config: %w", err)
+		}
+	}
+
+	cmd, err := c.start(in)
+	if err != nil {
+		_ = os.RemoveAll(in.dir)
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.instances[in.name] = in
+	c.mu.Unlock()
+	go c.supervise(in, cmd)
+	return in.name, nil
+}
+
+// Stop terminates an adapter, giving it StopTimeout to exit after SIGTERM,
+// and removes its state. A missing adapter is not an error.
+func (c *Client) Stop(ctx context.Context, ref string) error {
+	c.mu.Lock()
+	in := c.instances[ref]
+	delete(c.instances, ref)
+	c.mu.Unlock()
+	if in == nil {
+		return nil
+	}
+
+	c.lg.Info().Str("adapter", in.name).Msg("stopping adapter process")
+	in.mu.Lock()
+	in.stopping = true
+	if in.cmd != nil && in.cmd.Process != nil {
+		_ = in.cmd.Process.Signal(syscall.SIGTERM)
+	}
+	in.mu.Unlock()
+
+	select {
+	case <-in.done:
+	case <-time.After(c.opts.StopTimeout):
+		in.mu.Lock()
+		if in.cmd != nil && in.cmd.Process != nil {
+			_ = in.cmd.Process.Kill()
+		}
+		in.mu.Unlock()
+		<-in.done
+	}
+	c.emit(in, runtime.EventDestroy, 0)
+	return os.RemoveAll(in.dir)
+}
+
+// Inspect returns the state of an adapter, or (nil, nil) if there is none.
+func (c *Client) Inspect(ctx context.Context, ref string) (*runtime.State, error) {
+	in := c.find(ref)
+	if in == nil {
+		return nil, nil
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	st := in.state
+	return &st, nil
+}
+
+// List returns the adapters, including those that exited and were not
+// stopped yet.
+func (c *Client) List(ctx context.Context) ([]runtime.Instance, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]runtime.Instance, 0, len(c.instances))
+	for _, in := range c.instances {
+		in.mu.Lock()
+		out = append(out, runtime.Instance{
+			ID:       in.name,
+			Name:     in.name,
+			DeviceID: in.spec.DeviceID,
+			Running:  in.state.Running,
+			Labels:   in.spec.Labels,
+		})
+		in.mu.Unlock()
+	}
+	return out, nil
+}
+
+// Logs serves the adapter's output from its ring buffer.
+func (c *Client) Logs(ctx context.Context, ref string, opts runtime.LogOptions) (io.ReadCloser, error) {
+	in := c.find(ref)
+	if in == nil {
+		return nil, fmt.Errorf("no adapter process %s", ref)
+	}
+	return in.logs.reader(ctx, opts.Since, opts.Tail, opts.Follow), nil
+}
+
+// Stats samples the adapter process for about a second.
+func (c *Client) Stats(ctx context.Context, ref string) (*runtime.Stats, error) {
+	in := c.find(ref)
+	if in == nil {
+		return nil, fmt.Errorf("no adapter process %s", ref)
+	}
+	in.mu.Lock()
+	running, cmd := in.state.Running, in.cmd
+	in.mu.Unlock()
+	if !running || cmd == nil || cmd.Process == nil {
+		return nil, fmt.Errorf("adapter process %s is not running", ref)
+	}
+	s, err := processStats(ctx, cmd.Process.Pid)
+	if err != nil {
+		return nil, err
+	}
+	s.MemoryLimitBytes = c.opts.Limits.MemoryBytes
+	return s, nil
+}
+
+// Events streams start, die and destroy events of adapters until ctx is
+// done.
+func (c *Client) Events(ctx context.Context) (<-chan runtime.Event, error) {
+	ch := make(chan runtime.Event, 64)
+	c.mu.Lock()
+	c.subs = append(c.subs, ch)
+	c.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, sub := range c.subs {
+			if sub == ch {
+				c.subs = append(c.subs[:i], c.subs[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// start launches the adapter process.
+func (c *Client) start(in *instance) (*exec.Cmd, error) {
+	stdout := &lineWriter{buf: in.logs}
+	stderr := &lineWriter{buf: in.logs}
+	cmd := exec.Command(in.exe)
+	cmd.Dir = in.dir
+	cmd.Env = append(os.Environ(), in.spec.Env(in.configFile())...)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	cmd.SysProcAttr = sysProcAttr()
+
+	cg, err := newCgroup(c.opts.Limits, in.name)
+	if err != nil {
+		c.lg.Warn().Err(err).Str("adapter", in.name).Msg("cgroup unavailable, falling back to rlimits")
+	}
+	cg.attach(cmd)
+
+	if err := cmd.Start(); err != nil {
+		cg.remove()
+		return nil, fmt.Errorf("start adapter process: %w", err)
+	}
+	lim := c.opts.Limits
+	if cg != nil {
+		lim.MemoryBytes = 0 // enforced by the cgroup
+	}
+	if err := setRlimits(cmd.Process.Pid, lim); err != nil {
+		c.lg.Warn().Err(err).Str("adapter", in.name).Msg("failed to apply resource limits")
+	}
+
+	in.mu.Lock()
+	in.cmd, in.cgroup = cmd, cg
+	in.state.Status = "running"
+	in.state.Running = true
+	in.state.ExitCode = 0
+	in.state.StartedAt = time.Now().UTC()
+	in.mu.Unlock()
+	c.emit(in, runtime.EventStart, 0)
+	return cmd, nil
+}
+
+// supervise waits for the adapter to exit and records how it did. Exited
+// adapters are not restarted here; as with the other runtimes, the manager
+// does, following the restart policy of the adapter's type.
+func (c *Client) supervise(in *instance, cmd *exec.Cmd) {
+	defer close(in.done)
+	code := exitCode(cmd.Wait())
+	cmd.Stdout.(*lineWriter).flush()
+	cmd.Stderr.(*lineWriter).flush()
+
+	in.mu.Lock()
+	in.cgroup.remove()
+	in.state.Status = "exited"
+	in.state.Running = false
+	in.state.ExitCode = code
+	in.state.FinishedAt = time.Now().UTC()
+	stopping := in.stopping
+	in.mu.Unlock()
+	if !stopping {
+		c.lg.Warn().Str("adapter", in.name).Int("exit_code", code).Msg("adapter process exited")
+	}
+	c.emit(in, runtime.EventDie, code)
+}
+
+func (c *Client) find(ref string) *instance {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.instances[ref]
+}
+
+func (c *Client) emit(in *instance, action string, exitCode int) {
+	ev := runtime.Event{
+		ID:       in.name,
+		Name:     in.name,
+		DeviceID: in.spec.DeviceID,
+		Action:   action,
+		ExitCode: exitCode,
+		Time:     time.Now().UTC(),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, sub := range c.subs {
+		select {
+		case sub <- ev:
+		default:
+		}
+	}
+}
+
+func (in *instance) configFile() string {
+	return filepath.Join(in.dir, "adapter-config.json")
+}
+
+// executable strips the digest from a pinned reference.
+func executable(image string) string {
+	exe, _, _ := strings.Cut(image, "@")
+	return exe
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("adapter executable: %w", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fi.IsDir() || fi.Mode().Perm()&0o111 == 0 {
+		return "", fmt.Errorf("adapter executable: %s is not executable", path)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// exitCode returns the process exit code, or 128+signal like a shell when
+// it was killed.
+func exitCode(err error) int {
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) {
+		if err != nil {
+			return -1
+		}
+		return 0
+	}
+	if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ee.ExitCode()
+}
@@ -0,0 +1,336 @@
+package process
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"service-io/internal/core/runtime"
+
+	"github.com/rs/zerolog"
+)
+
+// script writes an executable /bin/sh script running body and returns its
+// path.
+func script(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "adapter")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	return path
+}
+
+func newTestClient(t *testing.T, opts Options) *Client {
+	t.Helper()
+	opts.StateDir = t.TempDir()
+	c, err := New(opts, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	return c
+}
+
+// events subscribes to the client's events for the rest of the test.
+func events(t *testing.T, c *Client) <-chan runtime.Event {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ch, err := c.Events(ctx)
+	if err != nil {
+		t.Fatalf("events: %v", err)
+	}
+	return ch
+}
+
+func nextEvent(t *testing.T, ch <-chan runtime.Event) runtime.Event {
+	t.Helper()
+	select {
+	case ev := <-ch:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return runtime.Event{}
+}
+
+func readLogs(t *testing.T, c *Client, ref string, opts runtime.LogOptions) string {
+	t.Helper()
+	rc, err := c.Logs(context.Background(), ref, opts)
+	if err != nil {
+		t.Fatalf("logs: %v", err)
+	}
+	defer rc.Close()
+	raw, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("read logs: %v", err)
+	}
+	return string(raw)
+}
+
+// waitForLog waits until an adapter printed line, e.g. once it set up its
+// signal handling.
+func waitForLog(t *testing.T, c *Client, ref, line string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(readLogs(t, c, ref, runtime.LogOptions{}), line+"\n") {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %q", line)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRunUntilExit(t *testing.T) {
+	c := newTestClient(t, Options{})
+	evs := events(t, c)
+	exe := script(t, `echo "device $DEVICE_ID"
+echo "broker $ADAPTER_CFG_BROKER" >&2
+cat "$ADAPTER_CONFIG_FILE" >/dev/null || exit 9
+printf partial
+exit 3`)
+
+	id, err := c.Run(context.Background(), runtime.AdapterSpec{
+		Name: "adapter-dev1", DeviceID: "dev1", Image: exe,
+		Config: map[string]any{"broker": "tcp://plc:1883"}, ConfigVersion: 1,
+	})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if ev := nextEvent(t, evs); ev.Action != runtime.EventStart || ev.DeviceID != "dev1" {
+		t.Fatalf("event = %+v, want the start of dev1", ev)
+	}
+	if ev := nextEvent(t, evs); ev.Action != runtime.EventDie || ev.ExitCode != 3 {
+		t.Fatalf("event = %+v, want a die with exit code 3", ev)
+	}
+
+	st, err := c.Inspect(context.Background(), id)
+	if err != nil || st == nil {
+		t.Fatalf("inspect = %v, %v", st, err)
+	}
+	if st.Running || st.Status != "exited" || st.ExitCode != 3 || st.FinishedAt.Before(st.StartedAt) {
+		t.Errorf("state = %+v, want exited with code 3", st)
+	}
+	// Exited adapters are listed until they are stopped.
+	list, err := c.List(context.Background())
+	if err != nil || len(list) != 1 || list[0].DeviceID != "dev1" || list[0].Running {
+		t.Errorf("list = %+v, %v, want the exited adapter", list, err)
+	}
+
+	// Stdout and stderr are copied concurrently, so only the trailing
+	// partial line has a fixed place.
+	lines := strings.Split(readLogs(t, c, id, runtime.LogOptions{}), "\n")
+	slices.Sort(lines[:2])
+	if want := []string{"broker tcp://plc:1883", "device dev1", "partial", ""}; !slices.Equal(lines, want) {
+		t.Errorf("logs = %q, want %q", lines, want)
+	}
+	if got := readLogs(t, c, id, runtime.LogOptions{Tail: 1}); got != "partial\n" {
+		t.Errorf("tail = %q, want the last line", got)
+	}
+
+	if err := c.Stop(context.Background(), id); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if ev := nextEvent(t, evs); ev.Action != runtime.EventDestroy {
+		t.Errorf("event = %+v, want a destroy", ev)
+	}
+	if st, err := c.Inspect(context.Background(), id); err != nil || st != nil {
+		t.Errorf("inspect after stop = %+v, %v, want nothing", st, err)
+	}
+	if _, err := os.Stat(filepath.Join(c.opts.StateDir, id)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("state dir left behind: %v", err)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"success", "exit 0", 0},
+		{"failure", "exit 42", 42},
+		{"killed", "kill -KILL $$", 128 + 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, Options{})
+			evs := events(t, c)
+			if _, err := c.Run(context.Background(), runtime.AdapterSpec{Name: "adapter", Image: script(t, tt.body)}); err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			nextEvent(t, evs) // start
+			if ev := nextEvent(t, evs); ev.Action != runtime.EventDie || ev.ExitCode != tt.want {
+				t.Errorf("event = %+v, want a die with exit code %d", ev, tt.want)
+			}
+		})
+	}
+}
+
+func TestStop(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		// SIGTERM ends a well-behaved adapter.
+		{"terminated", "echo ready\nexec sleep 30", 128 + 15},
+		// One ignoring it is killed after StopTimeout.
+		{"killed", "trap '' TERM\necho ready\nwhile :; do sleep 0.1; done", 128 + 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, Options{StopTimeout: 200 * time.Millisecond})
+			evs := events(t, c)
+			id, err := c.Run(context.Background(), runtime.AdapterSpec{Name: "adapter", Image: script(t, tt.body)})
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			nextEvent(t, evs) // start
+			waitForLog(t, c, id, "ready")
+			if st, err := c.Inspect(context.Background(), id); err != nil || st == nil || !st.Running {
+				t.Fatalf("inspect = %+v, %v, want running", st, err)
+			}
+
+			if err := c.Stop(context.Background(), id); err != nil {
+				t.Fatalf("stop: %v", err)
+			}
+			if ev := nextEvent(t, evs); ev.Action != runtime.EventDie || ev.ExitCode != tt.want {
+				t.Errorf("event = %+v, want a die with exit code %d", ev, tt.want)
+			}
+			if ev := nextEvent(t, evs); ev.Action != runtime.EventDestroy {
+				t.Errorf("event = %+v, want a destroy", ev)
+			}
+			// Stopping again, or an unknown adapter, is not an error.
+			if err := c.Stop(context.Background(), id); err != nil {
+				t.Errorf("stop again: %v", err)
+			}
+		})
+	}
+}
+
+func TestRunReplacesAdapter(t *testing.T) {
+	c := newTestClient(t, Options{StopTimeout: time.Second})
+	evs := events(t, c)
+	spec := runtime.AdapterSpec{Name: "adapter", Image: script(t, "exec sleep 30")}
+	if _, err := c.Run(context.Background(), spec); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	nextEvent(t, evs) // start
+	if _, err := c.Run(context.Background(), spec); err != nil {
+		t.Fatalf("run again: %v", err)
+	}
+	for _, want := range []string{runtime.EventDie, runtime.EventDestroy, runtime.EventStart} {
+		if ev := nextEvent(t, evs); ev.Action != want {
+			t.Errorf("event = %s, want %s", ev.Action, want)
+		}
+	}
+	list, err := c.List(context.Background())
+	if err != nil || len(list) != 1 || !list[0].Running {
+		t.Errorf("list = %+v, %v, want one running adapter", list, err)
+	}
+	if err := c.Stop(context.Background(), "adapter"); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+}
+
+func TestFollowLogs(t *testing.T) {
+	c := newTestClient(t, Options{})
+	id, err := c.Run(context.Background(), runtime.AdapterSpec{
+		Name:  "adapter",
+		Image: script(t, "echo one\nsleep 0.2\necho two\nexec sleep 30"),
+	})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	defer c.Stop(context.Background(), id)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rc, err := c.Logs(ctx, id, runtime.LogOptions{Follow: true})
+	if err != nil {
+		t.Fatalf("logs: %v", err)
+	}
+	defer rc.Close()
+	sc := bufio.NewScanner(rc)
+	var got []string
+	for len(got) < 2 && sc.Scan() {
+		got = append(got, sc.Text())
+	}
+	if strings.Join(got, ",") != "one,two" {
+		t.Errorf("followed %q, want one and two", got)
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	b := newRingBuffer(3)
+	w := &lineWriter{buf: b}
+	start := time.Now().UTC()
+	w.Write([]byte("a\nb\nc"))
+	w.Write([]byte("d\ne\n"))
+	w.Write([]byte("f"))
+	w.flush()
+
+	tests := []struct {
+		name  string
+		since time.Time
+		tail  int
+		want  string
+	}{
+		{"last lines kept", time.Time{}, 0, "cd\ne\nf\n"},
+		{"tail", time.Time{}, 2, "e\nf\n"},
+		{"tail beyond buffer", time.Time{}, 10, "cd\ne\nf\n"},
+		{"since", time.Now().UTC(), 0, ""},
+		{"since start", start.Add(-time.Second), 1, "f\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got strings.Builder
+			for _, l := range b.snapshot(tt.since, tt.tail) {
+				got.Write(l.text)
+			}
+			if got.String() != tt.want {
+				t.Errorf("snapshot = %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	c := newTestClient(t, Options{})
+	exe := script(t, "exit 0")
+	contract := `{"io.scadable.adapter.port": "5020", "io.scadable.adapter.protocol": "modbus"}`
+	if err := os.WriteFile(exe+ContractSuffix, []byte(contract), 0o644); err != nil {
+		t.Fatalf("write contract: %v", err)
+	}
+
+	info, err := c.Resolve(context.Background(), exe, false)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if !strings.HasPrefix(info.Digest, exe+"@sha256:") {
+		t.Errorf("digest = %s, want %s pinned by hash", info.Digest, exe)
+	}
+	if ct := info.Contract; ct.Port != 5020 || ct.Protocol != "modbus" {
+		t.Errorf("contract = %+v, want port 5020 speaking modbus", ct)
+	}
+	// A pinned reference runs the executable itself.
+	if again, err := c.Resolve(context.Background(), info.Digest, false); err != nil || again.Digest != info.Digest {
+		t.Errorf("resolve pinned = %+v, %v, want the same digest", again, err)
+	}
+
+	plain := filepath.Join(t.TempDir(), "adapter")
+	if err := os.WriteFile(plain, []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if _, err := c.Resolve(context.Background(), plain, false); err == nil {
+		t.Errorf("resolved a file that is not executable")
+	}
+}
@@ -0,0 +1,157 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// logLine is one line of adapter output.
+type logLine struct {
+	seq  uint64
+	time time.Time
+	text []byte // including the trailing newline
+}
+
+// ringBuffer keeps the last lines written by an adapter's stdout and
+// stderr, and hands new lines to followers.
+type ringBuffer struct {
+	mu    sync.Mutex
+	lines []logLine
+	next  int // index of the oldest line once the buffer is full
+	full  bool
+	seq   uint64
+	subs  map[chan logLine]struct{}
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{lines: make([]logLine, size), subs: make(map[chan logLine]struct{})}
+}
+
+func (b *ringBuffer) add(l logLine) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	l.seq = b.seq
+	b.lines[b.next] = l
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- l:
+		default: // a slow follower misses lines rather than blocking the adapter
+		}
+	}
+}
+
+// snapshot returns the buffered lines, oldest first, after since and
+// limited to the last tail lines when tail > 0.
+func (b *ringBuffer) snapshot(since time.Time, tail int) []logLine {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var all []logLine
+	if b.full {
+		all = append(all, b.lines[b.next:]...)
+	}
+	all = append(all, b.lines[:b.next]...)
+
+	out := all[:0:0]
+	for _, l := range all {
+		if l.time.After(since) {
+			out = append(out, l)
+		}
+	}
+	if tail > 0 && len(out) > tail {
+		out = out[len(out)-tail:]
+	}
+	return out
+}
+
+func (b *ringBuffer) subscribe() (chan logLine, func()) {
+	ch := make(chan logLine, 64)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
+
+// reader returns the selected lines, and with follow keeps streaming new
+// ones until ctx is done or the reader is closed.
+func (b *ringBuffer) reader(ctx context.Context, since time.Time, tail int, follow bool) io.ReadCloser {
+	var buf bytes.Buffer
+	if !follow {
+		for _, l := range b.snapshot(since, tail) {
+			buf.Write(l.text)
+		}
+		return io.NopCloser(&buf)
+	}
+
+	// Subscribe first so no line falls between the snapshot and the stream.
+	ch, unsubscribe := b.subscribe()
+	lines := b.snapshot(since, tail)
+	pr, pw := io.Pipe()
+	go func() {
+		defer unsubscribe()
+		var last uint64
+		for _, l := range lines {
+			if _, err := pw.Write(l.text); err != nil {
+				return
+			}
+			last = l.seq
+		}
+		for {
+			select {
+			case l := <-ch:
+				if l.seq <= last {
+					continue // already sent with the snapshot
+				}
+				if _, err := pw.Write(l.text); err != nil {
+					return
+				}
+			case <-ctx.Done():
+				pw.CloseWithError(ctx.Err())
+				return
+			}
+		}
+	}()
+	return pr
+}
+
+// lineWriter splits a stream into lines for a ringBuffer. Each stream needs
+// its own lineWriter.
+type lineWriter struct {
+	buf     *ringBuffer
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.partial = append(w.partial, p...)
+			break
+		}
+		line := append(w.partial, p[:i+1]...)
+		w.partial = nil
+		w.buf.add(logLine{time: time.Now().UTC(), text: line})
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// flush stores a trailing line without newline, e.g. when the process exits.
+func (w *lineWriter) flush() {
+	if len(w.partial) > 0 {
+		w.buf.add(logLine{time: time.Now().UTC(), text: append(w.partial, '\n')})
+		w.partial = nil
+	}
+}
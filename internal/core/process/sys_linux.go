@@ -0,0 +1,177 @@
+//go:build linux
+
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"service-io/internal/core/runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// clockTicks is USER_HZ, the unit of CPU times in /proc. It is 100 on all
+// mainstream architectures.
+const clockTicks = 100
+
+func sysProcAttr() *syscall.SysProcAttr {
+	// Adapters must not outlive service-io, and get their own process group
+	// so terminal signals reach service-io only.
+	return &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM, Setpgid: true}
+}
+
+// cgroup is a cgroup v2 group holding one adapter process.
+type cgroup struct {
+	dir string
+	fd  *os.File
+}
+
+// newCgroup creates a group under l.CgroupParent with the configured limits.
+// It returns (nil, nil) when no cgroup is configured.
+func newCgroup(l Limits, name string) (*cgroup, error) {
+	if l.CgroupParent == "" {
+		return nil, nil
+	}
+	dir := filepath.Join(l.CgroupParent, name)
+	if err := os.Mkdir(dir, 0o755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	cg := &cgroup{dir: dir}
+	if l.MemoryBytes > 0 {
+		if err := cg.write("memory.max", strconv.FormatUint(l.MemoryBytes, 10)); err != nil {
+			cg.remove()
+			return nil, err
+		}
+	}
+	if l.CPUs > 0 {
+		const period = 100000
+		quota := int(l.CPUs * period)
+		if err := cg.write("cpu.max", fmt.Sprintf("%d %d", quota, period)); err != nil {
+			cg.remove()
+			return nil, err
+		}
+	}
+	fd, err := os.Open(dir)
+	if err != nil {
+		cg.remove()
+		return nil, err
+	}
+	cg.fd = fd
+	return cg, nil
+}
+
+func (cg *cgroup) write(file, value string) error {
+	return os.WriteFile(filepath.Join(cg.dir, file), []byte(value), 0o644)
+}
+
+// attach makes cmd start inside the group.
+func (cg *cgroup) attach(cmd *exec.Cmd) {
+	if cg == nil || cg.fd == nil {
+		return
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(cg.fd.Fd())
+}
+
+// remove deletes the group once its process has exited.
+func (cg *cgroup) remove() {
+	if cg == nil {
+		return
+	}
+	if cg.fd != nil {
+		cg.fd.Close()
+	}
+	_ = os.Remove(cg.dir)
+}
+
+// setRlimits applies l to a started process. The process runs briefly
+// without them; the cgroup memory limit avoids that window.
+func setRlimits(pid int, l Limits) error {
+	if l.MemoryBytes > 0 {
+		lim := &unix.Rlimit{Cur: l.MemoryBytes, Max: l.MemoryBytes}
+		if err := unix.Prlimit(pid, unix.RLIMIT_AS, lim, nil); err != nil {
+			return fmt.Errorf("memory rlimit: %w", err)
+		}
+	}
+	if l.OpenFiles > 0 {
+		lim := &unix.Rlimit{Cur: l.OpenFiles, Max: l.OpenFiles}
+		if err := unix.Prlimit(pid, unix.RLIMIT_NOFILE, lim, nil); err != nil {
+			return fmt.Errorf("open files rlimit: %w", err)
+		}
+	}
+	return nil
+}
+
+// processStats reads /proc twice, a second apart, to compute CPU usage.
+func processStats(ctx context.Context, pid int) (*runtime.Stats, error) {
+	t0 := time.Now()
+	cpu0, err := cpuTicks(pid)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-time.After(time.Second):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	cpu1, err := cpuTicks(pid)
+	if err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(t0).Seconds()
+
+	s := &runtime.Stats{
+		CPUPercent: float64(cpu1-cpu0) / clockTicks / elapsed * 100,
+		Time:       time.Now().UTC(),
+	}
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil, err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(status))
+	for sc.Scan() {
+		key, val, _ := strings.Cut(sc.Text(), ":")
+		fields := strings.Fields(val)
+		if len(fields) == 0 {
+			continue
+		}
+		n, _ := strconv.ParseUint(fields[0], 10, 64)
+		switch key {
+		case "VmRSS":
+			s.MemoryBytes = n * 1024 // reported in kB
+		case "Threads":
+			s.PIDs = n
+		}
+	}
+	return s, nil
+}
+
+// cpuTicks returns the user plus system time of a process.
+func cpuTicks(pid int) (uint64, error) {
+	raw, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// The command name may contain spaces; fields are counted after it.
+	i := bytes.LastIndexByte(raw, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(raw[i+1:]))
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	return utime + stime, nil
+}
@@ -0,0 +1,35 @@
+//go:build !linux
+
+package process
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"syscall"
+
+	"service-io/internal/core/runtime"
+)
+
+func sysProcAttr() *syscall.SysProcAttr { return nil }
+
+// cgroup is unavailable outside Linux.
+type cgroup struct{}
+
+func newCgroup(l Limits, name string) (*cgroup, error) {
+	if l.CgroupParent != "" {
+		return nil, fmt.Errorf("cgroups: %w", runtime.ErrNotSupported)
+	}
+	return nil, nil
+}
+
+func (cg *cgroup) attach(cmd *exec.Cmd) {}
+
+func (cg *cgroup) remove() {}
+
+// setRlimits is a no-op: limits are only enforced on Linux.
+func setRlimits(pid int, l Limits) error { return nil }
+
+func processStats(ctx context.Context, pid int) (*runtime.Stats, error) {
+	return nil, fmt.Errorf("process stats: %w", runtime.ErrNotSupported)
+}
@@ -0,0 +1,48 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Image labels through which an adapter image declares its contract.
+const (
+	LabelAdapterPort         = "io.scadable.adapter.port"
+	LabelAdapterProtocol     = "io.scadable.adapter.protocol"
+	LabelAdapterTLS          = "io.scadable.adapter.tls"
+	LabelAdapterConfigSchema = "io.scadable.adapter.config-schema"
+	LabelMinServiceVersion   = "io.scadable.adapter.min-service-io-version"
+)
+
+// ParseContract reads an adapter contract from image labels.
+func ParseContract(labels map[string]string) (*Contract, error) {
+	ct := &Contract{}
+	if v, ok := labels[LabelAdapterPort]; ok {
+		port, err := strconv.Atoi(v)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("%w: label %s: invalid port %q", ErrInvalidContract, LabelAdapterPort, v)
+		}
+		ct.Declared, ct.Port = true, port
+	}
+	if v, ok := labels[LabelAdapterProtocol]; ok {
+		ct.Declared, ct.Protocol = true, v
+	}
+	if v, ok := labels[LabelAdapterTLS]; ok {
+		tls, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: label %s: invalid bool %q", ErrInvalidContract, LabelAdapterTLS, v)
+		}
+		ct.Declared, ct.TLS = true, tls
+	}
+	if v, ok := labels[LabelAdapterConfigSchema]; ok {
+		if !json.Valid([]byte(v)) {
+			return nil, fmt.Errorf("%w: label %s: not valid JSON", ErrInvalidContract, LabelAdapterConfigSchema)
+		}
+		ct.Declared, ct.ConfigSchema = true, []byte(v)
+	}
+	if v, ok := labels[LabelMinServiceVersion]; ok {
+		ct.Declared, ct.MinServiceVersion = true, v
+	}
+	return ct, nil
+}
@@ -0,0 +1,82 @@
+package runtime
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Env returns the environment contract shared by all adapters. configFile is
+// where the runtime placed the config file; it is ignored without a config.
+func (s AdapterSpec) Env(configFile string) []string {
+	env := []string{
+		"NATS_URL=" + s.NATSURL,
+		"DEVICE_ID=" + s.DeviceID,
+		"NATS_SUBJECT=" + s.NATSSubject,
+		"ENABLE_JETSTREAM=true",
+	}
+
+	// Add MQTT credentials if provided.
+	if s.MQTTUser != "" && s.MQTTPassword != "" {
+		env = append(env, "MQTT_USER="+s.MQTTUser, "MQTT_PASSWORD="+s.MQTTPassword)
+	}
+
+	if s.Config != nil {
+		env = append(env,
+			"ADAPTER_CONFIG_FILE="+configFile,
+			"ADAPTER_CONFIG_VERSION="+strconv.Itoa(s.ConfigVersion))
+		env = append(env, configEnv(s.Config)...)
+	}
+	return env
+}
+
+// ConfigJSON returns the config file contents.
+func (s AdapterSpec) ConfigJSON() ([]byte, error) {
+	return json.MarshalIndent(s.Config, "", "  ")
+}
+
+// configEnv exports the top-level scalar values of an adapter config as
+// ADAPTER_CFG_<KEY> variables. Nested objects and arrays are only available
+// through the config file.
+func configEnv(cfg map[string]any) []string {
+	keys := make([]string, 0, len(cfg))
+	for k := range cfg {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var env []string
+	for _, k := range keys {
+		var val string
+		switch v := cfg[k].(type) {
+		case string:
+			val = v
+		case bool:
+			val = strconv.FormatBool(v)
+		case float64:
+			val = strconv.FormatFloat(v, 'f', -1, 64)
+		case json.Number:
+			val = v.String()
+		default:
+			continue
+		}
+		env = append(env, "ADAPTER_CFG_"+envKey(k)+"="+val)
+	}
+	return env
+}
+
+// envKey upper-cases a config key and replaces anything that is not a
+// letter or digit with an underscore.
+func envKey(k string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, k)
+}
@@ -0,0 +1,437 @@
+// Package fake provides an in-memory runtime.Runtime for tests. It never
+// runs anything; instances only exist as state that tests can inspect and
+// manipulate, e.g. to simulate crashes and slow starts.
+package fake
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"service-io/internal/core/runtime"
+)
+
+// ErrNotFound is returned for operations on instances that do not exist.
+var ErrNotFound = errors.New("fake runtime: no such instance")
+
+// eventBuffer is the capacity of each Events channel. Events are dropped for
+// subscribers that fall this far behind.
+const eventBuffer = 256
+
+// Instance is a snapshot of an adapter instance held by the fake runtime.
+type Instance struct {
+	ID    string
+	Spec  runtime.AdapterSpec
+	State runtime.State
+}
+
+type instance struct {
+	Instance
+	logs  bytes.Buffer
+	stats runtime.Stats
+}
+
+// Runtime is an in-memory runtime.Runtime. The zero value is not usable;
+// create one with New. All methods are safe for concurrent use.
+type Runtime struct {
+	mu         sync.Mutex
+	seq        int
+	images     map[string]runtime.ImageInfo
+	resolveErr map[string]error
+	runErr     map[string]error
+	crashCode  map[string]int
+	startDelay time.Duration
+	instances  map[string]*instance // by ID
+	pulls      map[string]int
+	subs       []chan runtime.Event
+}
+
+// New returns an empty fake runtime. Images are resolved on first use with
+// an empty contract unless registered with SetImage.
+func New() *Runtime {
+	return &Runtime{
+		images:     make(map[string]runtime.ImageInfo),
+		resolveErr: make(map[string]error),
+		runErr:     make(map[string]error),
+		crashCode:  make(map[string]int),
+		instances:  make(map[string]*instance),
+		pulls:      make(map[string]int),
+	}
+}
+
+var _ runtime.Runtime = (*Runtime)(nil)
+
+// SetImage registers the digest and contract Resolve returns for image. An
+// empty digest is filled in.
+func (r *Runtime) SetImage(image string, info runtime.ImageInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if info.Digest == "" {
+		info.Digest = digestOf(image)
+	}
+	r.images[image] = info
+}
+
+// FailResolve makes Resolve fail for image with err; a nil err clears it.
+func (r *Runtime) FailResolve(image string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	setOrClear(r.resolveErr, image, err)
+}
+
+// FailRun makes Run fail with err for image, given with or without its
+// digest; a nil err clears it.
+func (r *Runtime) FailRun(image string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	setOrClear(r.runErr, repoOf(image), err)
+}
+
+// CrashOnStart makes instances of image exit with exitCode right after Run
+// returns, the way an adapter with a broken config would. A negative
+// exitCode clears it.
+func (r *Runtime) CrashOnStart(image string, exitCode int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if exitCode < 0 {
+		delete(r.crashCode, repoOf(image))
+		return
+	}
+	r.crashCode[repoOf(image)] = exitCode
+}
+
+// SetStartDelay makes every Run block for d, or until its context is done.
+func (r *Runtime) SetStartDelay(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.startDelay = d
+}
+
+// Crash stops a running instance with exitCode, as if the process died.
+func (r *Runtime) Crash(ref string, exitCode int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	in := r.find(ref)
+	if in == nil {
+		return fmt.Errorf("%w: %s", ErrNotFound, ref)
+	}
+	r.exit(in, exitCode)
+	return nil
+}
+
+// Restart starts a stopped instance again and counts the restart, as an
+// engine restart policy would.
+func (r *Runtime) Restart(ref string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	in := r.find(ref)
+	if in == nil {
+		return fmt.Errorf("%w: %s", ErrNotFound, ref)
+	}
+	in.State.RestartCount++
+	r.start(in)
+	r.emit(in, runtime.EventRestart, 0)
+	return nil
+}
+
+// WriteLog appends output to an instance's logs.
+func (r *Runtime) WriteLog(ref, output string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	in := r.find(ref)
+	if in == nil {
+		return fmt.Errorf("%w: %s", ErrNotFound, ref)
+	}
+	in.logs.WriteString(output)
+	return nil
+}
+
+// SetStats sets the sample Stats returns for an instance.
+func (r *Runtime) SetStats(ref string, s runtime.Stats) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	in := r.find(ref)
+	if in == nil {
+		return fmt.Errorf("%w: %s", ErrNotFound, ref)
+	}
+	in.stats = s
+	return nil
+}
+
+// Instances returns all instances, sorted by name.
+func (r *Runtime) Instances() []Instance {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Instance, 0, len(r.instances))
+	for _, in := range r.instances {
+		out = append(out, in.Instance)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Spec.Name < out[j].Spec.Name })
+	return out
+}
+
+// Instance returns a snapshot of the instance addressed by ref.
+func (r *Runtime) Instance(ref string) (Instance, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	in := r.find(ref)
+	if in == nil {
+		return Instance{}, false
+	}
+	return in.Instance, true
+}
+
+// Pulls returns how often image has been pulled.
+func (r *Runtime) Pulls(image string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pulls[image]
+}
+
+// Resolve implements runtime.Runtime.
+func (r *Runtime) Resolve(ctx context.Context, image string, forcePull bool) (*runtime.ImageInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.resolveErr[image]; err != nil {
+		return nil, err
+	}
+	info, ok := r.images[image]
+	if !ok || forcePull {
+		r.pulls[image]++
+	}
+	if !ok {
+		info = runtime.ImageInfo{Digest: digestOf(image)}
+		r.images[image] = info
+	}
+	return &info, nil
+}
+
+// Run implements runtime.Runtime.
+func (r *Runtime) Run(ctx context.Context, spec runtime.AdapterSpec) (string, error) {
+	r.mu.Lock()
+	delay := r.startDelay
+	r.mu.Unlock()
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old := r.find(spec.Name); old != nil {
+		r.remove(old)
+	}
+	if err := r.runErr[repoOf(spec.Image)]; err != nil {
+		return "", err
+	}
+
+	r.seq++
+	in := &instance{Instance: Instance{
+		ID:   fmt.Sprintf("fake-%012d", r.seq),
+		Spec: spec,
+	}}
+	r.instances[in.ID] = in
+	r.start(in)
+	if code, ok := r.crashCode[repoOf(spec.Image)]; ok {
+		r.exit(in, code)
+	}
+	return in.ID, nil
+}
+
+// Stop implements runtime.Runtime.
+func (r *Runtime) Stop(ctx context.Context, ref string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if in := r.find(ref); in != nil {
+		r.remove(in)
+	}
+	return nil
+}
+
+// Inspect implements runtime.Runtime.
+func (r *Runtime) Inspect(ctx context.Context, ref string) (*runtime.State, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	in := r.find(ref)
+	if in == nil {
+		return nil, nil
+	}
+	st := in.State
+	return &st, nil
+}
+
+// List implements runtime.Runtime. Instances are sorted by name.
+func (r *Runtime) List(ctx context.Context) ([]runtime.Instance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]runtime.Instance, 0, len(r.instances))
+	for _, in := range r.instances {
+		out = append(out, runtime.Instance{
+			ID:       in.ID,
+			Name:     in.Spec.Name,
+			DeviceID: in.Spec.DeviceID,
+			Running:  in.State.Running,
+			Labels:   in.Spec.Labels,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Logs implements runtime.Runtime. Follow is ignored; the logs written so
+// far are returned.
+func (r *Runtime) Logs(ctx context.Context, ref string, opts runtime.LogOptions) (io.ReadCloser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	in := r.find(ref)
+	if in == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, ref)
+	}
+	logs := in.logs.String()
+	if opts.Tail > 0 {
+		lines := strings.SplitAfter(logs, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		if len(lines) > opts.Tail {
+			lines = lines[len(lines)-opts.Tail:]
+		}
+		logs = strings.Join(lines, "")
+	}
+	return io.NopCloser(strings.NewReader(logs)), nil
+}
+
+// Stats implements runtime.Runtime.
+func (r *Runtime) Stats(ctx context.Context, ref string) (*runtime.Stats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	in := r.find(ref)
+	if in == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, ref)
+	}
+	s := in.stats
+	if s.Time.IsZero() {
+		s.Time = time.Now().UTC()
+	}
+	return &s, nil
+}
+
+// Events implements runtime.Runtime.
+func (r *Runtime) Events(ctx context.Context) (<-chan runtime.Event, error) {
+	ch := make(chan runtime.Event, eventBuffer)
+	r.mu.Lock()
+	r.subs = append(r.subs, ch)
+	r.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for i, sub := range r.subs {
+			if sub == ch {
+				r.subs = append(r.subs[:i], r.subs[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// find returns the instance with the given ID or name. r.mu must be held.
+func (r *Runtime) find(ref string) *instance {
+	if in, ok := r.instances[ref]; ok {
+		return in
+	}
+	for _, in := range r.instances {
+		if in.Spec.Name == ref {
+			return in
+		}
+	}
+	return nil
+}
+
+func (r *Runtime) start(in *instance) {
+	in.State.Status = "running"
+	in.State.Running = true
+	in.State.ExitCode = 0
+	in.State.StartedAt = time.Now().UTC()
+	r.emit(in, runtime.EventStart, 0)
+}
+
+func (r *Runtime) exit(in *instance, code int) {
+	if !in.State.Running {
+		return
+	}
+	in.State.Status = "exited"
+	in.State.Running = false
+	in.State.ExitCode = code
+	in.State.FinishedAt = time.Now().UTC()
+	r.emit(in, runtime.EventDie, code)
+}
+
+func (r *Runtime) remove(in *instance) {
+	r.exit(in, 137)
+	delete(r.instances, in.ID)
+	r.emit(in, runtime.EventDestroy, 0)
+}
+
+// emit delivers an event to all subscribers. r.mu must be held.
+func (r *Runtime) emit(in *instance, action string, exitCode int) {
+	ev := runtime.Event{
+		ID:       in.ID,
+		Name:     in.Spec.Name,
+		DeviceID: in.Spec.DeviceID,
+		Action:   action,
+		ExitCode: exitCode,
+		Time:     time.Now().UTC(),
+	}
+	for _, sub := range r.subs {
+		select {
+		case sub <- ev:
+		default:
+		}
+	}
+}
+
+func setOrClear(m map[string]error, key string, err error) {
+	if err == nil {
+		delete(m, key)
+		return
+	}
+	m[key] = err
+}
+
+// digestOf returns a stable fake digest for image. References that are
+// already pinned are returned unchanged.
+func digestOf(image string) string {
+	if strings.Contains(image, "@") {
+		return image
+	}
+	sum := sha256.Sum256([]byte(image))
+	return repoOf(image) + "@sha256:" + hex.EncodeToString(sum[:])
+}
+
+// repoOf strips the digest from an image reference.
+func repoOf(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i]
+	}
+	return image
+}
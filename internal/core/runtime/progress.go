@@ -0,0 +1,31 @@
+package runtime
+
+import "context"
+
+// PullProgress is how far an image pull got, summed over its layers.
+type PullProgress struct {
+	Image string `json:"image" example:"registry.digitalocean.com/scadable-container-registry/adapter-mqtt:latest"`
+	// Status is the latest status line of the pull, e.g. "Downloading".
+	Status     string `json:"status" example:"Downloading"`
+	Layers     int    `json:"layers" example:"6"`
+	LayersDone int    `json:"layers_done" example:"4"`
+	// Current and Total are bytes downloaded so far and the size of the
+	// layers whose size is known yet.
+	Current int64 `json:"current_bytes" example:"31457280"`
+	Total   int64 `json:"total_bytes" example:"52428800"`
+}
+
+type pullProgressKey struct{}
+
+// WithPullProgress returns a context under which runtimes report the
+// progress of image pulls to fn. Runtimes that cannot report progress
+// ignore it.
+func WithPullProgress(ctx context.Context, fn func(PullProgress)) context.Context {
+	return context.WithValue(ctx, pullProgressKey{}, fn)
+}
+
+// PullProgressFunc returns the progress callback set on ctx, or nil.
+func PullProgressFunc(ctx context.Context) func(PullProgress) {
+	fn, _ := ctx.Value(pullProgressKey{}).(func(PullProgress))
+	return fn
+}
@@ -0,0 +1,186 @@
+// Package runtime defines how service-io runs adapter instances, independent
+// of the engine that actually executes them.
+package runtime
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// Labels set on every adapter instance so runtimes can find the instances
+// service-io manages. User labels are copied under LabelUserPrefix so they
+// can be used with docker ps --filter.
+const (
+	LabelManagedBy  = "io.scadable.managed-by"
+	LabelDeviceID   = "io.scadable.device-id"
+	LabelDeviceType = "io.scadable.device-type"
+	LabelUserPrefix = "io.scadable.label."
+
+	ManagedByValue = "service-io"
+)
+
+// ErrInvalidContract is returned when an image carries malformed contract labels.
+var ErrInvalidContract = errors.New("invalid adapter contract")
+
+// ErrNoDigest is returned when an image has no registry digest to pin it
+// to, e.g. because it was only built locally.
+var ErrNoDigest = errors.New("image has no registry digest")
+
+// ErrNotSupported is returned by runtimes that cannot perform an operation.
+var ErrNotSupported = errors.New("not supported by this runtime")
+
+// Runtime runs and observes adapter instances. Instances are addressed by
+// the ID returned from Run or by the spec's Name.
+type Runtime interface {
+	// Resolve makes an image available locally, pulling it if it is missing
+	// (or always, with forcePull), and returns its digest and contract.
+	Resolve(ctx context.Context, image string, forcePull bool) (*ImageInfo, error)
+	// Run replaces any existing instance with the same name and starts a new one.
+	Run(ctx context.Context, spec AdapterSpec) (id string, err error)
+	// Stop stops and removes an instance. A missing instance is not an error.
+	Stop(ctx context.Context, ref string) error
+	// Inspect returns the live state of an instance, or (nil, nil) if it does not exist.
+	Inspect(ctx context.Context, ref string) (*State, error)
+	// List returns every managed instance, running or not.
+	List(ctx context.Context) ([]Instance, error)
+	// Logs streams the combined stdout and stderr of an instance.
+	Logs(ctx context.Context, ref string, opts LogOptions) (io.ReadCloser, error)
+	// Stats returns a point-in-time resource usage sample.
+	Stats(ctx context.Context, ref string) (*Stats, error)
+	// Events streams lifecycle events of managed instances until ctx is
+	// done or the underlying stream fails, then closes the channel.
+	Events(ctx context.Context) (<-chan Event, error)
+}
+
+// AdapterSpec describes the adapter instance to run for one device.
+type AdapterSpec struct {
+	Name         string
+	DeviceID     string
+	Image        string
+	NATSURL      string
+	NATSSubject  string
+	MQTTUser     string
+	MQTTPassword string
+	Labels       map[string]string
+	// Route is how clients reach the adapter from outside; nil if they don't.
+	Route *Route
+
+	// Config is the device's adapter configuration. Runtimes deliver it as
+	// a JSON file and export its top-level scalar values as
+	// ADAPTER_CFG_<KEY> environment variables.
+	Config        map[string]any
+	ConfigVersion int
+}
+
+// Route describes how external clients reach an adapter through a Traefik
+// TCP entrypoint.
+type Route struct {
+	// Host is matched against the TLS SNI; empty matches any connection.
+	Host       string
+	EntryPoint string
+	// Port is the port the adapter listens on.
+	Port int
+	// TLS is terminated by Traefik, or by the adapter itself with Passthrough.
+	// Without TLS the route is plain TCP.
+	TLS          bool
+	Passthrough  bool
+	CertResolver string
+	TLSOptions   string
+	// Domains are requested from CertResolver; the first is the main domain
+	// and the rest are SANs.
+	Domains []string
+}
+
+// Rule returns the Traefik TCP router rule for the route.
+func (r *Route) Rule() string {
+	host := r.Host
+	if host == "" {
+		host = "*"
+	}
+	return "HostSNI(`" + host + "`)"
+}
+
+// State is the live state of an adapter instance.
+type State struct {
+	Status       string    `json:"status" example:"running"`
+	Running      bool      `json:"running" example:"true"`
+	ExitCode     int       `json:"exit_code" example:"0"`
+	RestartCount int       `json:"restart_count" example:"0"`
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+}
+
+// Instance is a managed adapter instance as listed by a runtime.
+type Instance struct {
+	ID       string
+	Name     string
+	DeviceID string
+	// Running is true while the instance runs or the runtime itself is
+	// bringing it back up.
+	Running bool
+	// Labels are the labels the instance carries. Routing labels are only
+	// present on runtimes that route through Traefik's Docker provider.
+	Labels map[string]string
+}
+
+// ImageInfo identifies a resolved image and the adapter contract it declares.
+type ImageInfo struct {
+	// Digest pins the exact image, e.g. "repo@sha256:...".
+	Digest   string
+	Contract Contract
+}
+
+// Contract is what an adapter image declares about itself. Zero values
+// mean "not declared".
+type Contract struct {
+	// Declared is false when the image declares nothing at all.
+	Declared          bool
+	Port              int
+	Protocol          string
+	TLS               bool // the adapter terminates TLS itself
+	ConfigSchema      []byte
+	MinServiceVersion string
+}
+
+// LogOptions selects which log lines to return.
+type LogOptions struct {
+	Tail   int // number of trailing lines; 0 means all
+	Since  time.Time
+	Follow bool
+}
+
+// Stats is a resource usage sample of an adapter instance.
+type Stats struct {
+	CPUPercent       float64   `json:"cpu_percent" example:"1.5"`
+	MemoryBytes      uint64    `json:"memory_bytes" example:"10485760"`
+	MemoryLimitBytes uint64    `json:"memory_limit_bytes" example:"536870912"`
+	NetRxBytes       uint64    `json:"net_rx_bytes" example:"2048"`
+	NetTxBytes       uint64    `json:"net_tx_bytes" example:"4096"`
+	PIDs             uint64    `json:"pids" example:"4"`
+	Time             time.Time `json:"time"`
+}
+
+// Event actions.
+const (
+	EventStart   = "start"
+	EventDie     = "die"
+	EventOOM     = "oom"
+	EventRestart = "restart"
+	EventHealth  = "health_status"
+	EventDestroy = "destroy"
+)
+
+// Event is a lifecycle event of a managed adapter instance.
+type Event struct {
+	ID       string // instance ID
+	Name     string
+	DeviceID string
+	Action   string
+	// ExitCode is set for die events.
+	ExitCode int
+	// Health is set for health_status events, e.g. "healthy".
+	Health string
+	Time   time.Time
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"service-io/internal/core/devices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// adapterTypeRequest defines the shape of the request body for creating an
+// adapter type.
+type adapterTypeRequest struct {
+	Name         string          `json:"name" example:"modbus"`
+	Image        string          `json:"image" example:"registry.digitalocean.com/scadable-container-registry/adapter-modbus:latest"`
+	DefaultPort  int             `json:"default_port,omitempty" example:"1883"`
+	Protocol     string          `json:"protocol,omitempty" example:"mqtt"`
+	Description  string          `json:"description,omitempty" example:"Modbus TCP poller"`
+	ConfigSchema json.RawMessage `json:"config_schema,omitempty" swaggertype:"object"`
+	// RestartPolicy is always (default), on-failure or never.
+	RestartPolicy string `json:"restart_policy,omitempty" example:"on-failure"`
+}
+
+// updateAdapterTypeRequest defines the shape of the request body for
+// updating an adapter type. Omitted fields are left unchanged.
+type updateAdapterTypeRequest struct {
+	Image        *string         `json:"image,omitempty" example:"registry.digitalocean.com/scadable-container-registry/adapter-modbus:v2"`
+	DefaultPort  *int            `json:"default_port,omitempty" example:"1883"`
+	Protocol     *string         `json:"protocol,omitempty" example:"mqtt"`
+	Description  *string         `json:"description,omitempty" example:"Modbus TCP poller"`
+	ConfigSchema json.RawMessage `json:"config_schema,omitempty" swaggertype:"object"`
+	Deprecated   *bool           `json:"deprecated,omitempty" example:"false"`
+
+	RestartPolicy *string `json:"restart_policy,omitempty" example:"on-failure"`
+}
+
+// handleAddAdapterType adds a device type to the catalog.
+// @Summary      Add an adapter type
+// @Description  Adds a device type to the adapter catalog.
+// @Tags         adapter-types
+// @Accept       json
+// @Produce      json
+// @Param        type  body      adapterTypeRequest  true  "Adapter type"
+// @Success      201   {object}  devices.AdapterType
+// @Failure      400   {string}  string "Bad Request"
+// @Failure      409   {string}  string "Conflict"
+// @Failure      500   {string}  string "Internal Server Error"
+// @Router       /adapter-types [post]
+func (h *Handler) handleAddAdapterType(w http.ResponseWriter, r *http.Request) {
+	var req adapterTypeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("body must be a JSON object"))
+		return
+	}
+	t, err := h.mgr.CreateAdapterType(r.Context(), devices.AdapterType{
+		Name:          req.Name,
+		Image:         req.Image,
+		DefaultPort:   req.DefaultPort,
+		Protocol:      req.Protocol,
+		Description:   req.Description,
+		ConfigSchema:  devices.RawJSON(req.ConfigSchema),
+		RestartPolicy: devices.RestartPolicy(req.RestartPolicy),
+	})
+	if err != nil {
+		h.writeAdapterTypeError(w, err, "add adapter type")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(t)
+}
+
+// handleListAdapterTypes lists the adapter catalog.
+// @Summary      List adapter types
+// @Description  Lists the supported device types. Deprecated types are hidden unless include_deprecated is set.
+// @Tags         adapter-types
+// @Produce      json
+// @Param        include_deprecated  query     bool  false  "Include deprecated types"
+// @Success      200  {array}   devices.AdapterType
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /adapter-types [get]
+func (h *Handler) handleListAdapterTypes(w http.ResponseWriter, r *http.Request) {
+	all, _ := strconv.ParseBool(r.URL.Query().Get("include_deprecated"))
+	types, err := h.mgr.ListAdapterTypes(r.Context(), all)
+	if err != nil {
+		h.writeAdapterTypeError(w, err, "list adapter types")
+		return
+	}
+	writeJSON(w, types)
+}
+
+// handleGetAdapterType returns a single adapter type.
+// @Summary      Get an adapter type
+// @Tags         adapter-types
+// @Produce      json
+// @Param        type  path      string  true  "Device type"
+// @Success      200   {object}  devices.AdapterType
+// @Failure      404   {string}  string "Not Found"
+// @Failure      500   {string}  string "Internal Server Error"
+// @Router       /adapter-types/{type} [get]
+func (h *Handler) handleGetAdapterType(w http.ResponseWriter, r *http.Request) {
+	t, err := h.mgr.GetAdapterType(r.Context(), chi.URLParam(r, "type"))
+	if err != nil {
+		h.writeAdapterTypeError(w, err, "get adapter type")
+		return
+	}
+	writeJSON(w, t)
+}
+
+// handleUpdateAdapterType changes an adapter type.
+// @Summary      Update an adapter type
+// @Description  Changes an adapter type. Existing devices keep the image they were created with.
+// @Tags         adapter-types
+// @Accept       json
+// @Produce      json
+// @Param        type  path      string                    true  "Device type"
+// @Param        body  body      updateAdapterTypeRequest  true  "Fields to change"
+// @Success      200   {object}  devices.AdapterType
+// @Failure      400   {string}  string "Bad Request"
+// @Failure      404   {string}  string "Not Found"
+// @Failure      500   {string}  string "Internal Server Error"
+// @Router       /adapter-types/{type} [patch]
+func (h *Handler) handleUpdateAdapterType(w http.ResponseWriter, r *http.Request) {
+	var req updateAdapterTypeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("body must be a JSON object"))
+		return
+	}
+	t, err := h.mgr.UpdateAdapterType(r.Context(), chi.URLParam(r, "type"), devices.AdapterTypeUpdate{
+		Image:         req.Image,
+		DefaultPort:   req.DefaultPort,
+		Protocol:      req.Protocol,
+		Description:   req.Description,
+		ConfigSchema:  devices.RawJSON(req.ConfigSchema),
+		Deprecated:    req.Deprecated,
+		RestartPolicy: (*devices.RestartPolicy)(req.RestartPolicy),
+	})
+	if err != nil {
+		h.writeAdapterTypeError(w, err, "update adapter type")
+		return
+	}
+	writeJSON(w, t)
+}
+
+// handleDeprecateAdapterType deprecates an adapter type.
+// @Summary      Deprecate an adapter type
+// @Description  Stops new devices from being created with this type. Existing devices keep running.
+// @Tags         adapter-types
+// @Produce      json
+// @Param        type  path      string  true  "Device type"
+// @Success      200   {object}  devices.AdapterType
+// @Failure      404   {string}  string "Not Found"
+// @Failure      500   {string}  string "Internal Server Error"
+// @Router       /adapter-types/{type} [delete]
+func (h *Handler) handleDeprecateAdapterType(w http.ResponseWriter, r *http.Request) {
+	t, err := h.mgr.DeprecateAdapterType(r.Context(), chi.URLParam(r, "type"))
+	if err != nil {
+		h.writeAdapterTypeError(w, err, "deprecate adapter type")
+		return
+	}
+	writeJSON(w, t)
+}
+
+// handleAdapterSchema returns the config JSON Schema of a device type.
+// @Summary      Get adapter config schema
+// @Description  Returns the JSON Schema that per-device adapter config of this type must satisfy, so UIs can render forms: the schema set in the catalog, or else the one declared by the type's image labels. Devices moved to another image are validated against that image's schema instead.
+// @Tags         adapter-types
+// @Produce      json
+// @Param        type   path      string  true  "Device type"
+// @Success      200  {object}  object
+// @Failure      404  {string}  string "Not Found"
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /adapter-types/{type}/schema [get]
+func (h *Handler) handleAdapterSchema(w http.ResponseWriter, r *http.Request) {
+	schema, err := h.mgr.AdapterSchema(r.Context(), chi.URLParam(r, "type"))
+	if err != nil {
+		h.writeAdapterTypeError(w, err, "get adapter schema")
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	_, _ = w.Write(schema)
+}
+
+// writeAdapterTypeError maps catalog errors to HTTP status codes. On these
+// routes an unknown type is a missing resource rather than a bad request.
+func (h *Handler) writeAdapterTypeError(w http.ResponseWriter, err error, op string) {
+	switch {
+	case errors.Is(err, devices.ErrUnknownAdapterType):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, devices.ErrAdapterTypeExists):
+		writeError(w, http.StatusConflict, err)
+	case errors.Is(err, devices.ErrInvalidAdapterType):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		h.writeManagerError(w, err, op)
+	}
+}
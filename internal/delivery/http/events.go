@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"service-io/internal/core/devices"
+)
+
+// sseKeepAlive is how often an idle event stream gets a comment line, so
+// proxies do not close it.
+const sseKeepAlive = 15 * time.Second
+
+// handleDeviceEvents streams device lifecycle events as Server-Sent Events.
+// @Summary      Stream device events
+// @Description  Streams the lifecycle events of devices (created, updated, started, stopped, died, deleted, ...) as Server-Sent Events as they happen. Each message has the event's sequence number as its id, the event type as its event name and the event, with a device snapshot, as JSON data. The events of every replica are sent, so a client can reconnect to any replica: reconnecting with Last-Event-ID (or last_event_id), it first gets the events it missed; if they are no longer known, a "reset" event tells it to reload its device list. A client that falls behind is disconnected and can resume the same way.
+// @Tags         devices
+// @Produce      text/event-stream
+// @Param        selector       query     string  false  "Only events of devices matching this label selector"
+// @Param        last_event_id  query     string  false  "Resume after this event sequence number, like the Last-Event-ID header"
+// @Param        Last-Event-ID  header    string  false  "Resume after this event sequence number"
+// @Success      200  {object}  devices.Event
+// @Failure      400  {string}  string "Bad Request"
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /devices/events [get]
+func (h *Handler) handleDeviceEvents(w http.ResponseWriter, r *http.Request) {
+	var sel devices.Selector
+	if v := r.URL.Query().Get("selector"); v != "" {
+		var err error
+		if sel, err = devices.ParseSelector(v); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	f, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var (
+		missed  []devices.Event
+		events  <-chan devices.Event
+		cancel  func()
+		resumed = true
+	)
+	if lastID != "" {
+		// IDs that are not sequence numbers are not known either.
+		lastSeq, _ := strconv.ParseUint(lastID, 10, 64)
+		missed, events, cancel, resumed = h.mgr.Resume(r.Context(), lastSeq)
+	} else {
+		events, cancel = h.mgr.Subscribe()
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if !resumed {
+		_, _ = io.WriteString(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, ev := range missed {
+		writeEvent(w, sel, ev)
+	}
+	f.Flush()
+
+	t := time.NewTicker(sseKeepAlive)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if writeEvent(w, sel, ev) {
+				f.Flush()
+			}
+		case <-t.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			f.Flush()
+		}
+	}
+}
+
+// writeEvent writes ev as a Server-Sent Event unless sel filters it out, and
+// reports whether it did.
+func writeEvent(w io.Writer, sel devices.Selector, ev devices.Event) bool {
+	if len(sel) > 0 && (ev.Device == nil || !sel.Matches(ev.Device.Labels)) {
+		return false
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return false
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Type, data)
+	return err == nil
+}
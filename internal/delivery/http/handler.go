@@ -3,9 +3,13 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"service-io/internal/core/devices"
-	"strings"
+	"service-io/internal/core/runtime"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -20,7 +24,42 @@ type Handler struct {
 
 // addDeviceRequest defines the shape of the request body for adding a device.
 type addDeviceRequest struct {
-	Type string `json:"type" example:"random"`
+	Type        string            `json:"type" example:"random"`
+	Name        string            `json:"name,omitempty" example:"boiler-room-plc-3"`
+	Description string            `json:"description,omitempty" example:"Modbus PLC in the boiler room"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Config      map[string]any    `json:"config,omitempty"`
+	// Placement is a label selector over host labels, e.g. "site=plant-a".
+	Placement string `json:"placement,omitempty" example:"site=plant-a"`
+}
+
+// updateDeviceRequest defines the shape of the request body for updating a
+// device. Omitted fields are left unchanged.
+type updateDeviceRequest struct {
+	Name        *string           `json:"name,omitempty" example:"boiler-room-plc-3"`
+	Description *string           `json:"description,omitempty" example:"Modbus PLC in the boiler room"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Image       *string           `json:"image,omitempty" example:"registry.digitalocean.com/scadable-container-registry/adapter-mqtt:latest"`
+	// Config replaces the whole adapter configuration.
+	Config map[string]any `json:"config,omitempty"`
+}
+
+// validationErrorResponse is returned with 422 when an adapter config does
+// not match its type's schema.
+type validationErrorResponse struct {
+	Error  string               `json:"error"`
+	Fields []devices.FieldError `json:"fields"`
+}
+
+// upgradeRequest defines the shape of the request body for a rolling upgrade.
+// The device_id, type and selector filters are combined.
+type upgradeRequest struct {
+	DeviceID          string `json:"device_id,omitempty" example:"EDIVRWCLGGPGCW7M"`
+	Type              string `json:"type,omitempty" example:"mqtt"`
+	Selector          string `json:"selector,omitempty" example:"site in (plant-a)"`
+	Image             string `json:"image,omitempty" example:"registry.digitalocean.com/scadable-container-registry/adapter-mqtt:v2"`
+	MaxUnavailable    int    `json:"max_unavailable,omitempty" example:"2"`
+	HealthWaitSeconds int    `json:"health_wait_seconds,omitempty" example:"10"`
 }
 
 func New(m *devices.Manager, lg zerolog.Logger) http.Handler {
@@ -30,14 +69,65 @@ func New(m *devices.Manager, lg zerolog.Logger) http.Handler {
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(withActor)
 
 	h := &Handler{mgr: m, lg: lg}
 
 	// --- API Routes ---
+	r.Route("/adapter-types", func(r chi.Router) {
+		r.Post("/", h.handleAddAdapterType)
+		r.Get("/", h.handleListAdapterTypes)
+		r.Get("/{type}", h.handleGetAdapterType)
+		r.Patch("/{type}", h.handleUpdateAdapterType)
+		r.Delete("/{type}", h.handleDeprecateAdapterType)
+		r.Get("/{type}/schema", h.handleAdapterSchema)
+	})
+
+	r.Route("/webhooks", func(r chi.Router) {
+		r.Post("/", h.handleAddWebhook)
+		r.Get("/", h.handleListWebhooks)
+		r.Get("/{webhookID}", h.handleGetWebhook)
+		r.Patch("/{webhookID}", h.handleUpdateWebhook)
+		r.Delete("/{webhookID}", h.handleDeleteWebhook)
+		r.Get("/{webhookID}/deliveries", h.handleWebhookDeliveries)
+		r.Post("/{webhookID}/deliveries/{deliveryID}/redeliver", h.handleRedeliverWebhook)
+	})
+
+	r.Post("/upgrades", h.handleUpgrade)
+
+	r.Get("/readyz", h.handleReady)
+	r.Get("/readyz/fleet", h.handleFleetReady)
+
+	r.Route("/operations", func(r chi.Router) {
+		r.Get("/{operationID}", h.handleGetOperation)
+		r.Post("/{operationID}/cancel", h.handleCancelOperation)
+	})
+
+	r.Get("/reconcile", h.handleLastReconcile)
+	r.Post("/reconcile", h.handleReconcile)
+
+	r.Route("/hosts", func(r chi.Router) {
+		r.Post("/", h.handleAddHost)
+		r.Get("/", h.handleListHosts)
+		r.Get("/{name}", h.handleGetHost)
+		r.Patch("/{name}", h.handleUpdateHost)
+		r.Delete("/{name}", h.handleDeleteHost)
+	})
+
 	r.Route("/devices", func(r chi.Router) {
 		r.Post("/", h.handleAdd)
 		r.Get("/", h.handleList)
+		r.Get("/events", h.handleDeviceEvents)
+		r.Get("/{deviceID}", h.handleGet)
+		r.Patch("/{deviceID}", h.handleUpdate)
 		r.Delete("/{deviceID}", h.handleDelete)
+		r.Post("/{deviceID}/start", h.handleStart)
+		r.Post("/{deviceID}/stop", h.handleStop)
+		r.Post("/{deviceID}/restart", h.handleRestart)
+		r.Get("/{deviceID}/config/revisions", h.handleConfigRevisions)
+		r.Get("/{deviceID}/operations", h.handleDeviceOperations)
+		r.Get("/{deviceID}/logs", h.handleLogs)
+		r.Get("/{deviceID}/stats", h.handleStats)
 	})
 
 	// --- Swagger Docs Route ---
@@ -56,10 +146,14 @@ func New(m *devices.Manager, lg zerolog.Logger) http.Handler {
 // @Tags         devices
 // @Accept       json
 // @Produce      json
-// @Param        device  body      addDeviceRequest     true  "Device Type"
+// @Param        device  body      addDeviceRequest     true  "Device type and optional metadata"
+// @Param        async   query     bool                 false "Return 202 with an operation instead of waiting for the adapter"
 // @Success      200     {object}  devices.Device
+// @Success      202     {object}  devices.Operation
 // @Failure      400     {string}  string "Bad Request"
+// @Failure      422     {object}  validationErrorResponse "Config does not match the type's schema"
 // @Failure      500     {string}  string "Internal Server Error"
+// @Failure      503     {string}  string "No host can take the device"
 // @Router       /devices [post]
 func (h *Handler) handleAdd(w http.ResponseWriter, r *http.Request) {
 	var req addDeviceRequest
@@ -67,59 +161,390 @@ func (h *Handler) handleAdd(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error": "body must be {\"type\":\"<deviceType>\"}"}`, http.StatusBadRequest)
 		return
 	}
-	dev, err := h.mgr.AddDevice(r.Context(), req.Type)
+	spec := devices.NewDevice{
+		Type:        req.Type,
+		Name:        req.Name,
+		Description: req.Description,
+		Labels:      req.Labels,
+		Config:      req.Config,
+		Placement:   req.Placement,
+	}
+	if wantsAsync(r) {
+		op, err := h.mgr.SubmitAddDevice(r.Context(), spec)
+		if err != nil {
+			h.writeManagerError(w, err, "add device")
+			return
+		}
+		writeAccepted(w, op)
+		return
+	}
+	dev, err := h.mgr.AddDevice(r.Context(), spec)
 	if err != nil {
-		h.lg.Error().Err(err).Msg("add device")
-		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusInternalServerError)
+		h.writeManagerError(w, err, "add device")
 		return
 	}
 	writeJSON(w, dev)
 }
 
-// handleList lists all registered device adapters.
-// @Summary      List all devices
-// @Description  Retrieves a list of all device adapters from the database.
+// handleList lists registered device adapters one page at a time.
+// @Summary      List devices
+// @Description  Retrieves a page of device adapters from the database. When more results exist, a Link header with rel="next" points at the next page.
 // @Tags         devices
 // @Produce      json
+// @Param        limit     query     int     false  "Page size (default 50, max 500)"
+// @Param        cursor    query     string  false  "Opaque cursor from the previous page's Link header"
+// @Param        type      query     string  false  "Filter by device type"
+// @Param        status    query     string  false  "Filter by status"
+// @Param        image     query     string  false  "Filter by adapter image"
+// @Param        selector  query     string  false  "Label selector, e.g. env=prod,site in (a,b),!legacy"
+// @Param        q         query     string  false  "Case-insensitive search on the device name"
+// @Param        sort      query     string  false  "Sort key (created_at, name, type, status); prefix with - for descending"
 // @Success      200  {array}   devices.Device
+// @Header       200  {string}  Link  "Link to the next page"
+// @Failure      400  {string}  string "Bad Request"
 // @Failure      500  {string}  string "Internal Server Error"
 // @Router       /devices [get]
-func (h *Handler) handleList(w http.ResponseWriter, _ *http.Request) {
-	list, err := h.mgr.ListDevices()
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := devices.ListOptions{
+		Cursor:   q.Get("cursor"),
+		Type:     q.Get("type"),
+		Status:   devices.Status(q.Get("status")),
+		Image:    q.Get("image"),
+		Selector: q.Get("selector"),
+		Search:   q.Get("q"),
+		Sort:     q.Get("sort"),
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("limit must be an integer"))
+			return
+		}
+		opts.Limit = limit
+	}
+
+	page, err := h.mgr.ListDevices(r.Context(), opts)
 	if err != nil {
-		h.lg.Error().Err(err).Msg("list devices")
-		http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusInternalServerError)
+		h.writeManagerError(w, err, "list devices")
 		return
 	}
+
+	if page.NextCursor != "" {
+		next := *r.URL
+		nq := next.Query()
+		nq.Set("cursor", page.NextCursor)
+		next.RawQuery = nq.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	}
+
+	list := page.Devices
+	if list == nil {
+		list = []devices.Device{}
+	}
 	writeJSON(w, list)
 }
 
+// handleGet returns a single device with its live container state.
+// @Summary      Get a device
+// @Description  Returns the stored device record merged with the live state of its container.
+// @Tags         devices
+// @Produce      json
+// @Param        deviceID   path      string  true  "Device ID"
+// @Success      200  {object}  devices.DeviceDetails
+// @Failure      404  {string}  string "Not Found"
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /devices/{deviceID} [get]
+func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request) {
+	dev, err := h.mgr.GetDevice(r.Context(), chi.URLParam(r, "deviceID"))
+	if err != nil {
+		h.writeManagerError(w, err, "get device")
+		return
+	}
+	writeJSON(w, dev)
+}
+
+// handleUpdate changes the mutable fields of a device.
+// @Summary      Update a device
+// @Description  Changes the name, description, labels, adapter image or adapter config of a device. Changing the image or config of a running device recreates its container, restoring the previous one if the new container fails to start; label changes reach the container's Docker labels the next time it is (re)created.
+// @Tags         devices
+// @Accept       json
+// @Produce      json
+// @Param        deviceID   path      string               true  "Device ID"
+// @Param        device     body      updateDeviceRequest  true  "Fields to change"
+// @Success      200  {object}  devices.Device
+// @Failure      400  {string}  string "Bad Request"
+// @Failure      404  {string}  string "Not Found"
+// @Failure      409  {string}  string "Device has an operation in progress or changed meanwhile"
+// @Failure      422  {object}  validationErrorResponse "Config does not match the type's schema"
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /devices/{deviceID} [patch]
+func (h *Handler) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	var req updateDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("body must be a JSON object"))
+		return
+	}
+	dev, err := h.mgr.UpdateDevice(r.Context(), chi.URLParam(r, "deviceID"), devices.DeviceUpdate{
+		Name:        req.Name,
+		Description: req.Description,
+		Labels:      req.Labels,
+		Image:       req.Image,
+		Config:      req.Config,
+	})
+	if err != nil {
+		h.writeManagerError(w, err, "update device")
+		return
+	}
+	writeJSON(w, dev)
+}
+
 // handleDelete removes a device adapter.
 // @Summary      Remove a device
-// @Description  Stops the device's container and removes its record from the database.
+// @Description  Stops the device's container and marks the device as deleted. With purge=true the container, NATS stream, credentials, route and database record are removed permanently and a tombstone audit entry is recorded.
 // @Tags         devices
 // @Produce      json
-// @Param        deviceID   path      string  true  "Device ID"
+// @Param        deviceID   path      string  true   "Device ID"
+// @Param        purge      query     bool    false  "Permanently remove the device and its data"
+// @Param        async      query     bool    false  "Return 202 with an operation instead of waiting"
 // @Success      204  {string}  string "No Content"
+// @Success      202  {object}  devices.Operation
 // @Failure      404  {string}  string "Not Found"
 // @Failure      500  {string}  string "Internal Server Error"
 // @Router       /devices/{deviceID} [delete]
 func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
 	deviceID := chi.URLParam(r, "deviceID")
-	// 🎯 FIX: Use RemoveDevice which now returns a standard "not found" error.
-	if err := h.mgr.RemoveDevice(r.Context(), deviceID); err != nil {
-		// A more robust way to check for "not found" errors
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusNotFound)
-		} else {
-			http.Error(w, `{"error": "`+err.Error()+`"}`, http.StatusInternalServerError)
-		}
+	purge, _ := strconv.ParseBool(r.URL.Query().Get("purge"))
+
+	var (
+		op  *devices.Operation
+		err error
+	)
+	switch {
+	case wantsAsync(r) && purge:
+		op, err = h.mgr.SubmitPurgeDevice(r.Context(), deviceID)
+	case wantsAsync(r):
+		op, err = h.mgr.SubmitRemoveDevice(r.Context(), deviceID)
+	case purge:
+		err = h.mgr.PurgeDevice(r.Context(), deviceID)
+	default:
+		err = h.mgr.RemoveDevice(r.Context(), deviceID)
+	}
+	if err != nil {
+		h.writeManagerError(w, err, "remove device")
+		return
+	}
+	if op != nil {
+		writeAccepted(w, op)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handleStart starts a stopped device.
+// @Summary      Start a device
+// @Description  Starts the adapter container of a stopped device, reusing its stored credentials and NATS stream.
+// @Tags         devices
+// @Produce      json
+// @Param        deviceID   path      string  true  "Device ID"
+// @Param        async      query     bool    false  "Return 202 with an operation instead of waiting"
+// @Success      200  {object}  devices.Device
+// @Success      202  {object}  devices.Operation
+// @Failure      404  {string}  string "Not Found"
+// @Failure      409  {string}  string "Conflict"
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /devices/{deviceID}/start [post]
+func (h *Handler) handleStart(w http.ResponseWriter, r *http.Request) {
+	if wantsAsync(r) {
+		op, err := h.mgr.SubmitStartDevice(r.Context(), chi.URLParam(r, "deviceID"))
+		if err != nil {
+			h.writeManagerError(w, err, "start device")
+			return
+		}
+		writeAccepted(w, op)
+		return
+	}
+	dev, err := h.mgr.StartDevice(r.Context(), chi.URLParam(r, "deviceID"))
+	if err != nil {
+		h.writeManagerError(w, err, "start device")
+		return
+	}
+	writeJSON(w, dev)
+}
+
+// handleStop stops a running device.
+// @Summary      Stop a device
+// @Description  Stops and removes the adapter container of a running device. The device can be started again later.
+// @Tags         devices
+// @Produce      json
+// @Param        deviceID   path      string  true  "Device ID"
+// @Param        async      query     bool    false  "Return 202 with an operation instead of waiting"
+// @Success      200  {object}  devices.Device
+// @Success      202  {object}  devices.Operation
+// @Failure      404  {string}  string "Not Found"
+// @Failure      409  {string}  string "Conflict"
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /devices/{deviceID}/stop [post]
+func (h *Handler) handleStop(w http.ResponseWriter, r *http.Request) {
+	if wantsAsync(r) {
+		op, err := h.mgr.SubmitStopDevice(r.Context(), chi.URLParam(r, "deviceID"))
+		if err != nil {
+			h.writeManagerError(w, err, "stop device")
+			return
+		}
+		writeAccepted(w, op)
+		return
+	}
+	dev, err := h.mgr.StopDevice(r.Context(), chi.URLParam(r, "deviceID"))
+	if err != nil {
+		h.writeManagerError(w, err, "stop device")
+		return
+	}
+	writeJSON(w, dev)
+}
+
+// handleRestart recreates the container of a running device.
+// @Summary      Restart a device
+// @Description  Recreates the adapter container of a running device.
+// @Tags         devices
+// @Produce      json
+// @Param        deviceID   path      string  true  "Device ID"
+// @Param        async      query     bool    false  "Return 202 with an operation instead of waiting"
+// @Success      200  {object}  devices.Device
+// @Success      202  {object}  devices.Operation
+// @Failure      404  {string}  string "Not Found"
+// @Failure      409  {string}  string "Conflict"
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /devices/{deviceID}/restart [post]
+func (h *Handler) handleRestart(w http.ResponseWriter, r *http.Request) {
+	if wantsAsync(r) {
+		op, err := h.mgr.SubmitRestartDevice(r.Context(), chi.URLParam(r, "deviceID"))
+		if err != nil {
+			h.writeManagerError(w, err, "restart device")
+			return
+		}
+		writeAccepted(w, op)
+		return
+	}
+	dev, err := h.mgr.RestartDevice(r.Context(), chi.URLParam(r, "deviceID"))
+	if err != nil {
+		h.writeManagerError(w, err, "restart device")
+		return
+	}
+	writeJSON(w, dev)
+}
+
+// handleConfigRevisions lists the configuration history of a device.
+// @Summary      List config revisions
+// @Description  Returns every stored version of the device's adapter configuration, newest first.
+// @Tags         devices
+// @Produce      json
+// @Param        deviceID   path      string  true  "Device ID"
+// @Success      200  {array}   devices.ConfigRevision
+// @Failure      404  {string}  string "Not Found"
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /devices/{deviceID}/config/revisions [get]
+func (h *Handler) handleConfigRevisions(w http.ResponseWriter, r *http.Request) {
+	revs, err := h.mgr.ListConfigRevisions(r.Context(), chi.URLParam(r, "deviceID"))
+	if err != nil {
+		h.writeManagerError(w, err, "list config revisions")
+		return
+	}
+	writeJSON(w, revs)
+}
+
+// handleUpgrade rolls selected devices onto a new image.
+// @Summary      Upgrade devices
+// @Description  Recreates the selected running devices on a new image digest, max_unavailable at a time. Each new container must stay up for health_wait_seconds; otherwise the device is rolled back to its previous digest and the rest of the rollout is skipped. Devices with an operation in progress are skipped.
+// @Tags         devices
+// @Accept       json
+// @Produce      json
+// @Param        upgrade  body      upgradeRequest  true  "Devices to upgrade and target image"
+// @Success      200      {object}  devices.UpgradeReport
+// @Failure      400      {string}  string "Bad Request"
+// @Failure      500      {string}  string "Internal Server Error"
+// @Router       /upgrades [post]
+func (h *Handler) handleUpgrade(w http.ResponseWriter, r *http.Request) {
+	var req upgradeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("body must be a JSON object"))
+		return
+	}
+	report, err := h.mgr.UpgradeDevices(r.Context(), devices.UpgradeRequest{
+		DeviceID:       req.DeviceID,
+		Type:           req.Type,
+		Selector:       req.Selector,
+		Image:          req.Image,
+		MaxUnavailable: req.MaxUnavailable,
+		HealthWait:     time.Duration(req.HealthWaitSeconds) * time.Second,
+	})
+	if err != nil {
+		h.writeManagerError(w, err, "upgrade devices")
+		return
+	}
+	writeJSON(w, report)
+}
+
+// writeManagerError maps errors returned by the device manager to HTTP
+// status codes. Unexpected errors are logged.
+func (h *Handler) writeManagerError(w http.ResponseWriter, err error, op string) {
+	var verr *devices.ConfigValidationError
+	switch {
+	case errors.As(err, &verr):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = json.NewEncoder(w).Encode(validationErrorResponse{Error: err.Error(), Fields: verr.Fields})
+	case errors.Is(err, devices.ErrNotFound),
+		errors.Is(err, devices.ErrOperationNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, devices.ErrInvalidUpdate),
+		errors.Is(err, devices.ErrInvalidQuery),
+		errors.Is(err, devices.ErrInvalidSelector),
+		errors.Is(err, devices.ErrInvalidLabels),
+		errors.Is(err, devices.ErrUnknownAdapterType),
+		errors.Is(err, devices.ErrAdapterTypeDeprecated),
+		errors.Is(err, devices.ErrIncompatibleImage):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, devices.ErrInvalidTransition),
+		errors.Is(err, devices.ErrNoContainer),
+		errors.Is(err, devices.ErrOperationNotCancellable),
+		errors.Is(err, devices.ErrOperationInProgress),
+		errors.Is(err, devices.ErrOperationCancelled),
+		errors.Is(err, devices.ErrConflict):
+		writeError(w, http.StatusConflict, err)
+	case errors.Is(err, devices.ErrNoHostAvailable),
+		errors.Is(err, devices.ErrNotLeader):
+		writeError(w, http.StatusServiceUnavailable, err)
+	case errors.Is(err, runtime.ErrNotSupported):
+		writeError(w, http.StatusNotImplemented, err)
+	default:
+		h.lg.Error().Err(err).Msg(op)
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// defaultActor is the actor of API requests that do not name one.
+const defaultActor = "api"
+
+// withActor attributes the events and operations a request causes to the
+// caller named in its X-Actor header.
+func withActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := r.Header.Get("X-Actor")
+		if actor == "" {
+			actor = defaultActor
+		}
+		next.ServeHTTP(w, r.WithContext(devices.WithActor(r.Context(), actor)))
+	})
+}
+
 func writeJSON(w http.ResponseWriter, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(v)
 }
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
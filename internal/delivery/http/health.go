@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// handleReady reports whether this replica can serve the API.
+// @Summary      API readiness
+// @Description  Returns 204 once the API is up and its database is reachable, whether or not the adapter fleet has been restored yet.
+// @Tags         health
+// @Success      204
+// @Failure      503  {string}  string "Database unreachable"
+// @Router       /readyz [get]
+func (h *Handler) handleReady(w http.ResponseWriter, r *http.Request) {
+	if err := h.mgr.Ping(r.Context()); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleFleetReady reports the progress of restoring the adapter fleet.
+// @Summary      Fleet readiness
+// @Description  Returns the progress of restoring the adapters of running devices after service-io started or became leader: 200 once done, 503 while in progress. Only the leader replica restores the fleet; other replicas return 503 with an error.
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  devices.BootReport
+// @Failure      503  {object}  devices.BootReport
+// @Router       /readyz/fleet [get]
+func (h *Handler) handleFleetReady(w http.ResponseWriter, r *http.Request) {
+	rep := h.mgr.BootProgress()
+	if rep == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("fleet restore has not started on this replica"))
+		return
+	}
+	if !rep.Restored() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(rep)
+		return
+	}
+	writeJSON(w, rep)
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"service-io/internal/core/devices"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// hostRequest defines the shape of the request body for registering a host.
+type hostRequest struct {
+	Name      string            `json:"name" example:"edge-1"`
+	Endpoint  string            `json:"endpoint" example:"tcp://10.0.0.5:2376"`
+	TLSCACert string            `json:"tls_ca_cert,omitempty" example:"/etc/service-io/hosts/edge-1/ca.pem"`
+	TLSCert   string            `json:"tls_cert,omitempty" example:"/etc/service-io/hosts/edge-1/cert.pem"`
+	TLSKey    string            `json:"tls_key,omitempty" example:"/etc/service-io/hosts/edge-1/key.pem"`
+	Capacity  int               `json:"capacity,omitempty" example:"50"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// updateHostRequest defines the shape of the request body for updating a
+// host. Omitted fields are left unchanged.
+type updateHostRequest struct {
+	Endpoint  *string           `json:"endpoint,omitempty" example:"tcp://10.0.0.5:2376"`
+	TLSCACert *string           `json:"tls_ca_cert,omitempty"`
+	TLSCert   *string           `json:"tls_cert,omitempty"`
+	TLSKey    *string           `json:"tls_key,omitempty"`
+	Capacity  *int              `json:"capacity,omitempty" example:"50"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// Cordoned stops new devices from being scheduled on the host.
+	Cordoned *bool `json:"cordoned,omitempty" example:"false"`
+}
+
+// handleAddHost registers a Docker host.
+// @Summary      Register a host
+// @Description  Adds a Docker engine to the pool new devices are scheduled on.
+// @Tags         hosts
+// @Accept       json
+// @Produce      json
+// @Param        host  body      hostRequest  true  "Host"
+// @Success      201   {object}  devices.Host
+// @Failure      400   {string}  string "Bad Request"
+// @Failure      409   {string}  string "Conflict"
+// @Failure      500   {string}  string "Internal Server Error"
+// @Router       /hosts [post]
+func (h *Handler) handleAddHost(w http.ResponseWriter, r *http.Request) {
+	var req hostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("body must be a JSON object"))
+		return
+	}
+	host, err := h.mgr.CreateHost(r.Context(), devices.Host{
+		Name:      req.Name,
+		Endpoint:  req.Endpoint,
+		TLSCACert: req.TLSCACert,
+		TLSCert:   req.TLSCert,
+		TLSKey:    req.TLSKey,
+		Capacity:  req.Capacity,
+		Labels:    req.Labels,
+	})
+	if err != nil {
+		h.writeHostError(w, err, "add host")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(host)
+}
+
+// handleListHosts lists the host pool.
+// @Summary      List hosts
+// @Description  Lists the registered Docker hosts with the number of devices placed on each.
+// @Tags         hosts
+// @Produce      json
+// @Success      200  {array}   devices.Host
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /hosts [get]
+func (h *Handler) handleListHosts(w http.ResponseWriter, r *http.Request) {
+	hosts, err := h.mgr.ListHosts(r.Context())
+	if err != nil {
+		h.writeHostError(w, err, "list hosts")
+		return
+	}
+	writeJSON(w, hosts)
+}
+
+// handleGetHost returns a single host.
+// @Summary      Get a host
+// @Tags         hosts
+// @Produce      json
+// @Param        name  path      string  true  "Host name"
+// @Success      200   {object}  devices.Host
+// @Failure      404   {string}  string "Not Found"
+// @Failure      500   {string}  string "Internal Server Error"
+// @Router       /hosts/{name} [get]
+func (h *Handler) handleGetHost(w http.ResponseWriter, r *http.Request) {
+	host, err := h.mgr.GetHost(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		h.writeHostError(w, err, "get host")
+		return
+	}
+	writeJSON(w, host)
+}
+
+// handleUpdateHost changes a host.
+// @Summary      Update a host
+// @Description  Changes a host's connection, capacity or labels, or cordons it. Devices already on the host stay there.
+// @Tags         hosts
+// @Accept       json
+// @Produce      json
+// @Param        name  path      string             true  "Host name"
+// @Param        body  body      updateHostRequest  true  "Fields to change"
+// @Success      200   {object}  devices.Host
+// @Failure      400   {string}  string "Bad Request"
+// @Failure      404   {string}  string "Not Found"
+// @Failure      500   {string}  string "Internal Server Error"
+// @Router       /hosts/{name} [patch]
+func (h *Handler) handleUpdateHost(w http.ResponseWriter, r *http.Request) {
+	var req updateHostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("body must be a JSON object"))
+		return
+	}
+	host, err := h.mgr.UpdateHost(r.Context(), chi.URLParam(r, "name"), devices.HostUpdate{
+		Endpoint:  req.Endpoint,
+		TLSCACert: req.TLSCACert,
+		TLSCert:   req.TLSCert,
+		TLSKey:    req.TLSKey,
+		Capacity:  req.Capacity,
+		Labels:    req.Labels,
+		Cordoned:  req.Cordoned,
+	})
+	if err != nil {
+		h.writeHostError(w, err, "update host")
+		return
+	}
+	writeJSON(w, host)
+}
+
+// handleDeleteHost removes a host from the pool.
+// @Summary      Remove a host
+// @Description  Removes a host. Hosts that still have devices cannot be removed; cordon them and move the devices first.
+// @Tags         hosts
+// @Param        name  path  string  true  "Host name"
+// @Success      204
+// @Failure      404   {string}  string "Not Found"
+// @Failure      409   {string}  string "Conflict"
+// @Failure      500   {string}  string "Internal Server Error"
+// @Router       /hosts/{name} [delete]
+func (h *Handler) handleDeleteHost(w http.ResponseWriter, r *http.Request) {
+	if err := h.mgr.DeleteHost(r.Context(), chi.URLParam(r, "name")); err != nil {
+		h.writeHostError(w, err, "delete host")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeHostError maps host pool errors to HTTP status codes.
+func (h *Handler) writeHostError(w http.ResponseWriter, err error, op string) {
+	switch {
+	case errors.Is(err, devices.ErrHostNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, devices.ErrHostExists),
+		errors.Is(err, devices.ErrHostInUse):
+		writeError(w, http.StatusConflict, err)
+	case errors.Is(err, devices.ErrInvalidHost):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		h.writeManagerError(w, err, op)
+	}
+}
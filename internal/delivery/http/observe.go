@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"service-io/internal/core/runtime"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleLogs streams the logs of a device's adapter container.
+// @Summary      Get device logs
+// @Description  Returns the combined stdout and stderr of the device's adapter container as plain text. With follow=true the response stays open and streams new lines.
+// @Tags         devices
+// @Produce      plain
+// @Param        deviceID  path      string  true   "Device ID"
+// @Param        tail      query     int     false  "Number of trailing lines (default: all)"
+// @Param        since     query     string  false  "Only lines after this RFC 3339 timestamp"
+// @Param        follow    query     bool    false  "Keep streaming new lines"
+// @Success      200  {string}  string "Log output"
+// @Failure      400  {string}  string "Bad Request"
+// @Failure      404  {string}  string "Not Found"
+// @Failure      409  {string}  string "Device has no container"
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /devices/{deviceID}/logs [get]
+func (h *Handler) handleLogs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var opts runtime.LogOptions
+	if v := q.Get("tail"); v != "" {
+		tail, err := strconv.Atoi(v)
+		if err != nil || tail < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("tail must be a non-negative integer"))
+			return
+		}
+		opts.Tail = tail
+	}
+	if v := q.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("since must be an RFC 3339 timestamp"))
+			return
+		}
+		opts.Since = since
+	}
+	if v := q.Get("follow"); v != "" {
+		follow, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("follow must be a boolean"))
+			return
+		}
+		opts.Follow = follow
+	}
+
+	rc, err := h.mgr.DeviceLogs(r.Context(), chi.URLParam(r, "deviceID"), opts)
+	if err != nil {
+		h.writeManagerError(w, err, "get device logs")
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	var out io.Writer = w
+	if f, ok := w.(http.Flusher); ok && opts.Follow {
+		out = flushWriter{w: w, f: f}
+	}
+	_, _ = io.Copy(out, rc)
+}
+
+// handleStats returns a resource usage sample of a device's adapter container.
+// @Summary      Get device stats
+// @Description  Samples CPU, memory, network and process usage of the device's adapter container.
+// @Tags         devices
+// @Produce      json
+// @Param        deviceID  path      string  true  "Device ID"
+// @Success      200  {object}  runtime.Stats
+// @Failure      404  {string}  string "Not Found"
+// @Failure      409  {string}  string "Device has no container"
+// @Failure      500  {string}  string "Internal Server Error"
+// @Failure      501  {string}  string "Not supported by the runtime"
+// @Router       /devices/{deviceID}/stats [get]
+func (h *Handler) handleStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.mgr.DeviceStats(r.Context(), chi.URLParam(r, "deviceID"))
+	if err != nil {
+		h.writeManagerError(w, err, "get device stats")
+		return
+	}
+	writeJSON(w, stats)
+}
+
+// flushWriter flushes after every write so followed logs reach the client
+// as they are produced.
+type flushWriter struct {
+	w io.Writer
+	f http.Flusher
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.f.Flush()
+	return n, err
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"service-io/internal/core/devices"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxOperationWait caps how long GET /operations/{id}?wait= blocks.
+const maxOperationWait = 60 * time.Second
+
+// handleDeviceOperations lists the operations run on a device.
+// @Summary      List device operations
+// @Description  Returns the latest operations (create, start, stop, restart, delete, purge) of a device, newest first, with the progress of each step. Operations outlive purged devices.
+// @Tags         devices
+// @Produce      json
+// @Param        deviceID   path      string  true  "Device ID"
+// @Success      200  {array}   devices.Operation
+// @Failure      404  {string}  string "Not Found"
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /devices/{deviceID}/operations [get]
+func (h *Handler) handleDeviceOperations(w http.ResponseWriter, r *http.Request) {
+	ops, err := h.mgr.ListOperations(r.Context(), chi.URLParam(r, "deviceID"))
+	if err != nil {
+		h.writeManagerError(w, err, "list operations")
+		return
+	}
+	writeJSON(w, ops)
+}
+
+// handleGetOperation returns an operation, optionally waiting for it to finish.
+// @Summary      Get an operation
+// @Description  Returns an operation with its current step, image pull progress and, once it succeeded, its result. With wait, blocks up to that many seconds (at most 60) until the operation is done.
+// @Tags         operations
+// @Produce      json
+// @Param        operationID  path      string  true   "Operation ID"
+// @Param        wait         query     int     false  "Seconds to wait for the operation to finish"
+// @Success      200  {object}  devices.Operation
+// @Failure      400  {string}  string "Bad Request"
+// @Failure      404  {string}  string "Not Found"
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /operations/{operationID} [get]
+func (h *Handler) handleGetOperation(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "operationID")
+
+	var wait time.Duration
+	if v := r.URL.Query().Get("wait"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("wait must be a non-negative number of seconds"))
+			return
+		}
+		wait = min(time.Duration(secs)*time.Second, maxOperationWait)
+	}
+
+	var (
+		op  *devices.Operation
+		err error
+	)
+	if wait > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), wait)
+		defer cancel()
+		op, err = h.mgr.WaitOperation(ctx, id)
+	} else {
+		op, err = h.mgr.GetOperation(r.Context(), id)
+	}
+	if err != nil {
+		h.writeManagerError(w, err, "get operation")
+		return
+	}
+	writeJSON(w, op)
+}
+
+// handleCancelOperation asks a running operation to stop.
+// @Summary      Cancel an operation
+// @Description  Requests cancellation of a running operation. It stops at its current step and undoes the completed ones, then ends as cancelled. Poll the operation to see when it has.
+// @Tags         operations
+// @Produce      json
+// @Param        operationID  path      string  true  "Operation ID"
+// @Success      202  {object}  devices.Operation
+// @Failure      404  {string}  string "Not Found"
+// @Failure      409  {string}  string "Conflict"
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /operations/{operationID}/cancel [post]
+func (h *Handler) handleCancelOperation(w http.ResponseWriter, r *http.Request) {
+	op, err := h.mgr.CancelOperation(r.Context(), chi.URLParam(r, "operationID"))
+	if err != nil {
+		h.writeManagerError(w, err, "cancel operation")
+		return
+	}
+	writeAccepted(w, op)
+}
+
+// wantsAsync reports whether the client asked to get an operation back
+// instead of waiting for the action to finish.
+func wantsAsync(r *http.Request) bool {
+	async, _ := strconv.ParseBool(r.URL.Query().Get("async"))
+	return async
+}
+
+// writeAccepted answers a request that started an operation.
+func writeAccepted(w http.ResponseWriter, op *devices.Operation) {
+	w.Header().Set("Location", "/operations/"+op.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(op)
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+)
+
+// handleLastReconcile returns the report of the latest reconcile pass.
+// @Summary      Get the last reconcile report
+// @Description  Returns what the latest background reconcile pass on this replica found: repaired drift between the database, the adapter containers and the JetStream streams, plus orphaned containers and streams. Only the leader replica reconciles.
+// @Tags         reconcile
+// @Produce      json
+// @Success      200  {object}  devices.ReconcileReport
+// @Failure      404  {string}  string "No reconcile has run yet"
+// @Router       /reconcile [get]
+func (h *Handler) handleLastReconcile(w http.ResponseWriter, r *http.Request) {
+	rep := h.mgr.LastReconcile()
+	if rep == nil {
+		writeError(w, http.StatusNotFound, errors.New("no reconcile has run yet"))
+		return
+	}
+	writeJSON(w, rep)
+}
+
+// handleReconcile runs a reconcile pass now.
+// @Summary      Reconcile now
+// @Description  Runs a reconcile pass immediately, waiting for any pass in progress, and returns its report. Only the leader replica reconciles.
+// @Tags         reconcile
+// @Produce      json
+// @Success      200  {object}  devices.ReconcileReport
+// @Failure      503  {string}  string "Not the leader replica"
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /reconcile [post]
+func (h *Handler) handleReconcile(w http.ResponseWriter, r *http.Request) {
+	rep, err := h.mgr.Reconcile(r.Context())
+	if err != nil {
+		h.writeManagerError(w, err, "reconcile")
+		return
+	}
+	writeJSON(w, rep)
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"service-io/internal/core/devices"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// webhookRequest defines the shape of the request body for creating a
+// webhook.
+type webhookRequest struct {
+	URL string `json:"url" example:"https://example.com/hooks/devices"`
+	// Events are the event types to deliver; empty means all of them.
+	Events   []string `json:"events,omitempty" example:"died,deleted"`
+	Selector string   `json:"selector,omitempty" example:"site=plant-1"`
+	// Secret keys the signatures; one is generated if omitted.
+	Secret string `json:"secret,omitempty" example:"s3cr3t"`
+}
+
+// updateWebhookRequest defines the shape of the request body for updating
+// a webhook. Omitted fields are left unchanged.
+type updateWebhookRequest struct {
+	URL      *string   `json:"url,omitempty" example:"https://example.com/hooks/devices"`
+	Events   *[]string `json:"events,omitempty" example:"died,deleted"`
+	Selector *string   `json:"selector,omitempty" example:"site=plant-1"`
+	Secret   *string   `json:"secret,omitempty" example:"n3w-s3cr3t"`
+}
+
+// handleAddWebhook subscribes a URL to device events.
+// @Summary      Add a webhook
+// @Description  Subscribes a URL to device lifecycle events, optionally limited to some event types and to devices matching a label selector. Each event is POSTed as the versioned event envelope, signed in the X-Webhook-Signature header as "sha256=" plus the hex HMAC-SHA256 of "<X-Webhook-Timestamp>.<body>" keyed with the secret. The secret is only returned here.
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Param        webhook  body      webhookRequest  true  "Webhook"
+// @Success      201      {object}  devices.Webhook
+// @Failure      400      {string}  string "Bad Request"
+// @Failure      500      {string}  string "Internal Server Error"
+// @Router       /webhooks [post]
+func (h *Handler) handleAddWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("body must be a JSON object"))
+		return
+	}
+	hook, err := h.mgr.CreateWebhook(r.Context(), devices.Webhook{
+		URL:      req.URL,
+		Events:   req.Events,
+		Selector: req.Selector,
+		Secret:   req.Secret,
+	})
+	if err != nil {
+		h.writeWebhookError(w, err, "add webhook")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(hook)
+}
+
+// handleListWebhooks lists the webhooks.
+// @Summary      List webhooks
+// @Tags         webhooks
+// @Produce      json
+// @Success      200  {array}   devices.Webhook
+// @Failure      500  {string}  string "Internal Server Error"
+// @Router       /webhooks [get]
+func (h *Handler) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := h.mgr.ListWebhooks(r.Context())
+	if err != nil {
+		h.writeWebhookError(w, err, "list webhooks")
+		return
+	}
+	writeJSON(w, hooks)
+}
+
+// handleGetWebhook returns a single webhook.
+// @Summary      Get a webhook
+// @Tags         webhooks
+// @Produce      json
+// @Param        webhookID  path      string  true  "Webhook ID"
+// @Success      200        {object}  devices.Webhook
+// @Failure      404        {string}  string "Not Found"
+// @Failure      500        {string}  string "Internal Server Error"
+// @Router       /webhooks/{webhookID} [get]
+func (h *Handler) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, err := h.mgr.GetWebhook(r.Context(), chi.URLParam(r, "webhookID"))
+	if err != nil {
+		h.writeWebhookError(w, err, "get webhook")
+		return
+	}
+	writeJSON(w, hook)
+}
+
+// handleUpdateWebhook changes a webhook.
+// @Summary      Update a webhook
+// @Description  Changes a webhook. Pending deliveries go to the new URL and are signed with the new secret.
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Param        webhookID  path      string                true  "Webhook ID"
+// @Param        body       body      updateWebhookRequest  true  "Fields to change"
+// @Success      200        {object}  devices.Webhook
+// @Failure      400        {string}  string "Bad Request"
+// @Failure      404        {string}  string "Not Found"
+// @Failure      500        {string}  string "Internal Server Error"
+// @Router       /webhooks/{webhookID} [patch]
+func (h *Handler) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req updateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("body must be a JSON object"))
+		return
+	}
+	hook, err := h.mgr.UpdateWebhook(r.Context(), chi.URLParam(r, "webhookID"), devices.WebhookUpdate{
+		URL:      req.URL,
+		Events:   (*devices.EventFilter)(req.Events),
+		Selector: req.Selector,
+		Secret:   req.Secret,
+	})
+	if err != nil {
+		h.writeWebhookError(w, err, "update webhook")
+		return
+	}
+	writeJSON(w, hook)
+}
+
+// handleDeleteWebhook removes a webhook.
+// @Summary      Delete a webhook
+// @Description  Removes a webhook together with its pending and dead deliveries.
+// @Tags         webhooks
+// @Param        webhookID  path      string  true  "Webhook ID"
+// @Success      204        {string}  string "No Content"
+// @Failure      404        {string}  string "Not Found"
+// @Failure      500        {string}  string "Internal Server Error"
+// @Router       /webhooks/{webhookID} [delete]
+func (h *Handler) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := h.mgr.DeleteWebhook(r.Context(), chi.URLParam(r, "webhookID")); err != nil {
+		h.writeWebhookError(w, err, "delete webhook")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleWebhookDeliveries lists the deliveries of a webhook.
+// @Summary      List webhook deliveries
+// @Description  Returns the latest deliveries of a webhook, newest first. Use status=dead for the dead-letter list: deliveries that failed every attempt.
+// @Tags         webhooks
+// @Produce      json
+// @Param        webhookID  path      string  true   "Webhook ID"
+// @Param        status     query     string  false  "pending, delivered or dead"
+// @Success      200        {array}   devices.WebhookDelivery
+// @Failure      400        {string}  string "Bad Request"
+// @Failure      404        {string}  string "Not Found"
+// @Failure      500        {string}  string "Internal Server Error"
+// @Router       /webhooks/{webhookID}/deliveries [get]
+func (h *Handler) handleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", devices.DeliveryPending, devices.DeliveryDelivered, devices.DeliveryDead:
+	default:
+		writeError(w, http.StatusBadRequest, errors.New("status must be pending, delivered or dead"))
+		return
+	}
+	deliveries, err := h.mgr.ListWebhookDeliveries(r.Context(), chi.URLParam(r, "webhookID"), status)
+	if err != nil {
+		h.writeWebhookError(w, err, "list webhook deliveries")
+		return
+	}
+	writeJSON(w, deliveries)
+}
+
+// handleRedeliverWebhook queues a delivery again.
+// @Summary      Redeliver a webhook delivery
+// @Description  Queues a delivery, typically a dead one, to be attempted again right away with a fresh retry budget.
+// @Tags         webhooks
+// @Produce      json
+// @Param        webhookID   path      string  true  "Webhook ID"
+// @Param        deliveryID  path      string  true  "Delivery ID"
+// @Success      202         {object}  devices.WebhookDelivery
+// @Failure      404         {string}  string "Not Found"
+// @Failure      500         {string}  string "Internal Server Error"
+// @Router       /webhooks/{webhookID}/deliveries/{deliveryID}/redeliver [post]
+func (h *Handler) handleRedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	d, err := h.mgr.RedeliverWebhook(r.Context(), chi.URLParam(r, "webhookID"), chi.URLParam(r, "deliveryID"))
+	if err != nil {
+		h.writeWebhookError(w, err, "redeliver webhook")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(d)
+}
+
+func (h *Handler) writeWebhookError(w http.ResponseWriter, err error, op string) {
+	switch {
+	case errors.Is(err, devices.ErrWebhookNotFound),
+		errors.Is(err, devices.ErrDeliveryNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, devices.ErrInvalidWebhook):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		h.writeManagerError(w, err, op)
+	}
+}
@@ -0,0 +1,52 @@
+// Package version holds the build version of service-io.
+package version
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is the running service-io version. Release builds override it with
+// -ldflags "-X service-io/internal/version.Version=<version>".
+var Version = "1.0.0"
+
+// AtLeast reports whether the running version is >= min. Both are compared
+// as major.minor.patch; a leading "v" and any pre-release or build suffix
+// are ignored.
+func AtLeast(min string) (bool, error) {
+	have, err := parse(Version)
+	if err != nil {
+		return false, fmt.Errorf("running version: %w", err)
+	}
+	want, err := parse(min)
+	if err != nil {
+		return false, err
+	}
+	for i := range have {
+		if have[i] != want[i] {
+			return have[i] > want[i], nil
+		}
+	}
+	return true, nil
+}
+
+func parse(v string) ([3]int, error) {
+	var out [3]int
+	s := strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return out, fmt.Errorf("invalid version %q", v)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return out, fmt.Errorf("invalid version %q", v)
+		}
+		out[i] = n
+	}
+	return out, nil
+}